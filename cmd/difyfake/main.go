@@ -0,0 +1,29 @@
+// difyfake serves a fake dify chat-messages api locally, so that the replies can be generated
+// without api.dify.ai. Point the service to it by the env llm_url:
+//
+//	go run ./cmd/difyfake -addr 127.0.0.1:9904 -key app-test-key
+//	llm_backend=dify_chat llm_url=http://127.0.0.1:9904/v1/chat-messages llm_key=app-test-key go run ./exec
+//
+// Every review is answered deterministically by the item type and the review text.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"PulseCheck/internal/difyfake"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9904", "address to listen on")
+	key := flag.String("key", "", "api key the requests must carry, any key is accepted if empty")
+	latency := flag.Duration("latency", 0, "delay of every answer, of every chunk when streaming")
+	flag.Parse()
+
+	fake := difyfake.New()
+	fake.SetAPIKey(*key)
+	fake.SetLatency(*latency)
+	log.Printf("difyfake serves on http://%s%s", *addr, difyfake.ChatMessagesPath)
+	log.Fatal(http.ListenAndServe(*addr, fake))
+}
@@ -0,0 +1,53 @@
+// keystore manages the encrypted keystore of the service, the passphrase is read from the env
+// keystore_passphrase and the secret value from stdin so that neither shows up in the shell history.
+//
+//	keystore_passphrase=***** go run ./cmd/keystore -keystore ./secrets/keystore.json set llm_key < key.txt
+//	keystore_passphrase=***** go run ./cmd/keystore -keystore ./secrets/keystore.json list
+//	keystore_passphrase=***** go run ./cmd/keystore -keystore ./secrets/keystore.json delete llm_key
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"PulseCheck/internal/secret"
+)
+
+func main() {
+	path := flag.String("keystore", "./secrets/keystore.json", "path of the keystore")
+	flag.Parse()
+	keystore, err := secret.OpenKeystore(*path, os.Getenv("keystore_passphrase"))
+	if err != nil {
+		log.Fatalf("open keystore error:%+v", err)
+	}
+	switch flag.Arg(0) {
+	case "list":
+		for _, name := range keystore.Names() {
+			fmt.Println(name)
+		}
+	case "set":
+		name := flag.Arg(1)
+		if len(name) == 0 {
+			log.Fatalf("secret name not set.")
+		}
+		fmt.Fprintf(os.Stderr, "value of %s: ", name)
+		value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		value = strings.TrimSpace(value)
+		if len(value) == 0 {
+			log.Fatalf("read secret value error:%v", err)
+		}
+		if err = keystore.Set(name, value); err != nil {
+			log.Fatalf("set secret error:%+v", err)
+		}
+	case "delete":
+		if err = keystore.Set(flag.Arg(1), ""); err != nil {
+			log.Fatalf("delete secret error:%+v", err)
+		}
+	default:
+		log.Fatalf("unknown command:%s, list|set|delete is supported.", flag.Arg(0))
+	}
+}
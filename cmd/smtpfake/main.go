@@ -0,0 +1,48 @@
+// smtpfake serves a fake smtp server locally and prints every mail it receives, so that the email
+// digest and alerts can be checked without a mailbox. Its certificate is self-signed, point the
+// service to it without TLS:
+//
+//	go run ./cmd/smtpfake -addr 127.0.0.1:9905
+//	email_enabled=1 email_host=127.0.0.1 email_port=9905 email_tls=none \
+//	email_from=seller@example.com email_to=ops@example.com go run ./exec
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"PulseCheck/internal/smtpfake"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9905", "address to listen on")
+	implicitTLS := flag.Bool("tls", false, "speak implicit TLS instead of offering STARTTLS")
+	username := flag.String("username", "", "username the clients must authenticate by, none is required if empty")
+	password := flag.String("password", "", "password the clients must authenticate by")
+	flag.Parse()
+
+	fake, err := smtpfake.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(*username) != 0 {
+		fake.SetAuth(*username, *password)
+	}
+	fake.OnMessage(func(message *smtpfake.Message) {
+		log.Printf("mail from:%s to:%v subject:%s\n%s", message.From, message.To, message.Header("Subject"), message.Body())
+	})
+	start := fake.Start
+	if *implicitTLS {
+		start = fake.StartTLS
+	}
+	if err = start(*addr); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("smtpfake serves on %s, implicit tls:%t", fake.Addr(), *implicitTLS)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	<-signals
+	_ = fake.Close()
+}
@@ -0,0 +1,49 @@
+// xhsfake serves a fake xiaohongshu seller api locally, so that the cron task can be run end to
+// end without touching a real shop. Point the service to it by the env xhs_base_url:
+//
+//	go run ./cmd/xhsfake -addr 127.0.0.1:9903 -token AT-test-token
+//	xhs_base_url=http://127.0.0.1:9903 auth=AT-test-token go run ./exec
+//
+// The replies received are listed by GET /replies.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"PulseCheck/internal/xhsfake"
+	"PulseCheck/internal/xhsreq"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9903", "address to listen on")
+	dataset := flag.String("reviews", "", "json array of the reviews to serve, sample reviews if empty")
+	samples := flag.Int("samples", 30, "number of the sample reviews")
+	token := flag.String("token", "", "token the cookie must carry, any token is accepted if empty")
+	flag.Parse()
+
+	reviews := xhsfake.SampleReviews(*samples, time.Now())
+	if len(*dataset) != 0 {
+		var err error
+		if reviews, err = xhsfake.LoadReviews(*dataset); err != nil {
+			log.Fatalf("load reviews error:%+v", err)
+		}
+	}
+	fake := xhsfake.New(reviews...)
+	fake.SetToken(*token)
+
+	mux := http.NewServeMux()
+	mux.Handle(xhsreq.ReviewManagerPath, fake)
+	mux.Handle(xhsreq.ReviewReplyPath, fake)
+	mux.HandleFunc("/replies", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(writer).Encode(fake.Replies()); err != nil {
+			log.Printf("write replies error:%v", err)
+		}
+	})
+	log.Printf("xhsfake serves %d reviews on http://%s", len(reviews), *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/secret"
+	"PulseCheck/internal/tools"
+)
+
+// withAdmin serves the request by handler only if it carries the admin token as
+// "Authorization: Bearer <token>". Without an admin token in the secrets only the requests from
+// localhost are served. The token is read on every request like the other secrets.
+func withAdmin(handler HttpFunc) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		token, err := secrets.Get(request.Context(), secret.AdminToken)
+		if err != nil && !errors.Is(err, secret.ErrNotFound) {
+			writeError(writer, http.StatusInternalServerError, errors.WithMessagef(err, "get admin token error."))
+			return
+		}
+		if len(token) == 0 {
+			if !isLoopback(request.RemoteAddr) {
+				writeError(writer, http.StatusForbidden,
+					errors.Errorf("admin token not set, request from:%s refused", request.RemoteAddr))
+				return
+			}
+			handler(writer, request)
+			return
+		}
+		tools.RegisterSecret(token)
+		bearer, found := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(writer, http.StatusUnauthorized, errors.Errorf("admin token mismatch, request from:%s", request.RemoteAddr))
+			return
+		}
+		handler(writer, request)
+	}
+}
+
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+
+	"PulseCheck/internal/task/review"
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsreq"
+)
+
+// ApprovalListHandler lists the replies of the queue, filtered by ?status= if set.
+func ApprovalListHandler(queue *review.ApprovalQueue) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		status := review.ApprovalStatus(request.FormValue("status"))
+		writeJSON(writer, http.StatusOK, queue.List(status))
+	}
+}
+
+type approvalRequest struct {
+	Id           string `json:"id"`
+	ReplyContent string `json:"reply_content"`
+	Reason       string `json:"reason"`
+}
+
+func decodeApprovalRequest(writer http.ResponseWriter, request *http.Request) (*approvalRequest, bool) {
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	body := &approvalRequest{}
+	if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+		writeError(writer, http.StatusBadRequest, errors.WithMessagef(err, "decode approval request error."))
+		return nil, false
+	}
+	if len(body.Id) == 0 {
+		writeError(writer, http.StatusBadRequest, errors.New("id not set properly"))
+		return nil, false
+	}
+	return body, true
+}
+
+// ApprovalEditHandler replaces the reply content, body: {"id":"","reply_content":""}
+func ApprovalEditHandler(queue *review.ApprovalQueue) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		body, ok := decodeApprovalRequest(writer, request)
+		if !ok {
+			return
+		}
+		if len(body.ReplyContent) == 0 {
+			writeError(writer, http.StatusBadRequest, errors.New("reply_content not set properly"))
+			return
+		}
+		if err := queue.Edit(body.Id, body.ReplyContent); err != nil {
+			writeApprovalError(writer, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ApprovalRejectHandler rejects the reply, body: {"id":"","reason":""}
+func ApprovalRejectHandler(queue *review.ApprovalQueue) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		body, ok := decodeApprovalRequest(writer, request)
+		if !ok {
+			return
+		}
+		if err := queue.Reject(body.Id, body.Reason); err != nil {
+			writeApprovalError(writer, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ApprovalApproveHandler posts the replies of ?id=a&id=b, or all pending ones with ?all=1.
+func ApprovalApproveHandler(ctx context.Context, queue *review.ApprovalQueue, newReviewReply func(ctx context.Context) *xhsreq.ReviewReply) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost {
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if err := request.ParseForm(); err != nil {
+			writeError(writer, http.StatusBadRequest, err)
+			return
+		}
+		ids := request.Form["id"]
+		if len(ids) == 0 && !cast.ToBool(request.FormValue("all")) {
+			writeError(writer, http.StatusBadRequest, errors.New("id or all param not set properly"))
+			return
+		}
+		ctx1 := tools.AppendWriter(ctx, writer)
+		reviewReplyHandler := review.NewReviewReplyHandler(ctx1, newReviewReply(ctx1), store, replyDelay())
+		if err := queue.Approve(ctx1, reviewReplyHandler, ids...); err != nil {
+			tools.LogFromContext(ctx1, "--审核回复发送失败-- error:%v", err)
+			return
+		}
+		tools.LogFromContext(ctx1, "--审核回复发送成功--")
+	}
+}
+
+func writeApprovalError(writer http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, review.ErrApprovalNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, review.ErrApprovalHandled):
+		status = http.StatusConflict
+	case errors.Is(err, review.ErrApprovalNoReply):
+		status = http.StatusUnprocessableEntity
+	}
+	writeError(writer, status, err)
+}
+
+// FollowUpListHandler lists the after-sales follow-ups, filtered by ?status= if set.
+func FollowUpListHandler(followUps *review.FollowUpQueue) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if followUps == nil {
+			writeError(writer, http.StatusNotFound, errors.New("follow-up not enabled"))
+			return
+		}
+		status := review.FollowUpStatus(request.FormValue("status"))
+		writeJSON(writer, http.StatusOK, followUps.List(status))
+	}
+}
+
+// FollowUpCloseHandler closes the follow-up, body: {"id":"","reason":""} where reason is the note.
+func FollowUpCloseHandler(followUps *review.FollowUpQueue) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if followUps == nil {
+			writeError(writer, http.StatusNotFound, errors.New("follow-up not enabled"))
+			return
+		}
+		body, ok := decodeApprovalRequest(writer, request)
+		if !ok {
+			return
+		}
+		if err := followUps.Close(body.Id, body.Reason); err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, review.ErrFollowUpNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, review.ErrFollowUpClosed):
+				status = http.StatusConflict
+			}
+			writeError(writer, status, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// AppealListHandler lists the appeal candidates, filtered by ?status= if set.
+func AppealListHandler(appeals *review.AppealQueue) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if appeals == nil {
+			writeError(writer, http.StatusNotFound, errors.New("appeal not enabled"))
+			return
+		}
+		status := review.AppealStatus(request.FormValue("status"))
+		writeJSON(writer, http.StatusOK, appeals.List(status))
+	}
+}
+
+// AppealDismissHandler gives up the appeal so that the review is replied, body: {"id":""}
+func AppealDismissHandler(appeals *review.AppealQueue) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if appeals == nil {
+			writeError(writer, http.StatusNotFound, errors.New("appeal not enabled"))
+			return
+		}
+		body, ok := decodeApprovalRequest(writer, request)
+		if !ok {
+			return
+		}
+		if err := appeals.Dismiss(body.Id); err != nil {
+			writeAppealError(writer, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// AppealFiledHandler marks the appeal filed by hand in the seller center, body: {"id":""}
+func AppealFiledHandler(appeals *review.AppealQueue) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if appeals == nil {
+			writeError(writer, http.StatusNotFound, errors.New("appeal not enabled"))
+			return
+		}
+		body, ok := decodeApprovalRequest(writer, request)
+		if !ok {
+			return
+		}
+		if err := appeals.MarkFiled(body.Id); err != nil {
+			writeAppealError(writer, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeAppealError(writer http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, review.ErrAppealNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, review.ErrAppealHandled):
+		status = http.StatusConflict
+	}
+	writeError(writer, status, err)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/catalog"
+	"PulseCheck/internal/tools"
+)
+
+// CatalogHandler lists(GET), adds or replaces(POST/PUT) and deletes(DELETE ?itemid=) the products.
+func CatalogHandler(productCatalog *catalog.Catalog) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet:
+			writeJSON(writer, http.StatusOK, productCatalog.List())
+		case http.MethodPost, http.MethodPut:
+			product := &catalog.Product{}
+			if err := json.NewDecoder(request.Body).Decode(product); err != nil {
+				writeError(writer, http.StatusBadRequest, errors.WithMessagef(err, "decode product error."))
+				return
+			}
+			if err := productCatalog.Upsert(product); err != nil {
+				writeError(writer, http.StatusBadRequest, err)
+				return
+			}
+			writeJSON(writer, http.StatusOK, product)
+		case http.MethodDelete:
+			itemID := request.FormValue("itemid")
+			if len(itemID) == 0 {
+				writeError(writer, http.StatusBadRequest, errors.New("itemid param not set properly"))
+				return
+			}
+			if err := productCatalog.Delete(itemID); err != nil {
+				status := http.StatusInternalServerError
+				if errors.Is(err, catalog.ErrUnknownItem) {
+					status = http.StatusNotFound
+				}
+				writeError(writer, status, err)
+				return
+			}
+			writer.WriteHeader(http.StatusNoContent)
+		default:
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// CatalogFallbackHandler shows(GET) and replaces(POST/PUT) the fallback for unknown items.
+func CatalogFallbackHandler(productCatalog *catalog.Catalog) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet:
+			writeJSON(writer, http.StatusOK, productCatalog.Fallback())
+		case http.MethodPost, http.MethodPut:
+			fallback := &catalog.Fallback{}
+			if err := json.NewDecoder(request.Body).Decode(fallback); err != nil {
+				writeError(writer, http.StatusBadRequest, errors.WithMessagef(err, "decode fallback error."))
+				return
+			}
+			if err := productCatalog.SetFallback(fallback); err != nil {
+				writeError(writer, http.StatusInternalServerError, err)
+				return
+			}
+			writeJSON(writer, http.StatusOK, fallback)
+		default:
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// CatalogReloadHandler reads the catalog file again after it is edited by hand.
+func CatalogReloadHandler(productCatalog *catalog.Catalog) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if err := productCatalog.Reload(); err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(writer, http.StatusOK, productCatalog.List())
+	}
+}
+
+func writeJSON(writer http.ResponseWriter, status int, v any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	if err := json.NewEncoder(writer).Encode(v); err != nil {
+		slog.Error("write json response error.", tools.ErrAttr(err))
+	}
+}
+
+func writeError(writer http.ResponseWriter, status int, err error) {
+	slog.Error("http request error.", slog.Int("status", status), tools.ErrAttr(err))
+	http.Error(writer, err.Error(), status)
+}
@@ -7,34 +7,126 @@ import (
 
 	"github.com/pkg/errors"
 
+	"PulseCheck/internal/shop"
 	"PulseCheck/internal/task"
 	"PulseCheck/internal/task/review"
 	"PulseCheck/internal/tools"
 	"PulseCheck/internal/xhsreq"
 )
 
-func ReplyForLatestReview(ctx context.Context) error {
+// ReplyForLatestReview replies the latest reviews of every shop concurrently, one task per shop.
+// A failed or even panicked shop does not stop the others.
+func ReplyForLatestReview(ctx context.Context, shops []*shop.Shop) error {
 	slog.Info("cron task has started...")
 	defer slog.Info("cron task has finished.")
-	xhsHttpsClient := tools.NewHttpsClient(xhsreq.XiaohongshuDomain)
+	taskList := make([]task.Executable, 0, len(shops))
+	for _, s := range shops {
+		taskList = append(taskList, &shopTask{shop: s, run: replyForLatestReview})
+	}
+	return task.CreateConcExecutableContainer(taskList).Execute(ctx)
+}
 
-	reviewManager := xhsreq.NewReviewManager(ctx, xhsHttpsClient)
-	reviewChat := xhsreq.NewXHSReviewChatWithHTTP(ctx)
-	reviewReply := xhsreq.NewReviewReply(ctx, xhsHttpsClient)
+func replyForLatestReview(ctx context.Context, s *shop.Shop) error {
+	dryRun := s.Cron.DryRun
+	ctx = tools.AppendDryRun(s.Context(ctx), dryRun)
+	reviewManager := s.ReviewManager(ctx)
 
 	after := time.Now()
-	start := after.Add(-24 * time.Hour)
+	start := after.Add(-s.Cron.Lookback)
 	param := &xhsreq.ReviewSearchParam{
-		ContentTypeList:       []int{2},
-		ReviewReplyStatusList: []int{2},
+		ContentTypeList:       conf.Review.ContentTypeList,
+		ReviewReplyStatusList: conf.Review.ReviewReplyStatusList,
 		StartTime:             &start,
 		EndTime:               &after,
-		PageSize:              20,
+		PageSize:              conf.Review.PageSize,
+	}
+	return runReplyTask(ctx, s, "latest_review", dryRun, review.NewReviewProvider(param, reviewManager, store))
+}
+
+// replyDelay spaces the replies out as configured by review.reply_delay_min and review.reply_delay_max.
+func replyDelay() review.ReplyHandlerOption {
+	return review.WithReplyDelay(conf.Review.ReplyDelayMin, conf.Review.ReplyDelayMax)
+}
+
+// runReplyTask generates and posts the replies of the reviews given by provider on behalf of the shop.
+func runReplyTask(ctx context.Context, s *shop.Shop, name string, dryRun bool, provider task.DataProvider[[]*review.ReviewReplyData]) error {
+	if err := s.Session.Check(); err != nil {
+		tools.LogFromContext(ctx, "--店铺[%s]登录已失效, 跳过-- error:%v", s.ID, err)
+		return err
+	}
+	reviewChat, err := xhsreq.NewReplyGenerator(ctx, s.Generator, s.Catalog)
+	if err != nil {
+		return errors.WithMessagef(err, "create reply generator of shop:%s error.", s.ID)
 	}
+	classifier, err := xhsreq.NewClassifier(ctx, s.Classifier, s.Catalog)
+	if err != nil {
+		return errors.WithMessagef(err, "create classifier of shop:%s error.", s.ID)
+	}
+	reviewReply := s.ReviewReply(ctx)
+
+	reviewReplyHandler := review.NewReviewReplyHandler(ctx, reviewReply, store, replyDelay())
+	generation := review.NewReplyGenerationFilter(ctx, reviewChat, store)
+	filters := []task.Filter[[]*review.ReviewReplyData]{
+		review.NewDedupFilter(ctx, store, s.ApprovalQueue),
+		review.NewClassificationFilter(ctx, classifier, store),
+	}
+	if s.Routing != nil {
+		escalationOptions := []review.EscalationOption{review.WithDraft(generation), review.WithDraftGuardrail(s.Guardrail)}
+		if s.FollowUps != nil {
+			escalationOptions = append(escalationOptions, review.WithFollowUp(s.FollowUps))
+		}
+		if emailNotifier != nil && conf.Email.Alerts {
+			escalationOptions = append(escalationOptions, review.WithEscalationNotifier(emailNotifier))
+		}
+		if alerter != nil {
+			escalationOptions = append(escalationOptions, review.WithEscalationNotifier(alerter))
+		}
+		escalation := review.NewEscalationHandler(ctx, s.ApprovalQueue, s.Routing, escalationOptions...)
+		filters = append(filters, review.NewRoutingFilter(ctx, s.Routing, escalation))
+	}
+	if s.Appeals != nil {
+		filters = append(filters, review.NewAppealFilter(ctx, s.AppealDetector, s.Appeals))
+	}
+	filters = append(filters, generation,
+		review.NewGuardrailFilter(ctx, s.Guardrail, generation, conf.Guardrail.Regenerations, s.ApprovalQueue))
 	xhsReviewReplyTask := task.NewTask[[]*review.ReviewReplyData](
-		review.NewReviewProvider(param, reviewManager, reviewChat),
-		review.NewReviewReplyHandler(ctx, reviewReply),
+		provider,
+		review.NewApprovalReplyHandler(ctx, s.ApprovalQueue, s.Policy, reviewReplyHandler),
+		filters...,
 	)
-	err := xhsReviewReplyTask.Execute(ctx)
-	return errors.WithMessagef(err, "xiaohongshu delivery task error.")
+	err = recordRun(ctx, name+":"+s.ID, dryRun, func(ctx context.Context) error {
+		startedAt := time.Now()
+		runErr := xhsReviewReplyTask.Execute(ctx)
+		if alerter != nil && !dryRun {
+			notifyRun(ctx, s, startedAt)
+		}
+		return runErr
+	})
+	if dryRun {
+		proposals := reviewReplyHandler.Proposals()
+		slog.Info("dry run finished.", slog.String("shop", s.ID), slog.Int("proposals", len(proposals)))
+		tools.LogFromContext(ctx, "\n--试运行结束, 共生成%d条回复--", len(proposals))
+	}
+	return errors.WithMessagef(err, "xiaohongshu delivery task of shop:%s error.", s.ID)
+}
+
+// ----------------------------------
+// shopTask runs the job of a shop, a panic is turned into its error so that the other shops
+// running in the same container are not affected.
+type shopTask struct {
+	shop *shop.Shop
+	run  func(ctx context.Context, s *shop.Shop) error
+}
+
+func (this *shopTask) Execute(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("shop task panicked.", slog.String("shop", this.shop.ID), slog.Any("panic", r))
+			err = errors.Errorf("shop:%s task panicked: %v", this.shop.ID, r)
+		}
+	}()
+	if err = this.run(ctx, this.shop); err != nil {
+		slog.Error("shop task error.", slog.String("shop", this.shop.ID), tools.ErrAttr(err))
+	}
+	return err
 }
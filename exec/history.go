@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+
+	"PulseCheck/internal/storage"
+	"PulseCheck/internal/task/review"
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsreq"
+)
+
+const (
+	defaultRunListLimit = 20
+	defaultReportDays   = 7
+)
+
+// recordRun keeps the run of the task in the store, the records saved during it carry the run id.
+func recordRun(ctx context.Context, name string, dryRun bool, run func(ctx context.Context) error) error {
+	ctx, taskRun, err := store.Runs().Start(ctx, name, dryRun)
+	if err != nil {
+		slog.Error("record task run error.", slog.String("name", name), tools.ErrAttr(err))
+		return run(ctx)
+	}
+	runErr := run(ctx)
+	if err = store.Runs().Finish(taskRun, runErr); err != nil {
+		slog.Error("finish task run error.", slog.Uint64("runId", taskRun.Id), tools.ErrAttr(err))
+	}
+	return runErr
+}
+
+// RunHistoryHandler lists the latest task runs, ?limit= 20 by default.
+func RunHistoryHandler(store *storage.Store) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		limit := cast.ToInt(request.FormValue("limit"))
+		if limit <= 0 {
+			limit = defaultRunListLimit
+		}
+		runs, err := store.Runs().List(limit)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(writer, http.StatusOK, runs)
+	}
+}
+
+type reviewHistory struct {
+	Review   *storage.ReviewRecord   `json:"review"`
+	Replies  []*storage.ReplyRecord  `json:"replies"`
+	Attempts []*storage.ReplyAttempt `json:"attempts"`
+	Replied  *storage.RepliedReview  `json:"replied,omitempty"`
+}
+
+// ReviewHistoryHandler shows the review of ?id= along with its generated replies and reply attempts.
+func ReviewHistoryHandler(store *storage.Store) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		reviewID := request.FormValue("id")
+		if len(reviewID) == 0 {
+			writeError(writer, http.StatusBadRequest, errors.New("id param not set properly"))
+			return
+		}
+		record, err := store.Reviews().Get(reviewID)
+		if errors.Is(err, storage.ErrNotFound) {
+			writeError(writer, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		history := &reviewHistory{Review: record}
+		if history.Replies, err = store.Replies().ListByReview(reviewID); err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		if history.Attempts, err = store.Attempts().ListByReview(reviewID); err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		history.Replied, err = store.Ledger().Get(reviewID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(writer, http.StatusOK, history)
+	}
+}
+
+// ClassificationReportHandler counts the reviews created within the last ?days= by their
+// sentiment, topics and urgency, 7 days by default.
+func ClassificationReportHandler(store *storage.Store) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		days := cast.ToInt(request.FormValue("days"))
+		if days <= 0 {
+			days = defaultReportDays
+		}
+		since := time.Now().AddDate(0, 0, -days)
+		records, err := store.Reviews().ListSince(since)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		reviews := make([]*xhsreq.Review, 0, len(records))
+		for _, record := range records {
+			reviews = append(reviews, record.Review)
+		}
+		writeJSON(writer, http.StatusOK, review.NewClassificationReport(since, reviews))
+	}
+}
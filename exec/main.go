@@ -11,15 +11,16 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/spf13/cast"
 
 	"PulseCheck/internal/config"
+	"PulseCheck/internal/shop"
 	"PulseCheck/internal/tools"
 )
 
 const (
 	RandomMinutesRange = 10
 	ProgramTimeout     = 5 * time.Minute
-	HttpServerPort     = 1903
 )
 
 func main() {
@@ -30,35 +31,75 @@ func main() {
 			log.Fatal("close log error")
 		}
 	}()
-	config.StartPprof(nil)
+	if conf.Pprof.Enabled {
+		config.StartPprof(nil, conf.Pprof.Port)
+	}
 	executeAndWaitExit([]os.Signal{syscall.SIGTERM, syscall.SIGKILL}, func(ctx context.Context) error {
 		// start cron server
-		if err := StartCronServer(ctx, map[string]CronFunc{
-			// execute every day at noon
-			"0 0 * * ?": func() {
-				err := ReplyForLatestReview(ctx)
-				if nil != err {
-					slog.Error("check run error", tools.ErrAttr(err))
-				}
-			},
-		}); err != nil {
+		if err := StartCronServer(ctx, cronHandlers(ctx, shops)); err != nil {
 			log.Fatalf("start cron server. error: %v", err)
 		}
 		slog.Info("cron server started")
 		// start http server
-		if err := StartHttpServer(ctx, HttpServerPort, map[string]HttpFunc{
-			"/replywithorderid": func(writer http.ResponseWriter, request *http.Request) {
-				ctx1 := tools.AppendXHSToken(ctx, authorization)
-				ctx1 = tools.AppendWriter(ctx1, writer)
-				orderID := request.FormValue("orderid")
-				if len(orderID) == 0 {
-					tools.LogFromContext(ctx, "orderid param not set properly")
-					return
+		if err := StartHttpServer(ctx, conf.Server.Port, map[string]HttpFunc{
+			"/replywithorderid": withAdmin(withShop(shops, func(s *shop.Shop) HttpFunc {
+				return func(writer http.ResponseWriter, request *http.Request) {
+					ctx1 := tools.AppendWriter(ctx, writer)
+					orderID := request.FormValue("orderid")
+					if len(orderID) == 0 {
+						tools.LogFromContext(ctx1, "orderid param not set properly")
+						return
+					}
+					dryRun := cast.ToBool(request.FormValue("dryrun"))
+					err := ReplyWithOrderID(ctx1, s, orderID, dryRun)
+					if nil != err {
+						slog.Error("reply with order id error", slog.String("orderId", orderID), tools.ErrAttr(err))
+					}
 				}
-				ReplyWithOrderID(ctx1, orderID)
-			},
+			})),
+			"/shops": ShopListHandler(shops),
+			"/catalog": withAdmin(withShop(shops, func(s *shop.Shop) HttpFunc {
+				return CatalogHandler(s.Catalog)
+			})),
+			"/catalog/fallback": withAdmin(withShop(shops, func(s *shop.Shop) HttpFunc {
+				return CatalogFallbackHandler(s.Catalog)
+			})),
+			"/catalog/reload": withAdmin(withShop(shops, func(s *shop.Shop) HttpFunc {
+				return CatalogReloadHandler(s.Catalog)
+			})),
+			"/approval": withAdmin(withShop(shops, func(s *shop.Shop) HttpFunc {
+				return ApprovalListHandler(s.ApprovalQueue)
+			})),
+			"/approval/edit": withAdmin(withShop(shops, func(s *shop.Shop) HttpFunc {
+				return ApprovalEditHandler(s.ApprovalQueue)
+			})),
+			"/approval/reject": withAdmin(withShop(shops, func(s *shop.Shop) HttpFunc {
+				return ApprovalRejectHandler(s.ApprovalQueue)
+			})),
+			"/approval/approve": withAdmin(withShop(shops, func(s *shop.Shop) HttpFunc {
+				return ApprovalApproveHandler(s.Context(ctx), s.ApprovalQueue, s.ReviewReply)
+			})),
+			"/followup": withAdmin(withShop(shops, func(s *shop.Shop) HttpFunc {
+				return FollowUpListHandler(s.FollowUps)
+			})),
+			"/followup/close": withAdmin(withShop(shops, func(s *shop.Shop) HttpFunc {
+				return FollowUpCloseHandler(s.FollowUps)
+			})),
+			"/appeal": withAdmin(withShop(shops, func(s *shop.Shop) HttpFunc {
+				return AppealListHandler(s.Appeals)
+			})),
+			"/appeal/dismiss": withAdmin(withShop(shops, func(s *shop.Shop) HttpFunc {
+				return AppealDismissHandler(s.Appeals)
+			})),
+			"/appeal/filed": withAdmin(withShop(shops, func(s *shop.Shop) HttpFunc {
+				return AppealFiledHandler(s.Appeals)
+			})),
+			"/session":                 withAdmin(withShop(shops, SessionHandler)),
+			"/history/runs":            withAdmin(RunHistoryHandler(store)),
+			"/history/review":          withAdmin(ReviewHistoryHandler(store)),
+			"/history/classifications": withAdmin(ClassificationReportHandler(store)),
 		}); err != nil {
-			log.Fatalf("start http server. port:%d error: %v", HttpServerPort, err)
+			log.Fatalf("start http server. port:%d error: %v", conf.Server.Port, err)
 		}
 		slog.Info("http server started")
 
@@ -74,9 +115,12 @@ func main() {
 		// ---------- stop http server
 		slog.Info("stopping http server.")
 		if err := StopHttpServer(ctx); err != nil {
-			slog.Error("stop http server.", slog.Int("port", HttpServerPort), tools.ErrAttr(err))
+			slog.Error("stop http server.", slog.Int("port", conf.Server.Port), tools.ErrAttr(err))
 		}
 		slog.Info("http server has been stopped")
+		if err := store.Close(); err != nil {
+			slog.Error("close store.", tools.ErrAttr(err))
+		}
 		return nil
 	})
 }
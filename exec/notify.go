@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/config"
+	"PulseCheck/internal/notify"
+	"PulseCheck/internal/secret"
+	"PulseCheck/internal/shop"
+	"PulseCheck/internal/storage"
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/task/review"
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsreq"
+)
+
+const (
+	digestPeriod = 24 * time.Hour
+)
+
+// newEmailNotifier mails by the smtp server of conf, nil if the email is disabled.
+func newEmailNotifier(ctx context.Context, conf *config.EmailConfig, secrets secret.Provider) (*notify.EmailNotifier, error) {
+	if !conf.Enabled {
+		return nil, nil
+	}
+	passwd, err := secrets.Get(ctx, secret.SMTPPassword)
+	if err != nil && !errors.Is(err, secret.ErrNotFound) {
+		return nil, errors.WithMessagef(err, "get smtp password error.")
+	}
+	sender := &task.EmailSender{
+		Domain: conf.Domain,
+		Host:   conf.Host,
+		Port:   strconv.Itoa(conf.Port),
+		From:   conf.From,
+		Passwd: passwd,
+		To:     conf.To,
+	}
+	mailer := notify.NewMailer(sender, notify.WithTLSMode(notify.TLSMode(conf.TLS)), notify.WithMailTimeout(conf.Timeout))
+	return notify.NewEmailNotifier(mailer), nil
+}
+
+// newAlerter posts to the webhooks of conf, nil if there is none.
+func newAlerter(conf *config.NotifyConfig) (*notify.Alerter, error) {
+	if len(conf.Webhooks) == 0 {
+		return nil, nil
+	}
+	notifiers := make(notify.Notifiers, 0, len(conf.Webhooks))
+	for _, webhookConf := range conf.Webhooks {
+		webhook, err := notify.NewWebhook(notify.WebhookKind(webhookConf.Kind), webhookConf.URL, webhookConf.Secret)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, webhook)
+	}
+	return notify.NewAlerter(notifiers, strings.TrimSuffix(conf.BaseURL, "/")), nil
+}
+
+// notifyRun posts the failed replies of the run and the replies it parked for approval.
+func notifyRun(ctx context.Context, s *shop.Shop, startedAt time.Time) {
+	runID := storage.WithdrawRunID(ctx)
+	attempts, err := store.Attempts().ListByRun(runID)
+	if err != nil {
+		slog.Error("list reply attempts of run error.", slog.Uint64("runId", runID), tools.ErrAttr(err))
+	}
+	summary := &notify.RunSummary{ShopID: s.ID, RunID: runID, Failures: make([]*storage.ReplyAttempt, 0)}
+	for _, attempt := range attempts {
+		if !attempt.Success {
+			summary.Failures = append(summary.Failures, attempt)
+		}
+	}
+	for _, pending := range s.ApprovalQueue.List(review.ApprovalPending) {
+		summary.PendingApprovals++
+		if !pending.CreatedAt.Before(startedAt) {
+			summary.NewApprovals++
+		}
+	}
+	if err = alerter.NotifyRun(ctx, summary); err != nil {
+		slog.Error("notify run error.", slog.String("shop", s.ID), tools.ErrAttr(err))
+	}
+}
+
+// sendDigest mails what the service did over the last day.
+func sendDigest(ctx context.Context) error {
+	until := time.Now()
+	since := until.Add(-digestPeriod)
+	runs, err := store.Runs().List(0)
+	if err != nil {
+		return errors.WithMessagef(err, "list runs error.")
+	}
+	records, err := store.Reviews().ListSince(since)
+	if err != nil {
+		return errors.WithMessagef(err, "list reviews since:%s error.", since)
+	}
+	reviews := make([]*xhsreq.Review, 0, len(records))
+	for _, record := range records {
+		reviews = append(reviews, record.Review)
+	}
+	attempts, err := store.Attempts().ListSince(since)
+	if err != nil {
+		return errors.WithMessagef(err, "list reply attempts since:%s error.", since)
+	}
+	pendingApprovals := 0
+	for _, s := range shops.List() {
+		pendingApprovals += len(s.ApprovalQueue.List(review.ApprovalPending))
+	}
+	digest := review.NewDigest(since, until, runs, reviews, attempts, pendingApprovals)
+	return emailNotifier.SendDigest(ctx, digest)
+}
+
+// withDigest runs handler, if any, and mails the digest at the digest spec.
+func withDigest(ctx context.Context, handler CronFunc) CronFunc {
+	return func() {
+		if handler != nil {
+			handler()
+		}
+		if err := sendDigest(ctx); err != nil {
+			slog.Error("send digest error.", tools.ErrAttr(err))
+		}
+	}
+}
@@ -1,22 +1,110 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
-	"github.com/davecgh/go-spew/spew"
+	"PulseCheck/internal/config"
+	"PulseCheck/internal/notify"
+	"PulseCheck/internal/secret"
+	"PulseCheck/internal/shop"
+	"PulseCheck/internal/storage"
+	"PulseCheck/internal/tools"
 )
 
 var (
-	authorization string
+	conf    *config.Config
+	secrets secret.Provider
+	shops   *shop.Registry
+	store   *storage.Store
+	// emailNotifier mails the digest and the alerts, nil if the email is disabled
+	emailNotifier *notify.EmailNotifier
+	// alerter posts the alerts to the webhooks, nil if none is configured
+	alerter *notify.Alerter
 )
 
-// auth=***** ./script.sh
+const (
+	defaultConfigPath = "./conf/config.yaml"
+)
+
+// auth=***** ./script.sh, or put the token in ./secrets/auth
 func init() {
-	auth, exists := os.LookupEnv("auth")
+	configPath, exists := os.LookupEnv("config")
 	if !exists {
-		log.Fatalf("can not get auth key.")
+		configPath = defaultConfigPath
+	}
+	c, err := config.Load(configPath)
+	if err != nil {
+		log.Fatalf("load config error:%+v", err)
+	}
+	conf = c
+	tools.RegisterSecret(conf.LLM.APIKey)
+	for _, webhook := range conf.Notify.Webhooks {
+		// the token of a robot is part of its url
+		tools.RegisterSecret(webhook.URL, webhook.Secret)
+	}
+	for _, shopConf := range conf.Shops {
+		tools.RegisterSecret(shopConf.LLM.APIKey)
+	}
+
+	secrets, err = newSecretProvider(&conf.Secrets)
+	if err != nil {
+		log.Fatalf("create secret provider error:%+v", err)
+	}
+
+	emailNotifier, err = newEmailNotifier(context.Background(), &conf.Email, secrets)
+	if err != nil {
+		log.Fatalf("create email notifier error:%+v", err)
+	}
+
+	alerter, err = newAlerter(&conf.Notify)
+	if err != nil {
+		log.Fatalf("create webhook alerter error:%+v", err)
+	}
+
+	shops, err = shop.NewRegistry(context.Background(), conf, secrets)
+	if err != nil {
+		log.Fatalf("create shop registry error:%+v", err)
+	}
+	for _, s := range shops.List() {
+		auth, err := s.Secrets.Get(context.Background(), secret.XHSToken)
+		if err != nil {
+			log.Fatalf("can not get auth key of shop:%s. error:%+v", s.ID, err)
+		}
+		log.Printf("get auth of shop:%s from secrets. auth=%s", s.ID, tools.Mask(auth))
+		log.Printf("reply generator of shop:%s backend:%s url:%s model:%s",
+			s.ID, s.Generator.Backend, s.Generator.URL, s.Generator.Model)
+		s.Session.OnExpired(alertSessionExpired)
+		if emailNotifier != nil && conf.Email.Alerts {
+			s.Session.OnExpired(emailNotifier.AlertSessionExpired)
+		}
+		if alerter != nil {
+			s.Session.OnExpired(alerter.AlertSessionExpired)
+		}
+		if s.Cron.DryRun {
+			log.Printf("cron job of shop:%s runs in dry-run mode, replies will not be posted.", s.ID)
+		}
+	}
+
+	store, err = storage.Open(conf.Storage.Store)
+	if err != nil {
+		log.Fatalf("open store error:%+v", err)
+	}
+}
+
+// newSecretProvider looks up the env first, then the secret files, then the keystore if configured.
+func newSecretProvider(conf *config.SecretsConfig) (secret.Provider, error) {
+	providers := []secret.Provider{secret.NewEnvProvider()}
+	if len(conf.Dir) != 0 {
+		providers = append(providers, secret.NewFileProvider(conf.Dir))
+	}
+	if len(conf.Keystore) != 0 {
+		keystore, err := secret.OpenKeystore(conf.Keystore, os.Getenv("keystore_passphrase"))
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, keystore)
 	}
-	log.Println(spew.Sprintf("get auth from env. auth=%s", auth))
-	authorization = auth
+	return secret.NewChain(providers...), nil
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/session"
+	"PulseCheck/internal/shop"
+	"PulseCheck/internal/tools"
+)
+
+type refreshRequest struct {
+	Token  string `json:"token"`
+	Cookie string `json:"cookie"`
+}
+
+// SessionHandler shows(GET) the session status of the shop, and refreshes(POST) it with a new
+// token and/or cookie, body: {"token":"","cookie":""}
+func SessionHandler(s *shop.Shop) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet:
+			writeJSON(writer, http.StatusOK, s.Session.Status())
+		case http.MethodPost:
+			body := &refreshRequest{}
+			if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+				writeError(writer, http.StatusBadRequest, errors.WithMessagef(err, "decode refresh request error."))
+				return
+			}
+			if err := s.Session.Refresh(request.Context(), body.Token, body.Cookie); err != nil {
+				writeError(writer, http.StatusBadRequest, err)
+				return
+			}
+			writeJSON(writer, http.StatusOK, s.Session.Status())
+		default:
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// alertSessionExpired tells the operator watching the running task how to bring the shop back.
+func alertSessionExpired(ctx context.Context, status *session.Status) {
+	slog.Error("shop session expired, refresh it by POST /session?shop=<id>.",
+		slog.String("shopId", status.ShopID), slog.String("reason", status.Reason))
+	tools.LogFromContext(ctx, "\n--店铺[%s]登录已失效, 请通过 POST /session?shop=%s 更新token或cookie-- 原因:%s",
+		status.ShopID, status.ShopID, status.Reason)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"PulseCheck/internal/shop"
+	"PulseCheck/internal/tools"
+)
+
+// cronHandlers schedules the shops sharing a cron spec together, the latest reviews of them are
+// replied concurrently. The digest is mailed at its own spec, after the replies if a group of shops
+// shares it.
+func cronHandlers(ctx context.Context, shops *shop.Registry) map[string]CronFunc {
+	handlers := map[string]CronFunc{}
+	for spec, group := range shops.GroupByCron() {
+		handlers[spec] = func() {
+			err := ReplyForLatestReview(ctx, group)
+			if nil != err {
+				slog.Error("check run error", slog.String("spec", spec), tools.ErrAttr(err))
+			}
+		}
+	}
+	if emailNotifier != nil && len(conf.Email.DigestSpec) != 0 {
+		handlers[conf.Email.DigestSpec] = withDigest(ctx, handlers[conf.Email.DigestSpec])
+	}
+	return handlers
+}
+
+// withShop serves the request by the handler of the shop given by ?shop=, the default shop is
+// used if it is not set.
+func withShop(shops *shop.Registry, newHandler func(s *shop.Shop) HttpFunc) HttpFunc {
+	handlers := map[string]HttpFunc{}
+	for _, s := range shops.List() {
+		handlers[s.ID] = newHandler(s)
+	}
+	return func(writer http.ResponseWriter, request *http.Request) {
+		s, err := shops.Get(request.URL.Query().Get("shop"))
+		if err != nil {
+			writeError(writer, http.StatusNotFound, err)
+			return
+		}
+		handlers[s.ID](writer, request)
+	}
+}
+
+type shopView struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Cron   string `json:"cron"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// ShopListHandler lists the shops served, the first one is the default.
+func ShopListHandler(shops *shop.Registry) HttpFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		views := make([]*shopView, 0)
+		for _, s := range shops.List() {
+			views = append(views, &shopView{Id: s.ID, Name: s.Name, Cron: s.Cron.Spec, DryRun: s.Cron.DryRun})
+		}
+		writeJSON(writer, http.StatusOK, views)
+	}
+}
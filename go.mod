@@ -3,6 +3,7 @@ module PulseCheck
 go 1.22
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/davecgh/go-spew v1.1.1
 	github.com/go-playground/validator/v10 v10.22.1
 	github.com/hashicorp/go-multierror v1.1.1
@@ -12,6 +13,10 @@ require (
 	github.com/spf13/cast v1.6.0
 	github.com/tidwall/gjson v1.18.0
 	github.com/tidwall/sjson v1.2.5
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/crypto v0.19.0
+	golang.org/x/time v0.5.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -23,7 +28,6 @@ require (
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
-	golang.org/x/crypto v0.19.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
 	golang.org/x/sys v0.17.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
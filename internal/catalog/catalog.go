@@ -0,0 +1,238 @@
+package catalog
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"PulseCheck/internal/tools"
+)
+
+var (
+	ErrUnknownItem = errors.New("unknown item")
+)
+
+type FAQ struct {
+	Question string `json:"question" yaml:"question" validate:"required"`
+	Answer   string `json:"answer" yaml:"answer" validate:"required"`
+}
+
+// Product is the knowledge of an item handed to the LLM when replying its reviews.
+type Product struct {
+	ItemID          string   `json:"item_id" yaml:"item_id" validate:"required"`
+	Type            string   `json:"type" yaml:"type" validate:"required"`
+	Introduction    string   `json:"introduction" yaml:"introduction"`
+	SellingPoints   []string `json:"selling_points,omitempty" yaml:"selling_points,omitempty"`
+	FAQ             []*FAQ   `json:"faq,omitempty" yaml:"faq,omitempty" validate:"dive"`
+	ForbiddenClaims []string `json:"forbidden_claims,omitempty" yaml:"forbidden_claims,omitempty"`
+	Tone            string   `json:"tone,omitempty" yaml:"tone,omitempty"`
+}
+
+// Fallback is used for the items not listed in the catalog. Introduction is
+// replaced by the sku name of the review if it is empty.
+type Fallback struct {
+	Enabled      bool   `json:"enabled" yaml:"enabled"`
+	Type         string `json:"type" yaml:"type"`
+	Introduction string `json:"introduction,omitempty" yaml:"introduction,omitempty"`
+	Tone         string `json:"tone,omitempty" yaml:"tone,omitempty"`
+}
+
+// File is the layout of the catalog file, both yaml and json are supported by the file extension.
+type File struct {
+	Fallback *Fallback  `json:"fallback,omitempty" yaml:"fallback,omitempty"`
+	Products []*Product `json:"products" yaml:"products" validate:"dive"`
+}
+
+type Catalog struct {
+	path     string
+	file     atomic.Pointer[File]
+	products atomic.Pointer[map[string]*Product]
+	// guards the read-modify-write of the catalog file
+	mu sync.Mutex
+}
+
+// NewCatalog loads the catalog from path, a missing file results in an empty
+// catalog which is created on the first modification.
+func NewCatalog(path string) (*Catalog, error) {
+	c := &Catalog{path: path}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (this *Catalog) Path() string {
+	return this.path
+}
+
+// Reload reads the catalog file again and replaces the products in memory.
+func (this *Catalog) Reload() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	file, err := this.read()
+	if err != nil {
+		return err
+	}
+	this.store(file)
+	slog.Info("product catalog loaded.", slog.String("path", this.path), slog.Int("products", len(file.Products)))
+	return nil
+}
+
+// Lookup returns the product of itemID, or the one built from the fallback
+// configuration with skuName as introduction. ErrUnknownItem is returned if
+// neither exists.
+func (this *Catalog) Lookup(itemID string, skuName string) (*Product, error) {
+	products := *this.products.Load()
+	if product, ok := products[itemID]; ok {
+		return product, nil
+	}
+	fallback := this.file.Load().Fallback
+	if fallback == nil || !fallback.Enabled {
+		return nil, errors.WithMessagef(ErrUnknownItem, "itemId:%s", itemID)
+	}
+	slog.Warn("item not found in catalog, fallback is used.", slog.String("itemId", itemID))
+	introduction := fallback.Introduction
+	if len(introduction) == 0 {
+		introduction = skuName
+	}
+	return &Product{
+		ItemID:       itemID,
+		Type:         fallback.Type,
+		Introduction: introduction,
+		Tone:         fallback.Tone,
+	}, nil
+}
+
+// List returns the products sorted by item id.
+func (this *Catalog) List() []*Product {
+	products := *this.products.Load()
+	list := make([]*Product, 0, len(products))
+	for _, product := range products {
+		list = append(list, product)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ItemID < list[j].ItemID
+	})
+	return list
+}
+
+func (this *Catalog) Fallback() *Fallback {
+	return this.file.Load().Fallback
+}
+
+// Upsert adds or replaces the product and writes the catalog back to the file.
+func (this *Catalog) Upsert(product *Product) error {
+	validate := validator.New()
+	if err := validate.Struct(product); err != nil {
+		return errors.WithMessagef(err, "validate product:%#v error.", product)
+	}
+	return this.modify(func(file *File) {
+		for i, p := range file.Products {
+			if p.ItemID == product.ItemID {
+				file.Products[i] = product
+				return
+			}
+		}
+		file.Products = append(file.Products, product)
+	})
+}
+
+// Delete removes the product of itemID and writes the catalog back to the file.
+func (this *Catalog) Delete(itemID string) error {
+	if _, ok := (*this.products.Load())[itemID]; !ok {
+		return errors.WithMessagef(ErrUnknownItem, "itemId:%s", itemID)
+	}
+	return this.modify(func(file *File) {
+		products := make([]*Product, 0, len(file.Products))
+		for _, p := range file.Products {
+			if p.ItemID != itemID {
+				products = append(products, p)
+			}
+		}
+		file.Products = products
+	})
+}
+
+// SetFallback replaces the fallback configuration and writes the catalog back to the file.
+func (this *Catalog) SetFallback(fallback *Fallback) error {
+	return this.modify(func(file *File) {
+		file.Fallback = fallback
+	})
+}
+
+func (this *Catalog) modify(fn func(file *File)) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	current := this.file.Load()
+	file := &File{
+		Fallback: current.Fallback,
+		Products: append([]*Product(nil), current.Products...),
+	}
+	fn(file)
+	if err := this.write(file); err != nil {
+		return err
+	}
+	this.store(file)
+	return nil
+}
+
+func (this *Catalog) store(file *File) {
+	products := make(map[string]*Product, len(file.Products))
+	for _, product := range file.Products {
+		products[product.ItemID] = product
+	}
+	this.file.Store(file)
+	this.products.Store(&products)
+}
+
+func (this *Catalog) isJSON() bool {
+	return strings.EqualFold(filepath.Ext(this.path), ".json")
+}
+
+func (this *Catalog) read() (*File, error) {
+	file := &File{Products: make([]*Product, 0)}
+	b, err := os.ReadFile(this.path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Warn("product catalog file not exists, start with an empty catalog.", slog.String("path", this.path))
+		return file, nil
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read catalog file:%s error.", this.path)
+	}
+	if this.isJSON() {
+		err = json.Unmarshal(b, file)
+	} else {
+		err = yaml.Unmarshal(b, file)
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "unmarshal catalog file:%s error.", this.path)
+	}
+	validate := validator.New()
+	if err = validate.Struct(file); err != nil {
+		return nil, errors.WithMessagef(err, "validate catalog file:%s error.", this.path)
+	}
+	return file, nil
+}
+
+func (this *Catalog) write(file *File) error {
+	var b []byte
+	var err error
+	if this.isJSON() {
+		b, err = json.MarshalIndent(file, "", "  ")
+	} else {
+		b, err = yaml.Marshal(file)
+	}
+	if err != nil {
+		return errors.WithMessagef(err, "marshal catalog error.")
+	}
+	return tools.WriteFileAtomic(this.path, b, 0o644)
+}
@@ -0,0 +1,50 @@
+package catalog
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestCatalog_Lookup(t *testing.T) {
+	for _, name := range []string{"catalog.yaml", "catalog.json"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			c, err := NewCatalog(path)
+			if err != nil {
+				t.Fatalf("NewCatalog() error = %v", err)
+			}
+			if _, err = c.Lookup("unknown", "sku"); !errors.Is(err, ErrUnknownItem) {
+				t.Errorf("Lookup() error = %v, want %v", err, ErrUnknownItem)
+			}
+			product := &Product{ItemID: "item-1", Type: "裤夹", Introduction: "省空间", Tone: "活泼"}
+			if err = c.Upsert(product); err != nil {
+				t.Fatalf("Upsert() error = %v", err)
+			}
+			if err = c.SetFallback(&Fallback{Enabled: true, Type: "商品"}); err != nil {
+				t.Fatalf("SetFallback() error = %v", err)
+			}
+
+			// a new catalog reads what the previous one persisted
+			reloaded, err := NewCatalog(path)
+			if err != nil {
+				t.Fatalf("NewCatalog() error = %v", err)
+			}
+			got, err := reloaded.Lookup("item-1", "sku")
+			if err != nil || got.Type != "裤夹" || got.Tone != "活泼" {
+				t.Errorf("Lookup() got = %#v, error = %v", got, err)
+			}
+			got, err = reloaded.Lookup("unknown", "晾衣架")
+			if err != nil || got.Type != "商品" || got.Introduction != "晾衣架" {
+				t.Errorf("Lookup() fallback got = %#v, error = %v", got, err)
+			}
+			if err = reloaded.Delete("item-1"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if len(reloaded.List()) != 0 {
+				t.Errorf("List() got = %v, want empty", reloaded.List())
+			}
+		})
+	}
+}
@@ -0,0 +1,535 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v3"
+
+	"PulseCheck/internal/tools"
+)
+
+const (
+	// envTag names the environment variable overriding the field
+	envTag = "env"
+	// envListSeparator separates the elements of a list given by an environment variable
+	envListSeparator = ","
+)
+
+// Config is the settings of the whole service. It is loaded from a yaml or toml file,
+// chosen by the file extension, and every field tagged with env can be overridden by
+// the environment variable of that name.
+type Config struct {
+	Server ServerConfig `yaml:"server" toml:"server"`
+	Pprof  PprofConfig  `yaml:"pprof" toml:"pprof"`
+	Cron   CronConfig   `yaml:"cron" toml:"cron"`
+	Review ReviewConfig `yaml:"review" toml:"review"`
+	LLM    LLMConfig    `yaml:"llm" toml:"llm"`
+	// Classifier tags the reviews before their replies are generated
+	Classifier ClassifierConfig `yaml:"classifier" toml:"classifier"`
+	// Guardrail checks the generated replies before they are posted
+	Guardrail GuardrailConfig `yaml:"guardrail" toml:"guardrail"`
+	// Escalation takes the negative reviews off the automatic reply
+	Escalation EscalationConfig `yaml:"escalation" toml:"escalation"`
+	// Appeal flags the abusive and spam reviews to be appealed instead of replied
+	Appeal AppealConfig `yaml:"appeal" toml:"appeal"`
+	// Email mails the daily digest and the alerts to the operators
+	Email EmailConfig `yaml:"email" toml:"email"`
+	// Notify posts the alerts to the group chats of the operators
+	Notify  NotifyConfig  `yaml:"notify" toml:"notify"`
+	Storage StorageConfig `yaml:"storage" toml:"storage"`
+	Secrets SecretsConfig `yaml:"secrets" toml:"secrets"`
+	HTTP    HTTPConfig    `yaml:"http" toml:"http"`
+	// Xiaohongshu locates the seller api, it is only changed to run against a xhsfake server
+	Xiaohongshu XiaohongshuConfig `yaml:"xiaohongshu" toml:"xiaohongshu"`
+	// Shops served by the process, a single shop named default is derived from the settings
+	// above if it is empty.
+	Shops []*ShopConfig `yaml:"shops" toml:"shops" validate:"unique=ID,dive"`
+}
+
+type ServerConfig struct {
+	Port int `yaml:"port" toml:"port" env:"server_port" validate:"min=1,max=65535"`
+}
+
+type PprofConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"pprof_enabled"`
+	Port    int  `yaml:"port" toml:"port" env:"pprof_port" validate:"min=1,max=65535"`
+}
+
+type CronConfig struct {
+	// Spec the schedule of the latest review job, see robfig/cron for the format
+	Spec string `yaml:"spec" toml:"spec" env:"cron_spec" validate:"required"`
+	// DryRun only generates and prints the replies of the cron job without posting them
+	DryRun bool `yaml:"dry_run" toml:"dry_run" env:"cron_dryrun"`
+	// Lookback the reviews created within it are replied by the cron job
+	Lookback time.Duration `yaml:"lookback" toml:"lookback" env:"cron_lookback" validate:"gt=0"`
+}
+
+type ReviewConfig struct {
+	PageSize              int   `yaml:"page_size" toml:"page_size" env:"review_page_size" validate:"min=1"`
+	ContentTypeList       []int `yaml:"content_types" toml:"content_types" env:"review_content_types"`
+	ReviewReplyStatusList []int `yaml:"reply_status" toml:"reply_status" env:"review_reply_status"`
+	// a random delay between ReplyDelayMin and ReplyDelayMax is waited between two replies, so that
+	// the replies are not posted in a burst
+	ReplyDelayMin time.Duration `yaml:"reply_delay_min" toml:"reply_delay_min" env:"review_reply_delay_min" validate:"min=0"`
+	ReplyDelayMax time.Duration `yaml:"reply_delay_max" toml:"reply_delay_max" env:"review_reply_delay_max" validate:"gtefield=ReplyDelayMin"`
+}
+
+type LLMConfig struct {
+	Backend string `yaml:"backend" toml:"backend" env:"llm_backend" validate:"required,oneof=dify_chat dify_workflow openai ollama"`
+	// URL the full endpoint url, the default one of the backend is used if empty
+	URL          string `yaml:"url" toml:"url" env:"llm_url" validate:"omitempty,url"`
+	APIKey       string `yaml:"api_key" toml:"api_key" env:"llm_key"`
+	Model        string `yaml:"model" toml:"model" env:"llm_model"`
+	SystemPrompt string `yaml:"system_prompt" toml:"system_prompt" env:"llm_prompt"`
+	OutputKey    string `yaml:"output_key" toml:"output_key" env:"llm_output"`
+	// ResponseMode blocking or streaming, of the dify chat only
+	ResponseMode string        `yaml:"response_mode" toml:"response_mode" env:"llm_response_mode" validate:"omitempty,oneof=blocking streaming"`
+	Timeout      time.Duration `yaml:"timeout" toml:"timeout" env:"llm_timeout"`
+}
+
+// ClassifierConfig is the LLM classifying the reviews, only the keyword rules are used if Backend
+// is empty. The llm_key is used if APIKey is empty.
+type ClassifierConfig struct {
+	Backend      string        `yaml:"backend" toml:"backend" env:"classifier_backend" validate:"omitempty,oneof=openai ollama"`
+	URL          string        `yaml:"url" toml:"url" env:"classifier_url" validate:"omitempty,url"`
+	APIKey       string        `yaml:"api_key" toml:"api_key" env:"classifier_key"`
+	Model        string        `yaml:"model" toml:"model" env:"classifier_model"`
+	SystemPrompt string        `yaml:"system_prompt" toml:"system_prompt" env:"classifier_prompt"`
+	Timeout      time.Duration `yaml:"timeout" toml:"timeout" env:"classifier_timeout"`
+}
+
+// GuardrailConfig rejects the replies out of the length limits or containing a banned word, the
+// words of review.DefaultBannedWords are always banned. A rejected reply is generated again at
+// most Regenerations times before it waits for approval.
+type GuardrailConfig struct {
+	MinLength     int      `yaml:"min_length" toml:"min_length" env:"guardrail_min_length" validate:"min=0"`
+	MaxLength     int      `yaml:"max_length" toml:"max_length" env:"guardrail_max_length" validate:"gtefield=MinLength"`
+	BannedWords   []string `yaml:"banned_words" toml:"banned_words" env:"guardrail_banned_words"`
+	Regenerations int      `yaml:"regenerations" toml:"regenerations" env:"guardrail_regenerations" validate:"min=0"`
+}
+
+// EscalationConfig parks the negative, urgent or low scored reviews in the approval queue with a
+// draft reply instead of replying them automatically. An after-sales follow-up is opened for each
+// of them if FollowUp is set.
+type EscalationConfig struct {
+	Enabled     bool `yaml:"enabled" toml:"enabled" env:"escalation_enabled"`
+	MaxSkuScore int  `yaml:"max_sku_score" toml:"max_sku_score" env:"escalation_max_sku_score" validate:"min=0,max=5"`
+	FollowUp    bool `yaml:"follow_up" toml:"follow_up" env:"escalation_follow_up"`
+}
+
+// AppealConfig flags the abusive, spam and competitor reviews as appeal candidates, they wait in
+// the appeal queue for a human to file the appeal in the seller center.
+type AppealConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"appeal_enabled"`
+	// Keywords flag more reviews on top of the default ones, by reason: abusive, spam or competitor
+	Keywords map[string][]string `yaml:"keywords" toml:"keywords" validate:"dive,keys,oneof=abusive spam competitor,endkeys"`
+}
+
+// EmailConfig mails the daily digest at DigestSpec, and the alerts of the escalated reviews and the
+// expired sessions if Alerts is set. The password is the secret smtp_password, the mails are sent
+// without AUTH if it is missing.
+type EmailConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled" env:"email_enabled"`
+	Host    string `yaml:"host" toml:"host" env:"email_host" validate:"required_if=Enabled true"`
+	Port    int    `yaml:"port" toml:"port" env:"email_port" validate:"min=1,max=65535"`
+	// Domain greets the server by EHLO, localhost if empty
+	Domain string   `yaml:"domain" toml:"domain" env:"email_domain"`
+	From   string   `yaml:"from" toml:"from" env:"email_from" validate:"required_if=Enabled true,omitempty,email"`
+	To     []string `yaml:"to" toml:"to" env:"email_to" validate:"required_if=Enabled true,dive,email"`
+	// TLS starttls, tls for the implicit TLS of port 465, or none
+	TLS        string        `yaml:"tls" toml:"tls" env:"email_tls" validate:"oneof=starttls tls none"`
+	DigestSpec string        `yaml:"digest_spec" toml:"digest_spec" env:"email_digest_spec"`
+	Alerts     bool          `yaml:"alerts" toml:"alerts" env:"email_alerts"`
+	Timeout    time.Duration `yaml:"timeout" toml:"timeout" env:"email_timeout" validate:"min=0"`
+}
+
+// NotifyConfig posts the escalated reviews, the failed replies and new pending approvals of every
+// run and the expired sessions to the webhooks. The links to the approval queue are made of BaseURL,
+// no link is posted if it is empty.
+type NotifyConfig struct {
+	BaseURL  string           `yaml:"base_url" toml:"base_url" env:"notify_base_url" validate:"omitempty,url"`
+	Webhooks []*WebhookConfig `yaml:"webhooks" toml:"webhooks" validate:"dive"`
+}
+
+type WebhookConfig struct {
+	// Kind wecom, dingtalk, feishu, slack or json
+	Kind string `yaml:"kind" toml:"kind" validate:"oneof=wecom dingtalk feishu slack json"`
+	URL  string `yaml:"url" toml:"url" validate:"required,url"`
+	// Secret signs the messages of dingtalk, feishu and json, nothing is signed if empty
+	Secret string `yaml:"secret" toml:"secret"`
+}
+
+type StorageConfig struct {
+	Catalog       string `yaml:"catalog" toml:"catalog" env:"catalog" validate:"required"`
+	ApprovalQueue string `yaml:"approval_queue" toml:"approval_queue" env:"approval_queue" validate:"required"`
+	FollowUps     string `yaml:"follow_ups" toml:"follow_ups" env:"follow_ups" validate:"required"`
+	Appeals       string `yaml:"appeals" toml:"appeals" env:"appeals" validate:"required"`
+	Store         string `yaml:"store" toml:"store" env:"store" validate:"required"`
+}
+
+// SecretsConfig locates the secrets, the environment is always looked up first, then the files
+// under Dir, then the keystore unlocked by the env keystore_passphrase.
+type SecretsConfig struct {
+	Dir      string `yaml:"dir" toml:"dir" env:"secrets_dir"`
+	Keystore string `yaml:"keystore" toml:"keystore" env:"secrets_keystore"`
+}
+
+type XiaohongshuConfig struct {
+	BaseURL string `yaml:"base_url" toml:"base_url" env:"xhs_base_url" validate:"required,url"`
+}
+
+// HTTPConfig is how the requests to xiaohongshu and the llm are retried. The replies to
+// xiaohongshu are never retried, a reply posted twice can not be taken back.
+type HTTPConfig struct {
+	Retries     int           `yaml:"retries" toml:"retries" env:"http_retries" validate:"min=0"`
+	BackoffBase time.Duration `yaml:"backoff_base" toml:"backoff_base" env:"http_backoff_base" validate:"gt=0"`
+	BackoffMax  time.Duration `yaml:"backoff_max" toml:"backoff_max" env:"http_backoff_max" validate:"gtefield=BackoffBase"`
+	RetryStatus []int         `yaml:"retry_status" toml:"retry_status" env:"http_retry_status"`
+	// RateLimits throttles the requests per host, the limits are shared by all the shops
+	RateLimits map[string]RateConfig `yaml:"rate_limits" toml:"rate_limits" validate:"dive"`
+	// ShopRateLimit throttles the requests to xiaohongshu of every shop on its own
+	ShopRateLimit RateConfig `yaml:"shop_rate_limit" toml:"shop_rate_limit" env:"http_shop"`
+}
+
+// RateConfig is a token bucket refilled by Rate tokens per second and holding at most Burst
+// tokens, a zero Rate means no limit. The env names are prefixed by the env of the field holding it.
+type RateConfig struct {
+	Rate  float64 `yaml:"rate" toml:"rate" env:"rate" validate:"min=0"`
+	Burst int     `yaml:"burst" toml:"burst" env:"burst" validate:"min=0"`
+}
+
+func (this RateConfig) Limit() tools.Limit {
+	return tools.Limit{Rate: this.Rate, Burst: this.Burst}
+}
+
+// HostLimits returns the limits of RateLimits by host.
+func (this *HTTPConfig) HostLimits() map[string]tools.Limit {
+	limits := make(map[string]tools.Limit, len(this.RateLimits))
+	for host, limit := range this.RateLimits {
+		limits[host] = limit.Limit()
+	}
+	return limits
+}
+
+// Options returns the tools.Option retrying the requests as configured.
+func (this *HTTPConfig) Options() []tools.Option {
+	return []tools.Option{
+		tools.WithRetry(this.Retries),
+		tools.WithBackoff(this.BackoffBase, this.BackoffMax),
+		tools.WithRetryOnStatus(this.RetryStatus...),
+	}
+}
+
+// ShopConfig is the settings of a shop, the empty fields are taken from the global ones.
+type ShopConfig struct {
+	ID   string `yaml:"id" toml:"id" validate:"required,alphanum"`
+	Name string `yaml:"name" toml:"name"`
+	// SecretPrefix is prepended to the secret names of the shop, e.g. shop2_ reads shop2_auth
+	SecretPrefix  string `yaml:"secret_prefix" toml:"secret_prefix"`
+	Catalog       string `yaml:"catalog" toml:"catalog"`
+	ApprovalQueue string `yaml:"approval_queue" toml:"approval_queue"`
+	FollowUps     string `yaml:"follow_ups" toml:"follow_ups"`
+	Appeals       string `yaml:"appeals" toml:"appeals"`
+	// LLM and Cron are validated after being merged with the global ones
+	LLM    LLMConfig    `yaml:"llm" toml:"llm" validate:"-"`
+	Cron   CronConfig   `yaml:"cron" toml:"cron" validate:"-"`
+	Policy PolicyConfig `yaml:"policy" toml:"policy"`
+	// RateLimit throttles the requests to xiaohongshu of the shop, http.shop_rate_limit if empty
+	RateLimit RateConfig `yaml:"rate_limit" toml:"rate_limit"`
+}
+
+// PolicyConfig decides which replies wait for approval by the sku score of the review.
+type PolicyConfig struct {
+	AutoApproveMinSkuScore uint8 `yaml:"auto_approve_min_sku_score" toml:"auto_approve_min_sku_score" validate:"max=5"`
+	MandatoryMaxSkuScore   uint8 `yaml:"mandatory_max_sku_score" toml:"mandatory_max_sku_score" validate:"max=5"`
+}
+
+// Default returns the settings used when neither the file nor the environment sets them.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{Port: 1903},
+		Pprof:  PprofConfig{Enabled: true, Port: 8888},
+		Cron: CronConfig{
+			// execute every day at midnight
+			Spec:     "0 0 * * ?",
+			Lookback: 24 * time.Hour,
+		},
+		Review: ReviewConfig{
+			PageSize:              20,
+			ContentTypeList:       []int{2},
+			ReviewReplyStatusList: []int{2},
+			ReplyDelayMin:         5 * time.Second,
+			ReplyDelayMax:         15 * time.Second,
+		},
+		LLM:        LLMConfig{Backend: "dify_chat"},
+		Classifier: ClassifierConfig{Timeout: 30 * time.Second},
+		Guardrail: GuardrailConfig{
+			MinLength:     2,
+			MaxLength:     500,
+			Regenerations: 1,
+		},
+		Escalation: EscalationConfig{Enabled: true, MaxSkuScore: 2},
+		Email: EmailConfig{
+			Port: 587,
+			TLS:  "starttls",
+			// mail the digest every day at 9 am
+			DigestSpec: "0 9 * * ?",
+			Alerts:     true,
+			Timeout:    30 * time.Second,
+		},
+		Storage: StorageConfig{
+			Catalog:       "./conf/catalog.yaml",
+			ApprovalQueue: "./data/approval.json",
+			FollowUps:     "./data/followups.json",
+			Appeals:       "./data/appeals.json",
+			Store:         "./data/pulsecheck.db",
+		},
+		Secrets:     SecretsConfig{Dir: "./secrets"},
+		Xiaohongshu: XiaohongshuConfig{BaseURL: "https://ark.xiaohongshu.com"},
+		HTTP: HTTPConfig{
+			Retries:     3,
+			BackoffBase: 500 * time.Millisecond,
+			BackoffMax:  30 * time.Second,
+			RetryStatus: slices.Clone(tools.DefaultRetryOnStatus),
+			RateLimits: map[string]RateConfig{
+				"ark.xiaohongshu.com": {Rate: 2, Burst: 4},
+			},
+			ShopRateLimit: RateConfig{Rate: 1, Burst: 2},
+		},
+	}
+}
+
+// Load reads the settings from path on top of the defaults, a missing file leaves the
+// defaults untouched. The environment overrides are applied before validation.
+func Load(path string) (*Config, error) {
+	conf := Default()
+	if err := conf.read(path); err != nil {
+		return nil, err
+	}
+	if err := conf.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	validate := validator.New()
+	if err := validate.Struct(conf); err != nil {
+		return nil, errors.WithMessagef(err, "validate config:%s error.", path)
+	}
+	for _, shop := range conf.ShopList() {
+		for _, v := range []any{&shop.LLM, &shop.Cron} {
+			if err := validate.Struct(v); err != nil {
+				return nil, errors.WithMessagef(err, "validate config:%s of shop:%s error.", path, shop.ID)
+			}
+		}
+	}
+	return conf, nil
+}
+
+const (
+	DefaultShopID = "default"
+)
+
+// ShopList returns the shops with their empty fields filled by the global settings.
+func (this *Config) ShopList() []*ShopConfig {
+	if len(this.Shops) == 0 {
+		return []*ShopConfig{this.resolveShop(&ShopConfig{ID: DefaultShopID})}
+	}
+	shops := make([]*ShopConfig, 0, len(this.Shops))
+	for _, shop := range this.Shops {
+		shops = append(shops, this.resolveShop(shop))
+	}
+	return shops
+}
+
+func (this *Config) resolveShop(shop *ShopConfig) *ShopConfig {
+	resolved := *shop
+	if len(resolved.Catalog) == 0 {
+		resolved.Catalog = this.Storage.Catalog
+	}
+	// every shop has queues of its own, the replies are posted with the token of the shop
+	if len(resolved.ApprovalQueue) == 0 {
+		resolved.ApprovalQueue = shopFile(this.Storage.ApprovalQueue, shop.ID)
+	}
+	if len(resolved.FollowUps) == 0 {
+		resolved.FollowUps = shopFile(this.Storage.FollowUps, shop.ID)
+	}
+	if len(resolved.Appeals) == 0 {
+		resolved.Appeals = shopFile(this.Storage.Appeals, shop.ID)
+	}
+	resolved.LLM = this.LLM.merge(&shop.LLM)
+	if len(resolved.Cron.Spec) == 0 {
+		resolved.Cron.Spec = this.Cron.Spec
+	}
+	if resolved.Cron.Lookback <= 0 {
+		resolved.Cron.Lookback = this.Cron.Lookback
+	}
+	resolved.Cron.DryRun = this.Cron.DryRun || shop.Cron.DryRun
+	if resolved.RateLimit == (RateConfig{}) {
+		resolved.RateLimit = this.HTTP.ShopRateLimit
+	}
+	if resolved.Policy == (PolicyConfig{}) {
+		resolved.Policy = PolicyConfig{AutoApproveMinSkuScore: 4, MandatoryMaxSkuScore: 3}
+	}
+	return &resolved
+}
+
+// shopFile suffixes the file name of path with the shop id, the default shop keeps path.
+func shopFile(path string, shopID string) string {
+	if shopID == DefaultShopID {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + shopID + ext
+}
+
+// merge returns a copy of the config with the non-empty fields of override.
+func (this LLMConfig) merge(override *LLMConfig) LLMConfig {
+	merged := this
+	if len(override.Backend) != 0 {
+		merged.Backend = override.Backend
+	}
+	if len(override.URL) != 0 {
+		merged.URL = override.URL
+	}
+	if len(override.APIKey) != 0 {
+		merged.APIKey = override.APIKey
+	}
+	if len(override.Model) != 0 {
+		merged.Model = override.Model
+	}
+	if len(override.SystemPrompt) != 0 {
+		merged.SystemPrompt = override.SystemPrompt
+	}
+	if len(override.OutputKey) != 0 {
+		merged.OutputKey = override.OutputKey
+	}
+	if len(override.ResponseMode) != 0 {
+		merged.ResponseMode = override.ResponseMode
+	}
+	if override.Timeout > 0 {
+		merged.Timeout = override.Timeout
+	}
+	return merged
+}
+
+func (this *Config) read(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Warn("config file not found, defaults are used.", slog.String("path", path))
+		return nil
+	}
+	if err != nil {
+		return errors.WithMessagef(err, "read config:%s error.", path)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, this)
+	case ".toml":
+		err = toml.Unmarshal(b, this)
+	default:
+		return errors.Errorf("unsupported config format:%s", path)
+	}
+	return errors.WithMessagef(err, "unmarshal config:%s error.", path)
+}
+
+// applyEnv overrides the fields tagged with env by the variables found by lookup. The env of a
+// struct field prefixes the ones of its fields, e.g. http_shop + rate is http_shop_rate, so that a
+// struct type can be reused by several fields.
+func (this *Config) applyEnv(lookup func(key string) (string, bool)) error {
+	return applyEnv(reflect.ValueOf(this).Elem(), "", lookup)
+}
+
+func applyEnv(v reflect.Value, prefix string, lookup func(key string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		key, ok := t.Field(i).Tag.Lookup(envTag)
+		if ok {
+			key = prefix + key
+		}
+		if field.Kind() == reflect.Struct {
+			fieldPrefix := prefix
+			if ok {
+				fieldPrefix = key + "_"
+			}
+			if err := applyEnv(field, fieldPrefix, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+		value, exists := lookup(key)
+		if !exists {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return errors.WithMessagef(err, "set config from env:%s value:%s error.", key, value)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(value)
+	case bool:
+		b, err := cast.ToBoolE(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case int:
+		n, err := cast.ToIntE(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case float64:
+		f, err := cast.ToFloat64E(value)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case []int:
+		list := make([]int, 0)
+		for _, s := range strings.Split(value, envListSeparator) {
+			if s = strings.TrimSpace(s); len(s) == 0 {
+				continue
+			}
+			n, err := cast.ToIntE(s)
+			if err != nil {
+				return err
+			}
+			list = append(list, n)
+		}
+		field.Set(reflect.ValueOf(list))
+	case []string:
+		list := make([]string, 0)
+		for _, s := range strings.Split(value, envListSeparator) {
+			if s = strings.TrimSpace(s); len(s) != 0 {
+				list = append(list, s)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		return errors.Errorf("unsupported config field type:%s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	yamlContent := "server:\n  port: 2000\ncron:\n  lookback: 48h\nreview:\n  content_types: [1, 2]\n"
+	if err := os.WriteFile(yamlPath, []byte(yamlContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tomlPath := filepath.Join(dir, "config.toml")
+	tomlContent := "[server]\nport = 2001\n[cron]\nlookback = \"12h\"\n[llm]\nbackend = \"ollama\"\n"
+	if err := os.WriteFile(tomlPath, []byte(tomlContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		env     map[string]string
+		check   func(conf *Config) bool
+		wantErr bool
+	}{
+		{
+			name:  "missing file",
+			path:  filepath.Join(dir, "missing.yaml"),
+			check: func(conf *Config) bool { return reflect.DeepEqual(conf, Default()) },
+		},
+		{
+			name: "yaml",
+			path: yamlPath,
+			check: func(conf *Config) bool {
+				return conf.Server.Port == 2000 && conf.Cron.Lookback == 48*time.Hour &&
+					reflect.DeepEqual(conf.Review.ContentTypeList, []int{1, 2}) && conf.Pprof.Port == 8888
+			},
+		},
+		{
+			name: "toml",
+			path: tomlPath,
+			check: func(conf *Config) bool {
+				return conf.Server.Port == 2001 && conf.Cron.Lookback == 12*time.Hour && conf.LLM.Backend == "ollama"
+			},
+		},
+		{
+			name: "env overrides file",
+			path: yamlPath,
+			env: map[string]string{"server_port": "3000", "cron_dryrun": "true", "review_reply_status": "1, 3", "llm_timeout": "30s",
+				"http_shop_rate": "0.5", "rate": "9", "burst": "9"},
+			check: func(conf *Config) bool {
+				// the rate limit is only read from the env prefixed by http_shop
+				return conf.Server.Port == 3000 && conf.Cron.DryRun && conf.LLM.Timeout == 30*time.Second &&
+					reflect.DeepEqual(conf.Review.ReviewReplyStatusList, []int{1, 3}) &&
+					conf.HTTP.ShopRateLimit == RateConfig{Rate: 0.5, Burst: 2}
+			},
+		},
+		{
+			name:    "invalid env value",
+			path:    yamlPath,
+			env:     map[string]string{"server_port": "port"},
+			wantErr: true,
+		},
+		{
+			name:    "validation failed",
+			path:    yamlPath,
+			env:     map[string]string{"llm_backend": "unknown"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			got, err := Load(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.check != nil && !tt.check(got) {
+				t.Errorf("Load() got = %#v", got)
+			}
+		})
+	}
+}
+
+func TestConfig_ShopList(t *testing.T) {
+	conf := Default()
+	if got := conf.ShopList(); len(got) != 1 || got[0].ID != DefaultShopID || got[0].ApprovalQueue != conf.Storage.ApprovalQueue {
+		t.Errorf("ShopList() got = %#v, want the default shop", got[0])
+	}
+
+	conf.Shops = []*ShopConfig{
+		{ID: "main"},
+		{
+			ID:      "second",
+			Catalog: "./conf/second.yaml",
+			LLM:     LLMConfig{Backend: "ollama", Model: "qwen2"},
+			Cron:    CronConfig{Spec: "0 12 * * ?", DryRun: true},
+			Policy:  PolicyConfig{AutoApproveMinSkuScore: 5, MandatoryMaxSkuScore: 2},
+		},
+	}
+	got := conf.ShopList()
+	main, second := got[0], got[1]
+	if main.Catalog != conf.Storage.Catalog || main.ApprovalQueue != "./data/approval-main.json" ||
+		main.FollowUps != "./data/followups-main.json" || main.Appeals != "./data/appeals-main.json" || main.LLM != conf.LLM || main.Cron != conf.Cron || main.Policy.AutoApproveMinSkuScore != 4 {
+		t.Errorf("ShopList() got = %#v", main)
+	}
+	if second.Catalog != "./conf/second.yaml" || second.LLM.Backend != "ollama" || second.LLM.Model != "qwen2" ||
+		second.Cron.Spec != "0 12 * * ?" || !second.Cron.DryRun || second.Cron.Lookback != conf.Cron.Lookback ||
+		second.Policy.AutoApproveMinSkuScore != 5 {
+		t.Errorf("ShopList() got = %#v", second)
+	}
+	if len(conf.Shops[1].LLM.SystemPrompt) != 0 || conf.Shops[1].Cron.Lookback != 0 {
+		t.Errorf("ShopList() modified the configured shop %#v", conf.Shops[1])
+	}
+}
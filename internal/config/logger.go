@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+
+	"PulseCheck/internal/tools"
 )
 
 var once sync.Once
@@ -37,6 +39,13 @@ func InitLogger() {
 					a.Value = slog.StringValue(t.Format(time.DateTime))
 					return a
 				}
+				// hide the secrets wherever they are logged
+				if kind := a.Value.Kind(); kind == slog.KindString || kind == slog.KindAny {
+					s := a.Value.String()
+					if redacted := tools.Redact(s); redacted != s {
+						a.Value = slog.StringValue(redacted)
+					}
+				}
 				return a
 			},
 			AddSource: true,
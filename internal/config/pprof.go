@@ -8,13 +8,9 @@ import (
 	"strconv"
 )
 
-const (
-	pprofPort = 8888
-)
-
-func StartPprof(ctx context.Context) {
+func StartPprof(ctx context.Context, port int) {
 	go func() {
-		log.Println(http.ListenAndServe(":"+strconv.Itoa(pprofPort), nil))
+		log.Println(http.ListenAndServe(":"+strconv.Itoa(port), nil))
 	}()
-	log.Printf("pprof server listening at :%d", pprofPort)
+	log.Printf("pprof server listening at :%d", port)
 }
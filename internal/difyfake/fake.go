@@ -0,0 +1,269 @@
+// Package difyfake is an in-process stand-in of the chat-messages api of dify, answering by a
+// script or deterministically, so that the reply generation can be tested without api.dify.ai.
+package difyfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"PulseCheck/internal/tools"
+)
+
+const (
+	ChatMessagesPath = "/v1/chat-messages"
+
+	ResponseModeBlocking  = "blocking"
+	ResponseModeStreaming = "streaming"
+)
+
+var (
+	FaultUnauthorized = Fault{StatusCode: http.StatusUnauthorized, Code: "unauthorized", Message: "Access token is invalid"}
+	FaultQuota        = Fault{StatusCode: http.StatusBadRequest, Code: "provider_quota_exceeded", Message: "Your quota for Dify Hosted Model Provider has been exhausted."}
+	FaultUnavailable  = Fault{StatusCode: http.StatusServiceUnavailable, Code: "internal_server_error", Message: "service unavailable"}
+	// FaultStreamError fails a streaming answer by an error event after the first chunk
+	FaultStreamError = Fault{InStream: true, Code: "completion_request_error", Message: "model is overloaded"}
+)
+
+// Fault is answered instead of the scripted answer.
+type Fault struct {
+	StatusCode int
+	Code       string
+	Message    string
+	// InStream sends an error event after the first chunk of a streaming answer, the status stays 200
+	InStream bool
+}
+
+// Request is a chat-messages request received by the fake.
+type Request struct {
+	Query        string `json:"query"`
+	ResponseMode string `json:"response_mode"`
+	User         string `json:"user"`
+	APIKey       string `json:"-"`
+}
+
+// AnswerFunc answers the query once the script is used up.
+type AnswerFunc func(query string) string
+
+// Fake answers the chat-messages requests by the scripted answers in order, then by the AnswerFunc.
+// It is an http.Handler, Start serves it by an httptest.Server.
+type Fake struct {
+	script   []string
+	answer   AnswerFunc
+	faults   []Fault
+	requests []*Request
+	// apiKey must be the bearer of every request if set
+	apiKey  string
+	latency time.Duration
+	// chunkSize the runes of an answer sent by one message event in streaming mode
+	chunkSize int
+	mu        sync.Mutex
+}
+
+func New() *Fake {
+	return &Fake{answer: EchoAnswer, chunkSize: 4}
+}
+
+// Start serves the fake on a local port, the server must be closed by the caller. The endpoint
+// is server.URL + ChatMessagesPath.
+func (this *Fake) Start() *httptest.Server {
+	return httptest.NewServer(this)
+}
+
+// Script queues answers, each one answers a request.
+func (this *Fake) Script(answers ...string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.script = append(this.script, answers...)
+}
+
+func (this *Fake) SetAnswerFunc(answer AnswerFunc) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.answer = answer
+}
+
+// SetAPIKey requires the requests to carry the key, any key is accepted if empty.
+func (this *Fake) SetAPIKey(apiKey string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.apiKey = apiKey
+}
+
+// SetLatency delays every answer, a streaming answer is delayed before each chunk.
+func (this *Fake) SetLatency(latency time.Duration) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.latency = latency
+}
+
+// Inject answers the next requests by the faults in order.
+func (this *Fake) Inject(faults ...Fault) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.faults = append(this.faults, faults...)
+}
+
+// Requests returns the requests received, the failed ones included.
+func (this *Fake) Requests() []*Request {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return append([]*Request(nil), this.requests...)
+}
+
+// EchoAnswer is the default AnswerFunc, a reply naming the item type and the review of the query,
+// so that the answer tells which prompt it is generated from.
+func EchoAnswer(query string) string {
+	jsonData := gjson.Parse(query)
+	itemType := jsonData.Get("sku_info.item_type").String()
+	if len(itemType) == 0 {
+		itemType = "宝贝"
+	}
+	review := []rune(jsonData.Get("review_info.text").String())
+	return fmt.Sprintf("感谢宝子对%s的评价「%s」~", itemType, string(review[:min(len(review), 10)]))
+}
+
+func (this *Fake) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost || request.URL.Path != ChatMessagesPath {
+		writeError(writer, http.StatusNotFound, "not_found", "The requested URL was not found on the server.")
+		return
+	}
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid_param", err.Error())
+		return
+	}
+	jsonData := gjson.ParseBytes(body)
+	chatRequest := &Request{
+		Query:        jsonData.Get("query").String(),
+		ResponseMode: jsonData.Get("response_mode").String(),
+		User:         jsonData.Get("user").String(),
+		APIKey:       strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer "),
+	}
+	answer, fault, latency := this.next(chatRequest)
+	if fault != nil && !fault.InStream {
+		time.Sleep(latency)
+		writeError(writer, fault.StatusCode, fault.Code, fault.Message)
+		return
+	}
+	if len(chatRequest.Query) == 0 {
+		writeError(writer, http.StatusBadRequest, "invalid_param", "query is required")
+		return
+	}
+	if chatRequest.ResponseMode == ResponseModeStreaming {
+		this.stream(writer, request, chatRequest.Query, answer, fault, latency)
+		return
+	}
+	time.Sleep(latency)
+	writer.Header().Set("Content-Type", "application/json")
+	response := map[string]any{
+		"event":           "message",
+		"task_id":         "task-fake",
+		"message_id":      "message-fake",
+		"conversation_id": "conversation-fake",
+		"mode":            "chat",
+		"answer":          answer,
+		"metadata":        metadata(chatRequest.Query, answer),
+		"created_at":      time.Now().Unix(),
+	}
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		slog.Error("difyfake write response error.", tools.ErrAttr(err))
+	}
+}
+
+// next records the request and returns what to answer it with.
+func (this *Fake) next(request *Request) (string, *Fault, time.Duration) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.requests = append(this.requests, request)
+	if len(this.apiKey) != 0 && request.APIKey != this.apiKey {
+		return "", &FaultUnauthorized, this.latency
+	}
+	var fault *Fault
+	if len(this.faults) != 0 {
+		fault = &this.faults[0]
+		this.faults = this.faults[1:]
+		if !fault.InStream {
+			return "", fault, this.latency
+		}
+	}
+	if len(this.script) != 0 {
+		answer := this.script[0]
+		this.script = this.script[1:]
+		return answer, fault, this.latency
+	}
+	return this.answer(request.Query), fault, this.latency
+}
+
+// stream sends the answer by message events of chunkSize runes, followed by message_end, the way
+// dify streams a chat answer by server-sent events.
+func (this *Fake) stream(writer http.ResponseWriter, request *http.Request, query string, answer string, fault *Fault,
+	latency time.Duration) {
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	flusher, _ := writer.(http.Flusher)
+	send := func(event map[string]any) {
+		b, _ := json.Marshal(event)
+		_, _ = fmt.Fprintf(writer, "data: %s\n\n", b)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	_, _ = fmt.Fprint(writer, "event: ping\n\n")
+	runes := []rune(answer)
+	for i := 0; i < len(runes); i += this.chunkSize {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-time.After(latency):
+		}
+		send(map[string]any{
+			"event":           "message",
+			"task_id":         "task-fake",
+			"message_id":      "message-fake",
+			"conversation_id": "conversation-fake",
+			"answer":          string(runes[i:min(i+this.chunkSize, len(runes))]),
+			"created_at":      time.Now().Unix(),
+		})
+		if fault != nil {
+			send(map[string]any{"event": "error", "task_id": "task-fake", "message_id": "message-fake",
+				"status": http.StatusBadRequest, "code": fault.Code, "message": fault.Message})
+			return
+		}
+	}
+	send(map[string]any{
+		"event":           "message_end",
+		"task_id":         "task-fake",
+		"message_id":      "message-fake",
+		"conversation_id": "conversation-fake",
+		"metadata":        metadata(query, answer),
+	})
+}
+
+func metadata(query string, answer string) map[string]any {
+	promptTokens, completionTokens := len([]rune(query)), len([]rune(answer))
+	return map[string]any{
+		"usage": map[string]any{
+			"prompt_tokens":     promptTokens,
+			"completion_tokens": completionTokens,
+			"total_tokens":      promptTokens + completionTokens,
+		},
+	}
+}
+
+func writeError(writer http.ResponseWriter, statusCode int, code string, message string) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(statusCode)
+	if err := json.NewEncoder(writer).Encode(map[string]any{"code": code, "message": message, "status": statusCode}); err != nil {
+		slog.Error("difyfake write response error.", tools.ErrAttr(err))
+	}
+}
@@ -0,0 +1,125 @@
+package difyfake
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func post(t *testing.T, url string, body string) *http.Response {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Authorization", "Bearer app-test-key")
+	request.Header.Set("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	t.Cleanup(func() { _ = response.Body.Close() })
+	return response
+}
+
+// events reads the data of the server-sent events of response.
+func events(t *testing.T, response *http.Response) []gjson.Result {
+	t.Helper()
+	var got []gjson.Result
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			got = append(got, gjson.Parse(data))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	return got
+}
+
+func TestFake_Streaming(t *testing.T) {
+	tests := []struct {
+		name       string
+		faults     []Fault
+		wantAnswer string
+		wantLast   string
+	}{
+		{
+			name:       "message end",
+			wantAnswer: "谢谢宝子的认可, 欢迎再来~",
+			wantLast:   "message_end",
+		},
+		{
+			name:       "error event",
+			faults:     []Fault{FaultStreamError},
+			wantAnswer: "谢谢宝子",
+			wantLast:   "error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := New()
+			fake.Script("谢谢宝子的认可, 欢迎再来~")
+			fake.Inject(tt.faults...)
+			server := fake.Start()
+			defer server.Close()
+
+			response := post(t, server.URL+ChatMessagesPath, `{"query":"{}","response_mode":"streaming","user":"abc-123"}`)
+			if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+				t.Errorf("Content-Type = %v, want text/event-stream", contentType)
+			}
+			got := events(t, response)
+			if len(got) == 0 {
+				t.Fatalf("events = 0, want some")
+			}
+			var answer strings.Builder
+			for _, event := range got {
+				if event.Get("event").String() == "message" {
+					answer.WriteString(event.Get("answer").String())
+				}
+			}
+			if answer.String() != tt.wantAnswer {
+				t.Errorf("answer = %v, want %v", answer.String(), tt.wantAnswer)
+			}
+			if last := got[len(got)-1].Get("event").String(); last != tt.wantLast {
+				t.Errorf("last event = %v, want %v", last, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestFake_Blocking(t *testing.T) {
+	fake := New()
+	fake.SetAPIKey("app-test-key")
+	fake.Inject(FaultQuota)
+	server := fake.Start()
+	defer server.Close()
+
+	query := `{"sku_info":{"item_type":"裤夹"},"review_info":{"text":"好用"}}`
+	body := `{"query":` + `"` + strings.ReplaceAll(query, `"`, `\"`) + `","response_mode":"blocking","user":"abc-123"}`
+	response := post(t, server.URL+ChatMessagesPath, body)
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", response.StatusCode, http.StatusBadRequest)
+	}
+
+	response = post(t, server.URL+ChatMessagesPath, body)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("status = %v, want %v", response.StatusCode, http.StatusOK)
+	}
+	b, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if answer := gjson.GetBytes(b, "answer").String(); answer != "感谢宝子对裤夹的评价「好用」~" {
+		t.Errorf("answer = %v, want 感谢宝子对裤夹的评价「好用」~", answer)
+	}
+	requests := fake.Requests()
+	if len(requests) != 2 || requests[1].Query != query || requests[1].APIKey != "app-test-key" {
+		t.Errorf("Requests() = %#v", requests)
+	}
+}
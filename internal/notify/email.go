@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/session"
+	"PulseCheck/internal/shop"
+	"PulseCheck/internal/task/review"
+	"PulseCheck/internal/tools"
+)
+
+const (
+	SubjectPrefix = "[PulseCheck] "
+)
+
+var (
+	//go:embed templates/*.html
+	templateFS embed.FS
+	templates  = template.Must(template.New("").Funcs(template.FuncMap{"join": strings.Join}).
+			ParseFS(templateFS, "templates/*.html"))
+)
+
+// EmailNotifier mails the daily digest and the alerts of the escalated reviews and the expired
+// sessions. It is a review.EscalationNotifier, and AlertSessionExpired is a session.AlertFunc.
+type EmailNotifier struct {
+	mailer *Mailer
+}
+
+func NewEmailNotifier(mailer *Mailer) *EmailNotifier {
+	return &EmailNotifier{mailer: mailer}
+}
+
+func (this *EmailNotifier) SendDigest(ctx context.Context, digest *review.Digest) error {
+	subject := fmt.Sprintf("%s评价处理摘要 %s", SubjectPrefix, digest.Until.Format("2006-01-02"))
+	return this.send(ctx, subject, "digest.html", digest)
+}
+
+type escalationRow struct {
+	ReviewIds  []string
+	SkuScore   uint8
+	Content    string
+	Reason     string
+	Draft      string
+	FollowUpId string
+}
+
+func (this *EmailNotifier) NotifyEscalation(ctx context.Context, escalations []*review.Escalation) error {
+	rows := make([]*escalationRow, 0, len(escalations))
+	for _, escalation := range escalations {
+		row := &escalationRow{
+			ReviewIds:  escalation.Data.ReviewIds,
+			Content:    escalation.Data.ReviewContent,
+			Reason:     escalation.Reason,
+			Draft:      escalation.Data.ReplyContent,
+			FollowUpId: escalation.FollowUpId,
+		}
+		if escalation.Data.Review != nil && escalation.Data.Review.Score != nil {
+			row.SkuScore = escalation.Data.Review.Score.SkuScore
+		}
+		rows = append(rows, row)
+	}
+	shopID := shop.WithdrawShopID(ctx)
+	subject := fmt.Sprintf("%s%d条评价需要人工处理", SubjectPrefix, len(rows))
+	if len(shopID) != 0 {
+		subject = fmt.Sprintf("%s店铺[%s] %d条评价需要人工处理", SubjectPrefix, shopID, len(rows))
+	}
+	return this.send(ctx, subject, "escalation.html", map[string]any{"ShopID": shopID, "Rows": rows})
+}
+
+// AlertSessionExpired mails that the session of the shop expired, the error is only logged since
+// a session.AlertFunc returns none.
+func (this *EmailNotifier) AlertSessionExpired(ctx context.Context, status *session.Status) {
+	subject := fmt.Sprintf("%s店铺[%s]登录已失效", SubjectPrefix, status.ShopID)
+	if err := this.send(ctx, subject, "session_expired.html", status); err != nil {
+		slog.Error("mail session expired alert error.", slog.String("shopId", status.ShopID), tools.ErrAttr(err))
+	}
+}
+
+func (this *EmailNotifier) send(ctx context.Context, subject string, name string, data any) error {
+	buffer := &bytes.Buffer{}
+	if err := templates.ExecuteTemplate(buffer, name, data); err != nil {
+		return errors.WithMessagef(err, "render mail template:%s error.", name)
+	}
+	if err := this.mailer.Send(ctx, subject, buffer.String()); err != nil {
+		return errors.WithMessagef(err, "send mail:%s error.", subject)
+	}
+	return nil
+}
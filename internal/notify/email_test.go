@@ -0,0 +1,179 @@
+package notify
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"PulseCheck/internal/session"
+	"PulseCheck/internal/smtpfake"
+	"PulseCheck/internal/storage"
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/task/review"
+	"PulseCheck/internal/xhsreq"
+)
+
+// startFake serves a smtpfake requiring seller@example.com/passwd, by implicit TLS or STARTTLS.
+func startFake(t *testing.T, mode TLSMode) (*smtpfake.Server, *task.EmailSender) {
+	t.Helper()
+	fake, err := smtpfake.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.SetAuth("seller@example.com", "passwd")
+	start := fake.Start
+	if mode == TLSImplicit {
+		start = fake.StartTLS
+	}
+	if err = start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = fake.Close() })
+	host, port, _ := net.SplitHostPort(fake.Addr())
+	return fake, &task.EmailSender{
+		Domain: "example.com",
+		Host:   host,
+		Port:   port,
+		From:   "seller@example.com",
+		Passwd: "passwd",
+		To:     []string{"ops@example.com", "boss@example.com"},
+	}
+}
+
+func TestMailer_Send(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    TLSMode
+		passwd  string
+		wantErr bool
+	}{
+		{name: "starttls", mode: TLSStartTLS, passwd: "passwd"},
+		{name: "implicit tls", mode: TLSImplicit, passwd: "passwd"},
+		{name: "wrong password", mode: TLSStartTLS, passwd: "wrong", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, sender := startFake(t, tt.mode)
+			sender.Passwd = tt.passwd
+			mailer := NewMailer(sender, WithTLSMode(tt.mode), WithRootCAs(fake.CertPool()), WithMailTimeout(5*time.Second))
+			err := mailer.Send(context.Background(), "评价摘要", "<p>你好</p>")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			messages := fake.Messages()
+			if tt.wantErr {
+				if len(messages) != 0 {
+					t.Fatalf("Messages() = %d, want none", len(messages))
+				}
+				return
+			}
+			if len(messages) != 1 {
+				t.Fatalf("Messages() = %d, want 1", len(messages))
+			}
+			message := messages[0]
+			if message.From != sender.From || len(message.To) != 2 {
+				t.Errorf("envelope = %s -> %v", message.From, message.To)
+			}
+			if got := message.Header("Subject"); got != "评价摘要" {
+				t.Errorf("Subject = %s", got)
+			}
+			if got := message.Body(); got != "<p>你好</p>" {
+				t.Errorf("Body() = %s", got)
+			}
+		})
+	}
+}
+
+func TestMailer_Send_UntrustedCertificate(t *testing.T) {
+	_, sender := startFake(t, TLSStartTLS)
+	// the system pool does not trust the self-signed certificate of the fake
+	mailer := NewMailer(sender, WithMailTimeout(5*time.Second))
+	if err := mailer.Send(context.Background(), "subject", "<p>body</p>"); err == nil {
+		t.Fatal("Send() error = nil, want certificate error")
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	fake, sender := startFake(t, TLSStartTLS)
+	notifier := NewEmailNotifier(NewMailer(sender, WithRootCAs(fake.CertPool())))
+	ctx := context.Background()
+	until := time.Date(2024, 5, 2, 9, 0, 0, 0, time.Local)
+	since := until.Add(-24 * time.Hour)
+	reviews := []*xhsreq.Review{
+		{Id: "r1", Classification: &xhsreq.Classification{Sentiment: xhsreq.SentimentNegative, Urgency: xhsreq.UrgencyHigh}},
+		{Id: "r2", Classification: &xhsreq.Classification{Sentiment: xhsreq.SentimentPositive, Urgency: xhsreq.UrgencyLow}},
+	}
+	attempts := []*storage.ReplyAttempt{
+		{ReviewID: "r2", ReplyContent: "谢谢宝子", Success: true, CreatedAt: until.Add(-time.Hour)},
+		{ReviewID: "r3", ReplyContent: "抱歉<亲>", Error: "rate limited", CreatedAt: until.Add(-time.Hour)},
+	}
+	runs := []*storage.TaskRun{
+		{StartedAt: until.Add(-2 * time.Hour)},
+		{StartedAt: until.Add(-time.Hour), Error: "timeout"},
+		{StartedAt: since.Add(-time.Hour)},
+	}
+	digest := review.NewDigest(since, until, runs, reviews, attempts, 3)
+	if err := notifier.SendDigest(ctx, digest); err != nil {
+		t.Fatalf("SendDigest() error = %v", err)
+	}
+	escalations := []*review.Escalation{{
+		Data: &review.ReviewReplyData{
+			ReviewIds:     []string{"r1"},
+			ReviewContent: "钩子断了, 我要退货",
+			ReplyContent:  "非常抱歉",
+			Review:        &xhsreq.Review{Id: "r1", Score: &xhsreq.Score{SkuScore: 1}},
+		},
+		Reason:     "紧急评价",
+		FollowUpId: "r1",
+	}}
+	if err := notifier.NotifyEscalation(ctx, escalations); err != nil {
+		t.Fatalf("NotifyEscalation() error = %v", err)
+	}
+	notifier.AlertSessionExpired(ctx, &session.Status{ShopID: "main", Reason: "token expired", ExpiredAt: until})
+
+	messages := fake.Messages()
+	if len(messages) != 3 {
+		t.Fatalf("Messages() = %d, want 3", len(messages))
+	}
+	tests := []struct {
+		name        string
+		message     *smtpfake.Message
+		wantSubject string
+		wantBody    []string
+	}{
+		{
+			name:        "digest",
+			message:     messages[0],
+			wantSubject: "[PulseCheck] 评价处理摘要 2024-05-02",
+			wantBody: []string{"<td>任务运行</td><td>2</td>", "<td>运行失败</td><td>1</td>", "<td>negative评价</td><td>1</td>",
+				"<td>已回复</td><td>1</td>", "<td>待审批</td><td>3</td>", "<li>r1</li>", "抱歉&lt;亲&gt;", "rate limited"},
+		},
+		{
+			name:        "escalation",
+			message:     messages[1],
+			wantSubject: "[PulseCheck] 1条评价需要人工处理",
+			wantBody:    []string{"钩子断了, 我要退货", "紧急评价", "非常抱歉", "<td>1</td>"},
+		},
+		{
+			name:        "session expired",
+			message:     messages[2],
+			wantSubject: "[PulseCheck] 店铺[main]登录已失效",
+			wantBody:    []string{"2024-05-02 09:00:00", "token expired"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.message.Header("Subject"); got != tt.wantSubject {
+				t.Errorf("Subject = %s, want %s", got, tt.wantSubject)
+			}
+			body := tt.message.Body()
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("Body() misses %q:\n%s", want, body)
+				}
+			}
+		})
+	}
+}
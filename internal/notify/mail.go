@@ -0,0 +1,186 @@
+// Package notify tells the operators what the service did and what needs them, by email and by the
+// webhooks of their group chats.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/tools"
+)
+
+// TLSMode is how the connection to the smtp server is secured.
+type TLSMode string
+
+const (
+	// TLSStartTLS upgrades the plain connection by STARTTLS, usually on port 587
+	TLSStartTLS TLSMode = "starttls"
+	// TLSImplicit speaks TLS from the start, usually on port 465
+	TLSImplicit TLSMode = "tls"
+	// TLSNone sends in plain text, only for a relay on localhost
+	TLSNone TLSMode = "none"
+
+	DefaultMailTimeout = 30 * time.Second
+)
+
+type MailerOption func(mailer *Mailer)
+
+func WithTLSMode(mode TLSMode) MailerOption {
+	return func(mailer *Mailer) {
+		mailer.tlsMode = mode
+	}
+}
+
+// WithRootCAs verifies the certificate of the server by rootCAs instead of the system pool.
+func WithRootCAs(rootCAs *x509.CertPool) MailerOption {
+	return func(mailer *Mailer) {
+		mailer.rootCAs = rootCAs
+	}
+}
+
+func WithMailTimeout(timeout time.Duration) MailerOption {
+	return func(mailer *Mailer) {
+		mailer.timeout = timeout
+	}
+}
+
+// Mailer sends html mails from sender.From to sender.To through the smtp server of sender, it
+// authenticates as sender.From by AUTH PLAIN if sender.Passwd is set.
+type Mailer struct {
+	sender  *task.EmailSender
+	tlsMode TLSMode
+	rootCAs *x509.CertPool
+	timeout time.Duration
+}
+
+func NewMailer(sender *task.EmailSender, opts ...MailerOption) *Mailer {
+	tools.InitialCerts()
+	mailer := &Mailer{
+		sender:  sender,
+		tlsMode: TLSStartTLS,
+		rootCAs: tools.SystemCertPool(),
+		timeout: DefaultMailTimeout,
+	}
+	for _, opt := range opts {
+		opt(mailer)
+	}
+	return mailer
+}
+
+func (this *Mailer) Send(ctx context.Context, subject string, html string) error {
+	if len(this.sender.From) == 0 || len(this.sender.To) == 0 {
+		return errors.Errorf("email sender:%s or recipients:%v missing", this.sender.From, this.sender.To)
+	}
+	client, err := this.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+	if len(this.sender.Passwd) != 0 {
+		auth := smtp.PlainAuth("", this.sender.From, this.sender.Passwd, this.sender.Host)
+		if err = client.Auth(auth); err != nil {
+			return errors.WithMessagef(err, "authenticate as:%s error.", this.sender.From)
+		}
+	}
+	if err = client.Mail(this.sender.From); err != nil {
+		return errors.WithMessagef(err, "mail from:%s error.", this.sender.From)
+	}
+	for _, to := range this.sender.To {
+		if err = client.Rcpt(to); err != nil {
+			return errors.WithMessagef(err, "rcpt to:%s error.", to)
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return errors.WithMessagef(err, "start mail data error.")
+	}
+	if _, err = writer.Write(this.message(subject, html)); err != nil {
+		return errors.WithMessagef(err, "write mail:%s error.", subject)
+	}
+	if err = writer.Close(); err != nil {
+		return errors.WithMessagef(err, "send mail:%s error.", subject)
+	}
+	return client.Quit()
+}
+
+func (this *Mailer) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(this.sender.Host, this.sender.Port)
+	tlsConfig := &tls.Config{ServerName: this.sender.Host, RootCAs: this.rootCAs, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: this.timeout}
+	var conn net.Conn
+	var err error
+	if this.tlsMode == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "connect smtp server:%s error.", addr)
+	}
+	deadline := time.Now().Add(this.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+	client, err := smtp.NewClient(conn, this.sender.Host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.WithMessagef(err, "greet smtp server:%s error.", addr)
+	}
+	if len(this.sender.Domain) != 0 {
+		if err = client.Hello(this.sender.Domain); err != nil {
+			_ = client.Close()
+			return nil, errors.WithMessagef(err, "hello smtp server:%s as:%s error.", addr, this.sender.Domain)
+		}
+	}
+	if this.tlsMode == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			_ = client.Close()
+			return nil, errors.Errorf("smtp server:%s does not support STARTTLS", addr)
+		}
+		if err = client.StartTLS(tlsConfig); err != nil {
+			_ = client.Close()
+			return nil, errors.WithMessagef(err, "starttls with smtp server:%s error.", addr)
+		}
+	}
+	return client, nil
+}
+
+// message returns the mail of a base64 encoded html body.
+func (this *Mailer) message(subject string, html string) []byte {
+	domain := this.sender.Domain
+	if len(domain) == 0 {
+		domain = this.sender.Host
+	}
+	now := time.Now()
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, "From: %s\r\n", this.sender.From)
+	fmt.Fprintf(buffer, "To: %s\r\n", strings.Join(this.sender.To, ", "))
+	fmt.Fprintf(buffer, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(buffer, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(buffer, "Message-ID: <%d@%s>\r\n", now.UnixNano(), domain)
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	buffer.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(html))
+	for len(encoded) > 76 {
+		buffer.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buffer.WriteString(encoded + "\r\n")
+	return buffer.Bytes()
+}
@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/session"
+	"PulseCheck/internal/shop"
+	"PulseCheck/internal/storage"
+	"PulseCheck/internal/task/review"
+	"PulseCheck/internal/tools"
+)
+
+const (
+	// maxMessageLines the lines of a message beyond this are summed up by a count
+	maxMessageLines = 10
+)
+
+// Message is a short text posted to the group chat of the operators, along with a link to act on it.
+type Message struct {
+	Title string
+	Lines []string
+	// Link is where the operator acts on the message, no link is posted if empty
+	Link      string
+	LinkTitle string
+}
+
+// Notifier posts the messages to where the operators are.
+type Notifier interface {
+	Notify(ctx context.Context, message *Message) error
+}
+
+// Notifiers posts every message to all of them, a failed one does not stop the others.
+type Notifiers []Notifier
+
+func (this Notifiers) Notify(ctx context.Context, message *Message) error {
+	var result error
+	for _, notifier := range this {
+		if err := notifier.Notify(ctx, message); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result
+}
+
+// ----------------------------------
+// RunSummary is the outcome of a reply task of a shop.
+type RunSummary struct {
+	ShopID string
+	RunID  uint64
+	// Failures the reply attempts failed in the run
+	Failures []*storage.ReplyAttempt
+	// NewApprovals the replies the run parked for approval, PendingApprovals all of the shop
+	NewApprovals     int
+	PendingApprovals int
+}
+
+// Alerter turns what happens in the review pipeline into messages of the notifier: the escalated
+// reviews, the failed replies and the replies waiting for approval of a run, and the expired
+// sessions. It is a review.EscalationNotifier, and AlertSessionExpired is a session.AlertFunc.
+type Alerter struct {
+	notifier Notifier
+	// baseURL is where the operators reach the http server, the links are made of it
+	baseURL string
+}
+
+func NewAlerter(notifier Notifier, baseURL string) *Alerter {
+	return &Alerter{notifier: notifier, baseURL: baseURL}
+}
+
+// ApprovalLink returns the link listing the pending replies of the shop, empty if no base url is set.
+func (this *Alerter) ApprovalLink(shopID string) string {
+	if len(this.baseURL) == 0 {
+		return ""
+	}
+	query := url.Values{"status": {"pending"}}
+	if len(shopID) != 0 {
+		query.Set("shop", shopID)
+	}
+	return this.baseURL + "/approval?" + query.Encode()
+}
+
+func (this *Alerter) NotifyEscalation(ctx context.Context, escalations []*review.Escalation) error {
+	shopID := shop.WithdrawShopID(ctx)
+	lines := make([]string, 0, len(escalations))
+	for _, escalation := range escalations {
+		data := escalation.Data
+		score := ""
+		if data.Review != nil && data.Review.Score != nil && data.Review.Score.SkuScore > 0 {
+			score = fmt.Sprintf("(%d星)", data.Review.Score.SkuScore)
+		}
+		lines = append(lines, fmt.Sprintf("[%s]%s %v: %s", escalation.Reason, score, data.ReviewIds, data.ReviewContent))
+	}
+	message := &Message{
+		Title:     fmt.Sprintf("店铺[%s] %d条评价需要人工处理", shopID, len(escalations)),
+		Lines:     truncate(lines),
+		Link:      this.ApprovalLink(shopID),
+		LinkTitle: "审批回复草稿",
+	}
+	return this.notifier.Notify(ctx, message)
+}
+
+// NotifyRun posts the failed replies and the new replies waiting for approval of the run, nothing is
+// posted if there is neither.
+func (this *Alerter) NotifyRun(ctx context.Context, summary *RunSummary) error {
+	if len(summary.Failures) == 0 && summary.NewApprovals == 0 {
+		return nil
+	}
+	lines := make([]string, 0, len(summary.Failures))
+	for _, attempt := range summary.Failures {
+		lines = append(lines, fmt.Sprintf("回复失败 %s: %s", attempt.ReviewID, attempt.Error))
+	}
+	lines = truncate(lines)
+	if summary.NewApprovals != 0 {
+		lines = append(lines, fmt.Sprintf("新增%d条回复待审批, 共%d条", summary.NewApprovals, summary.PendingApprovals))
+	}
+	message := &Message{
+		Title: fmt.Sprintf("店铺[%s] 任务%d: %d条回复失败, %d条待审批",
+			summary.ShopID, summary.RunID, len(summary.Failures), summary.NewApprovals),
+		Lines: lines,
+	}
+	if summary.NewApprovals != 0 {
+		message.Link, message.LinkTitle = this.ApprovalLink(summary.ShopID), "审批待回复"
+	}
+	return errors.WithMessagef(this.notifier.Notify(ctx, message), "notify run:%d of shop:%s error.",
+		summary.RunID, summary.ShopID)
+}
+
+// AlertSessionExpired posts that the session of the shop expired, the error is only logged since
+// a session.AlertFunc returns none.
+func (this *Alerter) AlertSessionExpired(ctx context.Context, status *session.Status) {
+	message := &Message{
+		Title: fmt.Sprintf("店铺[%s]登录已失效", status.ShopID),
+		Lines: []string{
+			fmt.Sprintf("失效时间: %s", status.ExpiredAt.Format("2006-01-02 15:04:05")),
+			fmt.Sprintf("原因: %s", status.Reason),
+			fmt.Sprintf("请通过 POST /session?shop=%s 更新token或cookie", status.ShopID),
+		},
+	}
+	if err := this.notifier.Notify(ctx, message); err != nil {
+		slog.Error("notify session expired error.", slog.String("shopId", status.ShopID), tools.ErrAttr(err))
+	}
+}
+
+// truncate keeps the first maxMessageLines lines and counts the rest.
+func truncate(lines []string) []string {
+	if len(lines) <= maxMessageLines {
+		return lines
+	}
+	rest := len(lines) - maxMessageLines
+	return append(lines[:maxMessageLines:maxMessageLines], fmt.Sprintf("...还有%d条", rest))
+}
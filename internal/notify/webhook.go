@@ -0,0 +1,237 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"PulseCheck/internal/tools"
+)
+
+// WebhookKind is the chat the webhook posts to, which decides the format of the message, how it is
+// signed and how the answer is checked.
+type WebhookKind string
+
+const (
+	// WebhookWeCom the group robot of wecom(企业微信), it signs nothing, the key of the url is the secret
+	WebhookWeCom WebhookKind = "wecom"
+	// WebhookDingTalk the custom robot of dingtalk(钉钉), signed by the "加签" secret
+	WebhookDingTalk WebhookKind = "dingtalk"
+	// WebhookFeishu the custom bot of feishu(飞书), signed by the "签名校验" secret
+	WebhookFeishu WebhookKind = "feishu"
+	// WebhookSlack the incoming webhook of slack, it signs nothing
+	WebhookSlack WebhookKind = "slack"
+	// WebhookJSON posts the message as it is, signed by the headers X-PulseCheck-Timestamp and
+	// X-PulseCheck-Signature if the secret is set
+	WebhookJSON WebhookKind = "json"
+
+	TimestampHeader = "X-PulseCheck-Timestamp"
+	SignatureHeader = "X-PulseCheck-Signature"
+
+	DefaultWebhookTimeout = 10 * time.Second
+)
+
+var (
+	WebhookKinds = []WebhookKind{WebhookWeCom, WebhookDingTalk, WebhookFeishu, WebhookSlack, WebhookJSON}
+)
+
+type WebhookOption func(webhook *Webhook)
+
+func WithWebhookClient(httpClient *http.Client) WebhookOption {
+	return func(webhook *Webhook) {
+		webhook.httpClient = httpClient
+	}
+}
+
+// Webhook posts the messages to a chat robot or a json endpoint. Like a reply a message is never
+// retried, a chat would show it twice.
+type Webhook struct {
+	kind       WebhookKind
+	url        string
+	secret     string
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+func NewWebhook(kind WebhookKind, webhookURL string, secret string, opts ...WebhookOption) (*Webhook, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "parse %s webhook url error.", kind)
+	}
+	if !slices.Contains(WebhookKinds, kind) {
+		return nil, errors.Errorf("unknown webhook kind:%s", kind)
+	}
+	webhook := &Webhook{kind: kind, url: webhookURL, secret: secret, now: time.Now}
+	for _, opt := range opts {
+		opt(webhook)
+	}
+	if webhook.httpClient == nil {
+		webhook.httpClient = tools.NewHttpsClient(u.Hostname(), tools.WithTimeout(DefaultWebhookTimeout))
+	}
+	return webhook, nil
+}
+
+func (this *Webhook) Notify(ctx context.Context, message *Message) error {
+	now := this.now()
+	requestURL, err := this.signURL(now)
+	if err != nil {
+		return err
+	}
+	body := this.newRequestBody(message, now)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithMessagef(err, "construct %s webhook request error.", this.kind)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if this.kind == WebhookJSON && len(this.secret) != 0 {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		request.Header.Set(TimestampHeader, timestamp)
+		request.Header.Set(SignatureHeader, "sha256="+SignJSON(this.secret, timestamp, body))
+	}
+	response, err := this.httpClient.Do(request)
+	if err != nil {
+		return errors.WithMessagef(err, "post %s webhook message:%s error.", this.kind, message.Title)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	b, err := io.ReadAll(response.Body)
+	if err != nil {
+		return errors.WithMessagef(err, "read %s webhook response error.", this.kind)
+	}
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return errors.Errorf("%s webhook answered statusCode:%d body:%s", this.kind, response.StatusCode, b)
+	}
+	return this.verify(b)
+}
+
+// signURL appends the timestamp and sign of dingtalk to the url.
+func (this *Webhook) signURL(now time.Time) (string, error) {
+	if this.kind != WebhookDingTalk || len(this.secret) == 0 {
+		return this.url, nil
+	}
+	u, err := url.Parse(this.url)
+	if err != nil {
+		return "", errors.WithMessagef(err, "parse dingtalk webhook url error.")
+	}
+	timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+	query := u.Query()
+	query.Set("timestamp", timestamp)
+	query.Set("sign", SignDingTalk(this.secret, timestamp))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func (this *Webhook) newRequestBody(message *Message, now time.Time) []byte {
+	jsonData := []byte("{}")
+	switch this.kind {
+	case WebhookWeCom:
+		jsonData, _ = sjson.SetBytes(jsonData, "msgtype", "markdown")
+		jsonData, _ = sjson.SetBytes(jsonData, "markdown.content", markdown(message, "\n"))
+	case WebhookDingTalk:
+		jsonData, _ = sjson.SetBytes(jsonData, "msgtype", "markdown")
+		jsonData, _ = sjson.SetBytes(jsonData, "markdown.title", message.Title)
+		// dingtalk breaks the lines of a markdown by blank lines only
+		jsonData, _ = sjson.SetBytes(jsonData, "markdown.text", markdown(message, "\n\n"))
+	case WebhookFeishu:
+		if len(this.secret) != 0 {
+			timestamp := strconv.FormatInt(now.Unix(), 10)
+			jsonData, _ = sjson.SetBytes(jsonData, "timestamp", timestamp)
+			jsonData, _ = sjson.SetBytes(jsonData, "sign", SignFeishu(this.secret, timestamp))
+		}
+		jsonData, _ = sjson.SetBytes(jsonData, "msg_type", "text")
+		jsonData, _ = sjson.SetBytes(jsonData, "content.text", plainText(message))
+	case WebhookSlack:
+		text := "*" + message.Title + "*"
+		for _, line := range message.Lines {
+			text += "\n• " + line
+		}
+		if len(message.Link) != 0 {
+			text += "\n<" + message.Link + "|" + message.LinkTitle + ">"
+		}
+		jsonData, _ = sjson.SetBytes(jsonData, "text", text)
+	default:
+		jsonData, _ = sjson.SetBytes(jsonData, "title", message.Title)
+		lines := message.Lines
+		if lines == nil {
+			lines = []string{}
+		}
+		jsonData, _ = sjson.SetBytes(jsonData, "lines", lines)
+		jsonData, _ = sjson.SetBytes(jsonData, "link", message.Link)
+		jsonData, _ = sjson.SetBytes(jsonData, "link_title", message.LinkTitle)
+		jsonData, _ = sjson.SetBytes(jsonData, "timestamp", now.Unix())
+	}
+	return jsonData
+}
+
+// verify checks the answer of the robots, which fail by a code in a 200 response.
+func (this *Webhook) verify(b []byte) error {
+	result := gjson.ParseBytes(b)
+	switch this.kind {
+	case WebhookWeCom, WebhookDingTalk:
+		if code := result.Get("errcode").Int(); code != 0 {
+			return errors.Errorf("%s webhook answered errcode:%d errmsg:%s", this.kind, code, result.Get("errmsg").String())
+		}
+	case WebhookFeishu:
+		if code := result.Get("code").Int(); code != 0 {
+			return errors.Errorf("feishu webhook answered code:%d msg:%s", code, result.Get("msg").String())
+		}
+	}
+	return nil
+}
+
+func markdown(message *Message, lineBreak string) string {
+	lines := []string{"### " + message.Title}
+	lines = append(lines, message.Lines...)
+	if len(message.Link) != 0 {
+		lines = append(lines, "["+message.LinkTitle+"]("+message.Link+")")
+	}
+	return strings.Join(lines, lineBreak)
+}
+
+func plainText(message *Message) string {
+	lines := []string{message.Title}
+	lines = append(lines, message.Lines...)
+	if len(message.Link) != 0 {
+		lines = append(lines, message.LinkTitle+": "+message.Link)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SignDingTalk returns the url-unescaped sign of dingtalk, base64(hmac-sha256(secret, timestamp+"\n"+secret))
+// of the timestamp in milliseconds.
+func SignDingTalk(secret string, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignFeishu returns the sign of feishu, base64(hmac-sha256(timestamp+"\n"+secret, "")) of the
+// timestamp in seconds.
+func SignFeishu(secret string, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignJSON returns the signature of the json webhooks, hex(hmac-sha256(secret, timestamp+"."+body)),
+// the receiver computes it again to make sure the message comes from this service.
+func SignJSON(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
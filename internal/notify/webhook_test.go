@@ -0,0 +1,229 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"PulseCheck/internal/storage"
+)
+
+type captured struct {
+	query  map[string][]string
+	header http.Header
+	body   []byte
+}
+
+// startRobot answers every message by answer and captures it.
+func startRobot(t *testing.T, answer string) (*httptest.Server, *[]*captured) {
+	t.Helper()
+	requests := make([]*captured, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		requests = append(requests, &captured{query: request.URL.Query(), header: request.Header, body: body})
+		_, _ = writer.Write([]byte(answer))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestWebhook_Notify(t *testing.T) {
+	now := time.Unix(1714611600, 0)
+	message := &Message{
+		Title:     "店铺[main] 1条评价需要人工处理",
+		Lines:     []string{"[紧急评价] [r1]: 钩子断了"},
+		Link:      "http://127.0.0.1:1903/approval?shop=main&status=pending",
+		LinkTitle: "审批回复草稿",
+	}
+	tests := []struct {
+		name    string
+		kind    WebhookKind
+		secret  string
+		answer  string
+		wantErr bool
+		check   func(t *testing.T, request *captured)
+	}{
+		{
+			name:   "wecom",
+			kind:   WebhookWeCom,
+			answer: `{"errcode":0,"errmsg":"ok"}`,
+			check: func(t *testing.T, request *captured) {
+				body := gjson.ParseBytes(request.body)
+				want := "### 店铺[main] 1条评价需要人工处理\n[紧急评价] [r1]: 钩子断了\n[审批回复草稿](" + message.Link + ")"
+				if body.Get("msgtype").String() != "markdown" || body.Get("markdown.content").String() != want {
+					t.Errorf("body = %s", request.body)
+				}
+			},
+		},
+		{
+			name:    "wecom error code",
+			kind:    WebhookWeCom,
+			answer:  `{"errcode":93000,"errmsg":"invalid webhook url"}`,
+			wantErr: true,
+		},
+		{
+			name:   "dingtalk signed",
+			kind:   WebhookDingTalk,
+			secret: "SEC-ding",
+			answer: `{"errcode":0,"errmsg":"ok"}`,
+			check: func(t *testing.T, request *captured) {
+				timestamp := "1714611600000"
+				if got := request.query["timestamp"]; len(got) != 1 || got[0] != timestamp {
+					t.Errorf("timestamp = %v", got)
+				}
+				if got := request.query["sign"]; len(got) != 1 || got[0] != SignDingTalk("SEC-ding", timestamp) {
+					t.Errorf("sign = %v", got)
+				}
+				body := gjson.ParseBytes(request.body)
+				if body.Get("markdown.title").String() != message.Title ||
+					!strings.Contains(body.Get("markdown.text").String(), "\n\n[紧急评价]") {
+					t.Errorf("body = %s", request.body)
+				}
+			},
+		},
+		{
+			name:   "feishu signed",
+			kind:   WebhookFeishu,
+			secret: "feishu-secret",
+			answer: `{"code":0,"msg":"success"}`,
+			check: func(t *testing.T, request *captured) {
+				body := gjson.ParseBytes(request.body)
+				if body.Get("timestamp").String() != "1714611600" ||
+					body.Get("sign").String() != SignFeishu("feishu-secret", "1714611600") {
+					t.Errorf("sign of body = %s", request.body)
+				}
+				if body.Get("msg_type").String() != "text" ||
+					!strings.HasSuffix(body.Get("content.text").String(), "审批回复草稿: "+message.Link) {
+					t.Errorf("body = %s", request.body)
+				}
+			},
+		},
+		{
+			name:    "feishu sign mismatch",
+			kind:    WebhookFeishu,
+			secret:  "wrong",
+			answer:  `{"code":19021,"msg":"sign match fail or timestamp is not within one hour from current time"}`,
+			wantErr: true,
+		},
+		{
+			name:   "slack",
+			kind:   WebhookSlack,
+			answer: "ok",
+			check: func(t *testing.T, request *captured) {
+				want := "*店铺[main] 1条评价需要人工处理*\n• [紧急评价] [r1]: 钩子断了\n<" + message.Link + "|审批回复草稿>"
+				if got := gjson.GetBytes(request.body, "text").String(); got != want {
+					t.Errorf("text = %s", got)
+				}
+			},
+		},
+		{
+			name:   "json signed",
+			kind:   WebhookJSON,
+			secret: "json-secret",
+			check: func(t *testing.T, request *captured) {
+				timestamp := request.header.Get(TimestampHeader)
+				if timestamp != "1714611600" {
+					t.Errorf("%s = %s", TimestampHeader, timestamp)
+				}
+				if got := request.header.Get(SignatureHeader); got != "sha256="+SignJSON("json-secret", timestamp, request.body) {
+					t.Errorf("%s = %s", SignatureHeader, got)
+				}
+				body := gjson.ParseBytes(request.body)
+				if body.Get("title").String() != message.Title || body.Get("lines.0").String() != message.Lines[0] ||
+					body.Get("link").String() != message.Link {
+					t.Errorf("body = %s", request.body)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := startRobot(t, tt.answer)
+			webhook, err := NewWebhook(tt.kind, server.URL+"/robot/send?access_token=token", tt.secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			webhook.now = func() time.Time { return now }
+			err = webhook.Notify(context.Background(), message)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(*requests) != 1 {
+				t.Fatalf("requests = %d, want 1", len(*requests))
+			}
+			if tt.check != nil {
+				tt.check(t, (*requests)[0])
+			}
+		})
+	}
+}
+
+type recordNotifier struct {
+	messages []*Message
+}
+
+func (this *recordNotifier) Notify(ctx context.Context, message *Message) error {
+	this.messages = append(this.messages, message)
+	return nil
+}
+
+func TestAlerter_NotifyRun(t *testing.T) {
+	failures := make([]*storage.ReplyAttempt, 0)
+	for _, id := range []string{"r1", "r2", "r3", "r4", "r5", "r6", "r7", "r8", "r9", "r10", "r11", "r12"} {
+		failures = append(failures, &storage.ReplyAttempt{ReviewID: id, Error: "rate limited"})
+	}
+	tests := []struct {
+		name      string
+		baseURL   string
+		summary   *RunSummary
+		wantTitle string
+		wantLines int
+		wantLink  string
+	}{
+		{
+			name:    "nothing to tell",
+			summary: &RunSummary{ShopID: "main", RunID: 1, PendingApprovals: 3},
+		},
+		{
+			name:      "failures truncated",
+			summary:   &RunSummary{ShopID: "main", RunID: 2, Failures: failures},
+			wantTitle: "店铺[main] 任务2: 12条回复失败, 0条待审批",
+			wantLines: maxMessageLines + 1,
+		},
+		{
+			name:      "new approvals linked",
+			baseURL:   "http://127.0.0.1:1903",
+			summary:   &RunSummary{ShopID: "main", RunID: 3, Failures: failures[:1], NewApprovals: 2, PendingApprovals: 5},
+			wantTitle: "店铺[main] 任务3: 1条回复失败, 2条待审批",
+			wantLines: 2,
+			wantLink:  "http://127.0.0.1:1903/approval?shop=main&status=pending",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &recordNotifier{}
+			if err := NewAlerter(notifier, tt.baseURL).NotifyRun(context.Background(), tt.summary); err != nil {
+				t.Fatalf("NotifyRun() error = %v", err)
+			}
+			if len(tt.wantTitle) == 0 {
+				if len(notifier.messages) != 0 {
+					t.Fatalf("messages = %d, want none", len(notifier.messages))
+				}
+				return
+			}
+			if len(notifier.messages) != 1 {
+				t.Fatalf("messages = %d, want 1", len(notifier.messages))
+			}
+			message := notifier.messages[0]
+			if message.Title != tt.wantTitle || len(message.Lines) != tt.wantLines || message.Link != tt.wantLink {
+				t.Errorf("message = %+v", message)
+			}
+		})
+	}
+}
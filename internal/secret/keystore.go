@@ -0,0 +1,156 @@
+package secret
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+
+	"PulseCheck/internal/tools"
+)
+
+const (
+	keystoreVersion = 1
+	saltSize        = 16
+	keySize         = 32
+	// scrypt parameters recommended for interactive logins
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var (
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted keystore")
+)
+
+// keystoreFile is the layout of the keystore on disk, the secrets are sealed by AES-GCM with the
+// key derived from the passphrase by scrypt.
+type keystoreFile struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Keystore keeps the secrets encrypted in a local file, unlocked by a passphrase.
+type Keystore struct {
+	path       string
+	passphrase []byte
+	secrets    map[string]string
+	mu         sync.RWMutex
+}
+
+// OpenKeystore unlocks the keystore at path, a missing file results in an empty keystore
+// which is created on the first Set.
+func OpenKeystore(path string, passphrase string) (*Keystore, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("keystore passphrase is empty")
+	}
+	keystore := &Keystore{path: path, passphrase: []byte(passphrase), secrets: map[string]string{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return keystore, nil
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read keystore:%s error.", path)
+	}
+	file := &keystoreFile{}
+	if err = json.Unmarshal(b, file); err != nil {
+		return nil, errors.WithMessagef(err, "unmarshal keystore:%s error.", path)
+	}
+	if file.Version != keystoreVersion {
+		return nil, errors.Errorf("unsupported keystore:%s version:%d", path, file.Version)
+	}
+	aead, err := newAEAD(keystore.passphrase, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.WithMessagef(ErrWrongPassphrase, "keystore:%s", path)
+	}
+	if err = json.Unmarshal(plaintext, &keystore.secrets); err != nil {
+		return nil, errors.WithMessagef(err, "unmarshal secrets of keystore:%s error.", path)
+	}
+	return keystore, nil
+}
+
+func (this *Keystore) Get(ctx context.Context, name string) (string, error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	value, ok := this.secrets[name]
+	if !ok {
+		return "", errors.WithMessagef(ErrNotFound, "keystore:%s", name)
+	}
+	tools.RegisterSecret(value)
+	return value, nil
+}
+
+// Names returns the names of the secrets, sorted.
+func (this *Keystore) Names() []string {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	names := make([]string, 0, len(this.secrets))
+	for name := range this.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set stores the secret and rewrites the keystore, an empty value deletes it.
+func (this *Keystore) Set(name string, value string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if len(value) == 0 {
+		delete(this.secrets, name)
+	} else {
+		this.secrets[name] = value
+	}
+	return this.save()
+}
+
+func (this *Keystore) save() error {
+	plaintext, err := json.Marshal(this.secrets)
+	if err != nil {
+		return errors.WithMessagef(err, "marshal secrets error.")
+	}
+	// a fresh salt and nonce on every save
+	file := &keystoreFile{Version: keystoreVersion, Salt: make([]byte, saltSize)}
+	if _, err = rand.Read(file.Salt); err != nil {
+		return errors.WithMessagef(err, "generate salt error.")
+	}
+	aead, err := newAEAD(this.passphrase, file.Salt)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(file.Nonce); err != nil {
+		return errors.WithMessagef(err, "generate nonce error.")
+	}
+	file.Ciphertext = aead.Seal(nil, file.Nonce, plaintext, nil)
+	b, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return errors.WithMessagef(err, "marshal keystore error.")
+	}
+	return tools.WriteFileAtomic(this.path, b, 0o600)
+}
+
+func newAEAD(passphrase []byte, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "derive keystore key error.")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "new keystore cipher error.")
+	}
+	return cipher.NewGCM(block)
+}
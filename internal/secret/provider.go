@@ -0,0 +1,159 @@
+package secret
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/tools"
+)
+
+const (
+	// XHSToken the access token of the xiaohongshu seller, named after the env the service used to read
+	XHSToken = "auth"
+	// XHSCookie the cookie template of xiaohongshu, {{ . }} is replaced by the access token
+	XHSCookie = "xhs_cookie"
+	// LLMKey the bearer api key of the LLM backend
+	LLMKey = "llm_key"
+	// SMTPPassword the password of the email sender
+	SMTPPassword = "smtp_password"
+	// AdminToken the bearer token of the http endpoints changing the state of the service
+	AdminToken = "admin_token"
+
+	ProviderKey = "secret-provider"
+)
+
+var (
+	ErrNotFound = errors.New("secret not found")
+)
+
+// Provider looks up a secret by its name, ErrNotFound is returned if it does not hold it.
+// Every secret returned is registered for redaction, so it never shows up in the logs.
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// ----------------------------------
+// EnvProvider reads the secret from the environment variable of the same name.
+type EnvProvider struct {
+}
+
+func NewEnvProvider() *EnvProvider {
+	return &EnvProvider{}
+}
+
+func (this *EnvProvider) Get(ctx context.Context, name string) (string, error) {
+	value, exists := os.LookupEnv(name)
+	if !exists || len(value) == 0 {
+		return "", errors.WithMessagef(ErrNotFound, "env:%s", name)
+	}
+	tools.RegisterSecret(value)
+	return value, nil
+}
+
+// ----------------------------------
+// FileProvider reads the secret from the file of the same name under dir. The file must not be
+// accessible by the group or others.
+type FileProvider struct {
+	dir string
+}
+
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{dir: dir}
+}
+
+func (this *FileProvider) Get(ctx context.Context, name string) (string, error) {
+	path := filepath.Join(this.dir, name)
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errors.WithMessagef(ErrNotFound, "file:%s", path)
+	}
+	if err != nil {
+		return "", errors.WithMessagef(err, "stat secret file:%s error.", path)
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return "", errors.Errorf("secret file:%s permission %#o is too open, 0600 is required", path, perm)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.WithMessagef(err, "read secret file:%s error.", path)
+	}
+	value := strings.TrimSpace(string(b))
+	if len(value) == 0 {
+		return "", errors.WithMessagef(ErrNotFound, "file:%s is empty", path)
+	}
+	tools.RegisterSecret(value)
+	return value, nil
+}
+
+// ----------------------------------
+// Static holds fixed secrets, e.g. the ones set in the config file.
+type Static map[string]string
+
+func (this Static) Get(ctx context.Context, name string) (string, error) {
+	value, ok := this[name]
+	if !ok || len(value) == 0 {
+		return "", errors.WithMessagef(ErrNotFound, "static:%s", name)
+	}
+	tools.RegisterSecret(value)
+	return value, nil
+}
+
+// ----------------------------------
+// Chain asks the providers in order, the first one holding the secret wins.
+type Chain []Provider
+
+func NewChain(providers ...Provider) Chain {
+	chain := make(Chain, 0, len(providers))
+	for _, provider := range providers {
+		if provider != nil {
+			chain = append(chain, provider)
+		}
+	}
+	return chain
+}
+
+func (this Chain) Get(ctx context.Context, name string) (string, error) {
+	for _, provider := range this {
+		value, err := provider.Get(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			slog.Error("get secret error.", slog.String("name", name), tools.ErrAttr(err))
+			return "", err
+		}
+		return value, nil
+	}
+	return "", errors.WithMessagef(ErrNotFound, "name:%s", name)
+}
+
+// ----------------------------------
+// Prefixed looks up the secrets of a shop, e.g. shop2_auth for auth with the prefix shop2_.
+type Prefixed struct {
+	provider Provider
+	prefix   string
+}
+
+func NewPrefixed(provider Provider, prefix string) *Prefixed {
+	return &Prefixed{provider: provider, prefix: prefix}
+}
+
+func (this *Prefixed) Get(ctx context.Context, name string) (string, error) {
+	return this.provider.Get(ctx, this.prefix+name)
+}
+
+// ----------------------------------
+func AppendProvider(ctx context.Context, provider Provider) context.Context {
+	return context.WithValue(ctx, ProviderKey, provider)
+}
+
+// WithdrawProvider returns the provider carried by ctx, nil if there is none.
+func WithdrawProvider(ctx context.Context) Provider {
+	provider, _ := ctx.Value(ProviderKey).(Provider)
+	return provider
+}
@@ -0,0 +1,87 @@
+package secret
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/tools"
+)
+
+func TestChain_Get(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, LLMKey), []byte("app-file-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, XHSCookie), []byte("cookie-open-file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(XHSToken, "AT-env-secret")
+	chain := NewChain(NewEnvProvider(), NewFileProvider(dir))
+
+	tests := []struct {
+		name    string
+		key     string
+		want    string
+		wantErr error
+	}{
+		{name: "env", key: XHSToken, want: "AT-env-secret"},
+		{name: "file", key: LLMKey, want: "app-file-secret"},
+		{name: "file too open", key: XHSCookie, wantErr: errors.New("permission")},
+		{name: "missing", key: "missing", wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := chain.Get(context.Background(), tt.key)
+			if (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if errors.Is(tt.wantErr, ErrNotFound) && !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Get() got = %v, want %v", got, tt.want)
+			}
+			if len(got) != 0 && tools.Redact("token="+got) != "token="+tools.RedactedValue {
+				t.Errorf("Redact() secret %s is not redacted", got)
+			}
+		})
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	keystore, err := OpenKeystore(path, "passphrase")
+	if err != nil {
+		t.Fatalf("OpenKeystore() error = %v", err)
+	}
+	if err = keystore.Set(LLMKey, "app-keystore-secret"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("keystore permission = %#o, want 0600", perm)
+	}
+
+	if _, err = OpenKeystore(path, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("OpenKeystore() error = %v, wantErr %v", err, ErrWrongPassphrase)
+	}
+	reopened, err := OpenKeystore(path, "passphrase")
+	if err != nil {
+		t.Fatalf("OpenKeystore() error = %v", err)
+	}
+	got, err := reopened.Get(context.Background(), LLMKey)
+	if err != nil || got != "app-keystore-secret" {
+		t.Errorf("Get() got = %v, error = %v", got, err)
+	}
+	if _, err = reopened.Get(context.Background(), XHSToken); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, wantErr %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,160 @@
+package session
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/secret"
+	"PulseCheck/internal/tools"
+)
+
+const (
+	SessionKey = "xhs-session"
+)
+
+var (
+	ErrSessionExpired = errors.New("xiaohongshu session expired")
+)
+
+// AlertFunc is told when the session of a shop turns invalid, once per expiry.
+type AlertFunc func(ctx context.Context, status *Status)
+
+type Status struct {
+	ShopID      string    `json:"shop_id"`
+	Valid       bool      `json:"valid"`
+	Reason      string    `json:"reason,omitempty"`
+	ExpiredAt   time.Time `json:"expired_at,omitempty"`
+	RefreshedAt time.Time `json:"refreshed_at,omitempty"`
+}
+
+// Session tracks whether the xiaohongshu token of a shop still works. Once an auth-expired
+// response is seen it refuses every further call until a new token or cookie is refreshed.
+//
+// Session is a secret.Provider as well, the refreshed token and cookie take precedence over the
+// ones of the underlying provider.
+type Session struct {
+	secrets   secret.Provider
+	status    Status
+	overrides map[string]string
+	alerts    []AlertFunc
+	mu        sync.RWMutex
+}
+
+func New(shopID string, secrets secret.Provider) *Session {
+	return &Session{
+		secrets:   secrets,
+		status:    Status{ShopID: shopID, Valid: true},
+		overrides: map[string]string{},
+	}
+}
+
+// OnExpired registers fn to be told when the session expires.
+func (this *Session) OnExpired(fn AlertFunc) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.alerts = append(this.alerts, fn)
+}
+
+func (this *Session) Get(ctx context.Context, name string) (string, error) {
+	this.mu.RLock()
+	value, ok := this.overrides[name]
+	this.mu.RUnlock()
+	if ok {
+		return value, nil
+	}
+	return this.secrets.Get(ctx, name)
+}
+
+// Check returns ErrSessionExpired if the session is invalid, the call must not be made then.
+func (this *Session) Check() error {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	if this.status.Valid {
+		return nil
+	}
+	return errors.WithMessagef(ErrSessionExpired, "shopId:%s since:%s reason:%s",
+		this.status.ShopID, this.status.ExpiredAt.Format(time.DateTime), this.status.Reason)
+}
+
+func (this *Session) Status() *Status {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	status := this.status
+	return &status
+}
+
+// Invalidate marks the session expired, the alerts are only sent on the first call.
+func (this *Session) Invalidate(ctx context.Context, reason string) {
+	this.mu.Lock()
+	if !this.status.Valid {
+		this.mu.Unlock()
+		return
+	}
+	this.status.Valid = false
+	this.status.Reason = reason
+	this.status.ExpiredAt = time.Now()
+	status := this.status
+	alerts := append([]AlertFunc(nil), this.alerts...)
+	this.mu.Unlock()
+
+	slog.Error("xiaohongshu session expired, calls are stopped until it is refreshed.",
+		slog.String("shopId", status.ShopID), slog.String("reason", reason))
+	for _, alert := range alerts {
+		alert(ctx, &status)
+	}
+}
+
+// Refresh replaces the token and/or the cookie template and makes the session valid again.
+func (this *Session) Refresh(ctx context.Context, token string, cookie string) error {
+	if len(token) == 0 && len(cookie) == 0 {
+		return errors.New("neither token nor cookie is given")
+	}
+	tools.RegisterSecret(token, cookie)
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if len(token) != 0 {
+		this.overrides[secret.XHSToken] = token
+	}
+	if len(cookie) != 0 {
+		this.overrides[secret.XHSCookie] = cookie
+	}
+	this.status.Valid = true
+	this.status.Reason = ""
+	this.status.RefreshedAt = time.Now()
+	slog.Info("xiaohongshu session refreshed.", slog.String("shopId", this.status.ShopID))
+	return nil
+}
+
+// ----------------------------------
+func AppendSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, SessionKey, session)
+}
+
+// WithdrawSession returns the session carried by ctx, nil if there is none.
+func WithdrawSession(ctx context.Context) *Session {
+	session, _ := ctx.Value(SessionKey).(*Session)
+	return session
+}
+
+// Check fails with ErrSessionExpired if the session of ctx is invalid, ctx without a session passes.
+func Check(ctx context.Context) error {
+	if session := WithdrawSession(ctx); session != nil {
+		return session.Check()
+	}
+	return nil
+}
+
+// Expire invalidates the session of ctx if err tells the session expired, err is returned as is.
+func Expire(ctx context.Context, err error) error {
+	if !errors.Is(err, ErrSessionExpired) {
+		return err
+	}
+	if session := WithdrawSession(ctx); session != nil {
+		session.Invalidate(ctx, err.Error())
+	}
+	return err
+}
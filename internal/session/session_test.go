@@ -0,0 +1,54 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/secret"
+)
+
+func TestSession(t *testing.T) {
+	ctx := context.Background()
+	s := New("main", secret.Static{secret.XHSToken: "AT-old-token"})
+	alerts := 0
+	s.OnExpired(func(ctx context.Context, status *Status) {
+		alerts++
+	})
+	ctx = AppendSession(ctx, s)
+	if err := Check(ctx); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+
+	// errors other than expiry leave the session valid
+	Expire(ctx, errors.New("msg:risk control"))
+	if err := Check(ctx); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		Expire(ctx, errors.WithMessagef(ErrSessionExpired, "code:-100"))
+	}
+	if err := Check(ctx); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Check() error = %v, wantErr %v", err, ErrSessionExpired)
+	}
+	if alerts != 1 {
+		t.Errorf("alerts = %d, want 1", alerts)
+	}
+
+	if err := s.Refresh(ctx, "", ""); err == nil {
+		t.Errorf("Refresh() error = nil, want error")
+	}
+	if err := s.Refresh(ctx, "AT-new-token", ""); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if err := Check(ctx); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	if got, _ := s.Get(ctx, secret.XHSToken); got != "AT-new-token" {
+		t.Errorf("Get() got = %v, want AT-new-token", got)
+	}
+	if _, err := s.Get(ctx, secret.XHSCookie); !errors.Is(err, secret.ErrNotFound) {
+		t.Errorf("Get() error = %v, wantErr %v", err, secret.ErrNotFound)
+	}
+}
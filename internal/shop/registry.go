@@ -0,0 +1,240 @@
+package shop
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/catalog"
+	"PulseCheck/internal/config"
+	"PulseCheck/internal/secret"
+	"PulseCheck/internal/session"
+	"PulseCheck/internal/task/review"
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsreq"
+)
+
+const (
+	ShopIDKey = "shop-id"
+)
+
+var (
+	ErrUnknownShop = errors.New("unknown shop")
+)
+
+// Shop is a xiaohongshu store served by the process, along with everything replying its reviews needs.
+type Shop struct {
+	ID   string
+	Name string
+	// Secrets holds the token, cookie and llm key of the shop, it is the Session so that a refreshed
+	// token is picked up
+	Secrets secret.Provider
+	// Session tracks whether the token of the shop still works
+	Session *session.Session
+	// XHSClient calls xiaohongshu, only the idempotent requests are retried, all of them are throttled
+	XHSClient     *http.Client
+	XHSBaseURL    string
+	Catalog       *catalog.Catalog
+	ApprovalQueue *review.ApprovalQueue
+	Generator     *xhsreq.ReplyGeneratorConfig
+	// Classifier the LLM tagging the reviews, nil if they are tagged by the keywords only
+	Classifier *xhsreq.ReplyGeneratorConfig
+	Policy     *review.ApprovalPolicy
+	// Guardrail checks the replies against the banned words and the forbidden claims of the catalog
+	Guardrail *review.Guardrail
+	// Routing escalates the negative reviews, nil if every review is replied automatically
+	Routing *review.RoutingPolicy
+	// FollowUps keeps the after-sales follow-ups of the escalated reviews, nil if none is opened
+	FollowUps *review.FollowUpQueue
+	// Appeals keeps the appeal candidates, nil if no review is flagged
+	Appeals        *review.AppealQueue
+	AppealDetector *review.AppealDetector
+	Cron           config.CronConfig
+}
+
+// Context carries the secrets and id of the shop, so that the requests made with it are
+// authorized as the shop.
+func (this *Shop) Context(ctx context.Context) context.Context {
+	ctx = secret.AppendProvider(ctx, this.Secrets)
+	ctx = session.AppendSession(ctx, this.Session)
+	return context.WithValue(ctx, ShopIDKey, this.ID)
+}
+
+// ReviewManager searches the reviews of the shop.
+func (this *Shop) ReviewManager(ctx context.Context) *xhsreq.ReviewManager {
+	return xhsreq.NewReviewManager(ctx, this.XHSClient, xhsreq.WithBaseURL(this.XHSBaseURL))
+}
+
+// ReviewReply posts the replies of the shop.
+func (this *Shop) ReviewReply(ctx context.Context) *xhsreq.ReviewReply {
+	return xhsreq.NewReviewReply(ctx, this.XHSClient, xhsreq.WithBaseURL(this.XHSBaseURL))
+}
+
+// WithdrawShopID returns the id of the shop ctx is bound to, empty if none.
+func WithdrawShopID(ctx context.Context) string {
+	id, _ := ctx.Value(ShopIDKey).(string)
+	return id
+}
+
+// ----------------------------------
+// Registry holds the shops in the order of the configuration, the first one is the default.
+type Registry struct {
+	shops []*Shop
+	index map[string]*Shop
+}
+
+func NewRegistry(ctx context.Context, conf *config.Config, secrets secret.Provider) (*Registry, error) {
+	registry := &Registry{index: map[string]*Shop{}}
+	// shops sharing a catalog file share the catalog, otherwise an edit through one of them
+	// would be overwritten by the other
+	catalogs := map[string]*catalog.Catalog{}
+	// the limits of a host are shared by all the shops, on top of the limit of every shop
+	hostLimiter := tools.NewRateLimiter(conf.HTTP.HostLimits())
+	for _, shopConf := range conf.ShopList() {
+		productCatalog, ok := catalogs[shopConf.Catalog]
+		if !ok {
+			c, err := catalog.NewCatalog(shopConf.Catalog)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "load catalog of shop:%s error.", shopConf.ID)
+			}
+			productCatalog = c
+			catalogs[shopConf.Catalog] = c
+		}
+		queue, err := review.NewApprovalQueue(shopConf.ApprovalQueue)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "load approval queue of shop:%s error.", shopConf.ID)
+		}
+		var followUps *review.FollowUpQueue
+		if conf.Escalation.Enabled && conf.Escalation.FollowUp {
+			followUps, err = review.NewFollowUpQueue(shopConf.FollowUps)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "load follow-up queue of shop:%s error.", shopConf.ID)
+			}
+		}
+		var appeals *review.AppealQueue
+		if conf.Appeal.Enabled {
+			appeals, err = review.NewAppealQueue(shopConf.Appeals)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "load appeal queue of shop:%s error.", shopConf.ID)
+			}
+		}
+		var shopSecrets secret.Provider = secrets
+		if len(shopConf.SecretPrefix) != 0 {
+			shopSecrets = secret.NewPrefixed(secrets, shopConf.SecretPrefix)
+		}
+		shopSession := session.New(shopConf.ID, shopSecrets)
+		shopLimiter := tools.NewRateLimiter(map[string]tools.Limit{xhsreq.XiaohongshuDomain: shopConf.RateLimit.Limit()})
+		xhsOptions := append(conf.HTTP.Options(), tools.WithIdempotentPOSTOnly(), tools.WithRateLimit(hostLimiter, shopLimiter))
+		shop := &Shop{
+			ID:            shopConf.ID,
+			Name:          shopConf.Name,
+			Secrets:       shopSession,
+			Session:       shopSession,
+			XHSClient:     tools.NewHttpsClient(xhsreq.XiaohongshuDomain, xhsOptions...),
+			XHSBaseURL:    conf.Xiaohongshu.BaseURL,
+			Catalog:       productCatalog,
+			ApprovalQueue: queue,
+			Generator: &xhsreq.ReplyGeneratorConfig{
+				Backend:      xhsreq.GeneratorBackend(shopConf.LLM.Backend),
+				URL:          shopConf.LLM.URL,
+				APIKey:       shopConf.LLM.APIKey,
+				Model:        shopConf.LLM.Model,
+				SystemPrompt: shopConf.LLM.SystemPrompt,
+				OutputKey:    shopConf.LLM.OutputKey,
+				ResponseMode: xhsreq.ResponseMode(shopConf.LLM.ResponseMode),
+				Timeout:      shopConf.LLM.Timeout,
+				Secrets:      shopSession,
+				HTTPOptions:  append(conf.HTTP.Options(), tools.WithRateLimit(hostLimiter)),
+			},
+			Classifier: classifierConfig(conf, shopSession, hostLimiter),
+			Policy: &review.ApprovalPolicy{
+				AutoApproveMinSkuScore: shopConf.Policy.AutoApproveMinSkuScore,
+				MandatoryMaxSkuScore:   shopConf.Policy.MandatoryMaxSkuScore,
+			},
+			Guardrail: &review.Guardrail{
+				MinLength:   conf.Guardrail.MinLength,
+				MaxLength:   conf.Guardrail.MaxLength,
+				BannedWords: conf.Guardrail.BannedWords,
+				Catalog:     productCatalog,
+			},
+			Routing:   routingPolicy(conf),
+			FollowUps: followUps,
+			Appeals:   appeals,
+			AppealDetector: &review.AppealDetector{
+				Keywords: appealKeywords(conf.Appeal.Keywords),
+			},
+			Cron: shopConf.Cron,
+		}
+		registry.shops = append(registry.shops, shop)
+		registry.index[shop.ID] = shop
+		slog.Info("shop registered.", slog.String("id", shop.ID), slog.String("name", shop.Name),
+			slog.String("cron", shop.Cron.Spec), slog.String("backend", shopConf.LLM.Backend))
+	}
+	return registry, nil
+}
+
+// Get returns the shop of id, the default one if id is empty.
+func (this *Registry) Get(id string) (*Shop, error) {
+	if len(id) == 0 {
+		return this.shops[0], nil
+	}
+	shop, ok := this.index[id]
+	if !ok {
+		return nil, errors.WithMessagef(ErrUnknownShop, "shopId:%s", id)
+	}
+	return shop, nil
+}
+
+func (this *Registry) List() []*Shop {
+	return append([]*Shop(nil), this.shops...)
+}
+
+// GroupByCron groups the shops by their cron spec, so that the shops scheduled at the same time
+// are replied together.
+func (this *Registry) GroupByCron() map[string][]*Shop {
+	groups := map[string][]*Shop{}
+	for _, shop := range this.shops {
+		groups[shop.Cron.Spec] = append(groups[shop.Cron.Spec], shop)
+	}
+	return groups
+}
+
+// routingPolicy returns nil if the escalation is disabled.
+func routingPolicy(conf *config.Config) *review.RoutingPolicy {
+	if !conf.Escalation.Enabled {
+		return nil
+	}
+	return &review.RoutingPolicy{EscalateMaxSkuScore: uint8(conf.Escalation.MaxSkuScore)}
+}
+
+// appealKeywords converts the keywords configured by the reason names.
+func appealKeywords(keywords map[string][]string) map[xhsreq.AppealReason][]string {
+	converted := make(map[xhsreq.AppealReason][]string, len(keywords))
+	for name, words := range keywords {
+		if reason, ok := xhsreq.AppealReasonNames[name]; ok {
+			converted[reason] = words
+		}
+	}
+	return converted
+}
+
+// classifierConfig returns nil if no LLM classifies the reviews, the api key falls back to the
+// llm_key of the shop.
+func classifierConfig(conf *config.Config, secrets secret.Provider, hostLimiter *tools.RateLimiter) *xhsreq.ReplyGeneratorConfig {
+	classifier := conf.Classifier
+	if len(classifier.Backend) == 0 {
+		return nil
+	}
+	return &xhsreq.ReplyGeneratorConfig{
+		Backend:      xhsreq.GeneratorBackend(classifier.Backend),
+		URL:          classifier.URL,
+		APIKey:       classifier.APIKey,
+		Model:        classifier.Model,
+		SystemPrompt: classifier.SystemPrompt,
+		Timeout:      classifier.Timeout,
+		Secrets:      secrets,
+		HTTPOptions:  append(conf.HTTP.Options(), tools.WithRateLimit(hostLimiter)),
+	}
+}
@@ -0,0 +1,75 @@
+package shop
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/config"
+	"PulseCheck/internal/secret"
+)
+
+func TestNewRegistry(t *testing.T) {
+	dir := t.TempDir()
+	conf := config.Default()
+	conf.Storage.Catalog = filepath.Join(dir, "catalog.yaml")
+	conf.Storage.ApprovalQueue = filepath.Join(dir, "approval.json")
+	conf.Shops = []*config.ShopConfig{
+		{ID: "main"},
+		{ID: "second", SecretPrefix: "second_", Cron: config.CronConfig{Spec: "0 12 * * ?"}},
+		{ID: "third", SecretPrefix: "third_"},
+	}
+	secrets := secret.Static{secret.XHSToken: "AT-main-token", "second_" + secret.XHSToken: "AT-second-token"}
+	registry, err := NewRegistry(context.Background(), conf, secrets)
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	main, err := registry.Get("")
+	if err != nil || main.ID != "main" {
+		t.Fatalf("Get() got = %v, error = %v, want the first shop", main, err)
+	}
+	second, _ := registry.Get("second")
+	third, _ := registry.Get("third")
+	if _, err = registry.Get("unknown"); !errors.Is(err, ErrUnknownShop) {
+		t.Errorf("Get() error = %v, wantErr %v", err, ErrUnknownShop)
+	}
+	if main.Catalog != second.Catalog {
+		t.Errorf("shops sharing the catalog file must share the catalog")
+	}
+	if main.ApprovalQueue == second.ApprovalQueue {
+		t.Errorf("every shop must have an approval queue of its own")
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		shop    *Shop
+		want    string
+		wantErr bool
+	}{
+		{name: "main", shop: main, want: "AT-main-token"},
+		{name: "second", shop: second, want: "AT-second-token"},
+		// the token of the other shops must never be used
+		{name: "third", shop: third, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := secret.WithdrawProvider(tt.shop.Context(ctx)).Get(ctx, secret.XHSToken)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Get() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	groups := registry.GroupByCron()
+	if len(groups) != 2 || len(groups["0 12 * * ?"]) != 1 || len(groups[conf.Cron.Spec]) != 2 {
+		t.Errorf("GroupByCron() got = %v", groups)
+	}
+}
@@ -0,0 +1,313 @@
+// Package smtpfake is an in-process stand-in of a smtp server speaking STARTTLS or implicit TLS, it
+// records the messages it is sent so that the email notifications can be tested without a mailbox.
+package smtpfake
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"math/big"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/tools"
+)
+
+// Message is a message received by the fake.
+type Message struct {
+	From       string
+	To         []string
+	Data       []byte
+	ReceivedAt time.Time
+}
+
+// Header returns the decoded header of the message, empty if it is missing.
+func (this *Message) Header(name string) string {
+	message, err := mail.ReadMessage(bytes.NewReader(this.Data))
+	if err != nil {
+		return ""
+	}
+	value := message.Header.Get(name)
+	decoded, err := new(mime.WordDecoder).DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// Body returns the decoded body of the message.
+func (this *Message) Body() string {
+	message, err := mail.ReadMessage(bytes.NewReader(this.Data))
+	if err != nil {
+		return ""
+	}
+	var reader io.Reader = message.Body
+	if strings.EqualFold(message.Header.Get("Content-Transfer-Encoding"), "base64") {
+		reader = base64.NewDecoder(base64.StdEncoding, message.Body)
+	}
+	b, _ := io.ReadAll(reader)
+	return string(b)
+}
+
+// Server accepts every message, authenticated by AUTH PLAIN if SetAuth is called. A plain server
+// offers STARTTLS, both are served by a self-signed certificate trusted by CertPool.
+type Server struct {
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	certPool    *x509.CertPool
+	implicitTLS bool
+	username    string
+	password    string
+	messages    []*Message
+	onMessage   func(message *Message)
+	mu          sync.Mutex
+	wg          sync.WaitGroup
+}
+
+func New() (*Server, error) {
+	certificate, certPool, err := selfSigned()
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12},
+		certPool:  certPool,
+	}, nil
+}
+
+// SetAuth requires the clients to authenticate by the username and password.
+func (this *Server) SetAuth(username string, password string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.username, this.password = username, password
+}
+
+// OnMessage calls fn with every message received.
+func (this *Server) OnMessage(fn func(message *Message)) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.onMessage = fn
+}
+
+// Start serves plain smtp offering STARTTLS on addr, 127.0.0.1:0 picks a free port.
+func (this *Server) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.WithMessagef(err, "listen on:%s error.", addr)
+	}
+	return this.serve(listener, false)
+}
+
+// StartTLS serves smtp over implicit TLS on addr, the way port 465 does.
+func (this *Server) StartTLS(addr string) error {
+	listener, err := tls.Listen("tcp", addr, this.tlsConfig)
+	if err != nil {
+		return errors.WithMessagef(err, "listen on:%s error.", addr)
+	}
+	return this.serve(listener, true)
+}
+
+func (this *Server) serve(listener net.Listener, implicitTLS bool) error {
+	this.listener = listener
+	this.implicitTLS = implicitTLS
+	this.wg.Add(1)
+	go func() {
+		defer this.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			this.wg.Add(1)
+			go func() {
+				defer this.wg.Done()
+				this.session(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// Addr returns the host:port the server listens on.
+func (this *Server) Addr() string {
+	return this.listener.Addr().String()
+}
+
+// CertPool trusts the certificate of the server.
+func (this *Server) CertPool() *x509.CertPool {
+	return this.certPool
+}
+
+func (this *Server) Close() error {
+	err := this.listener.Close()
+	this.wg.Wait()
+	return err
+}
+
+// Messages returns the messages received.
+func (this *Server) Messages() []*Message {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return append([]*Message(nil), this.messages...)
+}
+
+func (this *Server) session(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	_ = conn.SetDeadline(time.Now().Add(time.Minute))
+	text := textproto.NewConn(conn)
+	secured := this.implicitTLS
+	authenticated := false
+	from, to := "", make([]string, 0)
+	reply := func(format string, args ...any) {
+		_ = text.PrintfLine(format, args...)
+	}
+	reply("220 smtpfake ESMTP ready")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		this.mu.Lock()
+		username, password := this.username, this.password
+		this.mu.Unlock()
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250-smtpfake")
+			if !secured {
+				reply("250-STARTTLS")
+			}
+			reply("250-AUTH PLAIN")
+			reply("250 8BITMIME")
+		case "STARTTLS":
+			if secured {
+				reply("503 TLS already active")
+				continue
+			}
+			reply("220 ready to start TLS")
+			tlsConn := tls.Server(conn, this.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				slog.Error("smtpfake tls handshake error.", tools.ErrAttr(err))
+				return
+			}
+			conn, text, secured = tlsConn, textproto.NewConn(tlsConn), true
+		case "AUTH":
+			mechanism, response, _ := strings.Cut(arg, " ")
+			if !strings.EqualFold(mechanism, "PLAIN") {
+				reply("504 unrecognized authentication type")
+				continue
+			}
+			if len(response) == 0 {
+				reply("334 ")
+				if response, err = text.ReadLine(); err != nil {
+					return
+				}
+			}
+			credentials, err := base64.StdEncoding.DecodeString(response)
+			parts := strings.Split(string(credentials), "\x00")
+			if err != nil || len(parts) != 3 || parts[1] != username || parts[2] != password {
+				reply("535 authentication failed")
+				continue
+			}
+			authenticated = true
+			reply("235 authentication succeeded")
+		case "MAIL":
+			if len(username) != 0 && !authenticated {
+				reply("530 authentication required")
+				continue
+			}
+			from, to = address(arg), make([]string, 0)
+			reply("250 ok")
+		case "RCPT":
+			to = append(to, address(arg))
+			reply("250 ok")
+		case "DATA":
+			if len(from) == 0 || len(to) == 0 {
+				reply("503 need MAIL and RCPT first")
+				continue
+			}
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message := &Message{From: from, To: to, Data: data, ReceivedAt: time.Now()}
+			this.mu.Lock()
+			this.messages = append(this.messages, message)
+			onMessage := this.onMessage
+			this.mu.Unlock()
+			if onMessage != nil {
+				onMessage(message)
+			}
+			from, to = "", make([]string, 0)
+			reply("250 ok queued")
+		case "RSET":
+			from, to = "", make([]string, 0)
+			reply("250 ok")
+		case "NOOP":
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// address returns the address of "FROM:<a@b.c>" or "TO:<a@b.c>".
+func address(arg string) string {
+	_, value, _ := strings.Cut(arg, ":")
+	value = strings.TrimSpace(value)
+	if start, end := strings.Index(value, "<"), strings.Index(value, ">"); start >= 0 && end > start {
+		return value[start+1 : end]
+	}
+	return value
+}
+
+// selfSigned returns a certificate of localhost and 127.0.0.1 along with the pool trusting it.
+func selfSigned() (tls.Certificate, *x509.CertPool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, errors.WithMessagef(err, "generate key error.")
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "smtpfake"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, errors.WithMessagef(err, "create certificate error.")
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, errors.WithMessagef(err, "parse certificate error.")
+	}
+	certPool := x509.NewCertPool()
+	certPool.AddCert(certificate)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: certificate}, certPool, nil
+}
@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"PulseCheck/internal/xhsreq"
+)
+
+var (
+	reviewBucket  = []byte("reviews")
+	replyBucket   = []byte("replies")
+	attemptBucket = []byte("attempts")
+	runBucket     = []byte("runs")
+	ledgerBucket  = []byte("replied")
+)
+
+const (
+	keySeparator = "/"
+)
+
+// reviewKey groups the records of a review together, ordered by the suffix.
+func reviewKey(reviewID string, suffix uint64) []byte {
+	return append([]byte(reviewID+keySeparator), itob(suffix)...)
+}
+
+func reviewPrefix(reviewID string) []byte {
+	return []byte(reviewID + keySeparator)
+}
+
+// ----------------------------------
+type ReviewRecord struct {
+	Review    *xhsreq.Review `json:"review"`
+	RunID     uint64         `json:"run_id"`
+	FetchedAt time.Time      `json:"fetched_at"`
+}
+
+type ReviewRepository struct {
+	db *bolt.DB
+}
+
+// Save keeps the latest fetched version of the reviews.
+func (this *ReviewRepository) Save(ctx context.Context, reviews ...*xhsreq.Review) error {
+	runID := WithdrawRunID(ctx)
+	now := time.Now()
+	return this.db.Update(func(tx *bolt.Tx) error {
+		for _, review := range reviews {
+			record := &ReviewRecord{Review: review, RunID: runID, FetchedAt: now}
+			if err := put(tx, reviewBucket, []byte(review.Id), record); err != nil {
+				return errors.WithMessagef(err, "save review:%s error.", review.Id)
+			}
+		}
+		return nil
+	})
+}
+
+func (this *ReviewRepository) Get(reviewID string) (*ReviewRecord, error) {
+	record := &ReviewRecord{}
+	err := this.db.View(func(tx *bolt.Tx) error {
+		return get(tx, reviewBucket, []byte(reviewID), record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// ListSince returns the reviews created since the time, in no particular order.
+func (this *ReviewRepository) ListSince(since time.Time) (records []*ReviewRecord, err error) {
+	err = this.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(reviewBucket).ForEach(func(k, v []byte) error {
+			record := &ReviewRecord{}
+			if err := json.Unmarshal(v, record); err != nil {
+				return errors.WithMessagef(err, "unmarshal review:%s error.", k)
+			}
+			if record.Review != nil && !record.Review.CreateTime.Before(since) {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+	return records, err
+}
+
+// ----------------------------------
+type ReplyRecord struct {
+	ReviewID      string    `json:"review_id"`
+	ReviewContent string    `json:"review_content"`
+	ReplyContent  string    `json:"reply_content"`
+	RunID         uint64    `json:"run_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ReplyRepository keeps every reply generated by the LLM.
+type ReplyRepository struct {
+	db *bolt.DB
+}
+
+func (this *ReplyRepository) Save(ctx context.Context, record *ReplyRecord) error {
+	record.RunID = WithdrawRunID(ctx)
+	record.CreatedAt = time.Now()
+	return this.db.Update(func(tx *bolt.Tx) error {
+		id, err := tx.Bucket(replyBucket).NextSequence()
+		if err != nil {
+			return errors.WithMessagef(err, "next reply sequence error.")
+		}
+		return put(tx, replyBucket, reviewKey(record.ReviewID, id), record)
+	})
+}
+
+// ListByReview returns the generated replies of the review, the newest first.
+func (this *ReplyRepository) ListByReview(reviewID string) (records []*ReplyRecord, err error) {
+	err = this.db.View(func(tx *bolt.Tx) error {
+		records, err = list[ReplyRecord](tx, replyBucket, reviewPrefix(reviewID), 0)
+		return err
+	})
+	return records, err
+}
+
+// ----------------------------------
+type ReplyAttempt struct {
+	Id           uint64    `json:"id"`
+	ReviewID     string    `json:"review_id"`
+	ReplyContent string    `json:"reply_content"`
+	Success      bool      `json:"success"`
+	Error        string    `json:"error,omitempty"`
+	RunID        uint64    `json:"run_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AttemptRepository keeps every try of posting a reply to xiaohongshu.
+type AttemptRepository struct {
+	db *bolt.DB
+}
+
+func (this *AttemptRepository) Save(ctx context.Context, attempt *ReplyAttempt) error {
+	attempt.RunID = WithdrawRunID(ctx)
+	attempt.CreatedAt = time.Now()
+	return this.db.Update(func(tx *bolt.Tx) error {
+		id, err := tx.Bucket(attemptBucket).NextSequence()
+		if err != nil {
+			return errors.WithMessagef(err, "next attempt sequence error.")
+		}
+		attempt.Id = id
+		return put(tx, attemptBucket, reviewKey(attempt.ReviewID, id), attempt)
+	})
+}
+
+// ListByReview returns the reply attempts of the review, the newest first.
+func (this *AttemptRepository) ListByReview(reviewID string) (attempts []*ReplyAttempt, err error) {
+	err = this.db.View(func(tx *bolt.Tx) error {
+		attempts, err = list[ReplyAttempt](tx, attemptBucket, reviewPrefix(reviewID), 0)
+		return err
+	})
+	return attempts, err
+}
+
+// ListSince returns the reply attempts made since the time, in no particular order.
+func (this *AttemptRepository) ListSince(since time.Time) (attempts []*ReplyAttempt, err error) {
+	err = this.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(attemptBucket).ForEach(func(k, v []byte) error {
+			attempt := &ReplyAttempt{}
+			if err := json.Unmarshal(v, attempt); err != nil {
+				return errors.WithMessagef(err, "unmarshal attempt:%s error.", k)
+			}
+			if !attempt.CreatedAt.Before(since) {
+				attempts = append(attempts, attempt)
+			}
+			return nil
+		})
+	})
+	return attempts, err
+}
+
+// ListByRun returns the reply attempts made by the run, in no particular order.
+func (this *AttemptRepository) ListByRun(runID uint64) (attempts []*ReplyAttempt, err error) {
+	err = this.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(attemptBucket).ForEach(func(k, v []byte) error {
+			attempt := &ReplyAttempt{}
+			if err := json.Unmarshal(v, attempt); err != nil {
+				return errors.WithMessagef(err, "unmarshal attempt:%s error.", k)
+			}
+			if attempt.RunID == runID {
+				attempts = append(attempts, attempt)
+			}
+			return nil
+		})
+	})
+	return attempts, err
+}
+
+// ----------------------------------
+type RepliedReview struct {
+	ReviewID     string    `json:"review_id"`
+	ReplyContent string    `json:"reply_content"`
+	RunID        uint64    `json:"run_id"`
+	RepliedAt    time.Time `json:"replied_at"`
+}
+
+// LedgerRepository keeps the ids of the reviews replied successfully, a review in the ledger
+// is never replied again.
+type LedgerRepository struct {
+	db *bolt.DB
+}
+
+func (this *LedgerRepository) Mark(ctx context.Context, reviewID string, replyContent string) error {
+	record := &RepliedReview{
+		ReviewID:     reviewID,
+		ReplyContent: replyContent,
+		RunID:        WithdrawRunID(ctx),
+		RepliedAt:    time.Now(),
+	}
+	return this.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, ledgerBucket, []byte(reviewID), record)
+	})
+}
+
+func (this *LedgerRepository) Replied(reviewID string) (bool, error) {
+	var replied bool
+	err := this.db.View(func(tx *bolt.Tx) error {
+		replied = tx.Bucket(ledgerBucket).Get([]byte(reviewID)) != nil
+		return nil
+	})
+	return replied, err
+}
+
+func (this *LedgerRepository) Get(reviewID string) (*RepliedReview, error) {
+	record := &RepliedReview{}
+	err := this.db.View(func(tx *bolt.Tx) error {
+		return get(tx, ledgerBucket, []byte(reviewID), record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// ----------------------------------
+type TaskRun struct {
+	Id         uint64    `json:"id"`
+	Name       string    `json:"name"`
+	DryRun     bool      `json:"dry_run"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type RunRepository struct {
+	db *bolt.DB
+}
+
+// Start records a new run, the returned context carries its id for the records saved during the run.
+func (this *RunRepository) Start(ctx context.Context, name string, dryRun bool) (context.Context, *TaskRun, error) {
+	run := &TaskRun{Name: name, DryRun: dryRun, StartedAt: time.Now()}
+	err := this.db.Update(func(tx *bolt.Tx) error {
+		id, err := tx.Bucket(runBucket).NextSequence()
+		if err != nil {
+			return errors.WithMessagef(err, "next run sequence error.")
+		}
+		run.Id = id
+		return put(tx, runBucket, itob(id), run)
+	})
+	if err != nil {
+		return ctx, nil, err
+	}
+	return AppendRunID(ctx, run.Id), run, nil
+}
+
+func (this *RunRepository) Finish(run *TaskRun, runErr error) error {
+	run.FinishedAt = time.Now()
+	if runErr != nil {
+		run.Error = runErr.Error()
+	}
+	return this.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, runBucket, itob(run.Id), run)
+	})
+}
+
+// List returns the latest runs, the newest first.
+func (this *RunRepository) List(limit int) (runs []*TaskRun, err error) {
+	err = this.db.View(func(tx *bolt.Tx) error {
+		runs, err = list[TaskRun](tx, runBucket, nil, limit)
+		return err
+	})
+	return runs, err
+}
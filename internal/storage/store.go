@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	RunID = "run-id"
+
+	openTimeout = 3 * time.Second
+)
+
+var (
+	ErrNotFound = errors.New("record not found")
+)
+
+// Store keeps the reviews, replies, reply attempts, replied ledger and task runs in a local bolt file.
+type Store struct {
+	db       *bolt.DB
+	reviews  *ReviewRepository
+	replies  *ReplyRepository
+	attempts *AttemptRepository
+	runs     *RunRepository
+	ledger   *LedgerRepository
+}
+
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, errors.WithMessagef(err, "create dir of store:%s error.", path)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, errors.WithMessagef(err, "open store:%s error.", path)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{reviewBucket, replyBucket, attemptBucket, runBucket, ledgerBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return errors.WithMessagef(err, "create bucket:%s error.", bucket)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{
+		db:       db,
+		reviews:  &ReviewRepository{db: db},
+		replies:  &ReplyRepository{db: db},
+		attempts: &AttemptRepository{db: db},
+		runs:     &RunRepository{db: db},
+		ledger:   &LedgerRepository{db: db},
+	}, nil
+}
+
+func (this *Store) Close() error {
+	return this.db.Close()
+}
+
+func (this *Store) Reviews() *ReviewRepository {
+	return this.reviews
+}
+
+func (this *Store) Replies() *ReplyRepository {
+	return this.replies
+}
+
+func (this *Store) Attempts() *AttemptRepository {
+	return this.attempts
+}
+
+func (this *Store) Runs() *RunRepository {
+	return this.runs
+}
+
+func (this *Store) Ledger() *LedgerRepository {
+	return this.ledger
+}
+
+// AppendRunID ties the records saved with ctx to the task run.
+func AppendRunID(ctx context.Context, runID uint64) context.Context {
+	return context.WithValue(ctx, RunID, runID)
+}
+
+func WithdrawRunID(ctx context.Context) uint64 {
+	runID, _ := ctx.Value(RunID).(uint64)
+	return runID
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func put(tx *bolt.Tx, bucket []byte, key []byte, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.WithMessagef(err, "marshal record of bucket:%s error.", bucket)
+	}
+	return tx.Bucket(bucket).Put(key, b)
+}
+
+func get(tx *bolt.Tx, bucket []byte, key []byte, v any) error {
+	b := tx.Bucket(bucket).Get(key)
+	if b == nil {
+		return errors.WithMessagef(ErrNotFound, "bucket:%s key:%s", bucket, key)
+	}
+	return json.Unmarshal(b, v)
+}
+
+// list decodes the records under prefix from the newest key to the oldest one, at most limit
+// records are returned if limit is positive.
+func list[T any](tx *bolt.Tx, bucket []byte, prefix []byte, limit int) ([]*T, error) {
+	c := tx.Bucket(bucket).Cursor()
+	values := make([][]byte, 0)
+	if len(prefix) == 0 {
+		for k, v := c.Last(); k != nil && (limit <= 0 || len(values) < limit); k, v = c.Prev() {
+			values = append(values, v)
+		}
+	} else {
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			values = append(values, v)
+		}
+		slices.Reverse(values)
+		if limit > 0 && len(values) > limit {
+			values = values[:limit]
+		}
+	}
+	records := make([]*T, 0, len(values))
+	for _, v := range values {
+		record := new(T)
+		if err := json.Unmarshal(v, record); err != nil {
+			return nil, errors.WithMessagef(err, "unmarshal record of bucket:%s error.", bucket)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
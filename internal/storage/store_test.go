@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/xhsreq"
+)
+
+func TestStore_History(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close()
+
+	ctx, run, err := store.Runs().Start(context.Background(), "test", false)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	review := &xhsreq.Review{Id: "414154303596118952", Content: "包装特别烂"}
+	if err = store.Reviews().Save(ctx, review); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	for _, reply := range []string{"first", "second"} {
+		err = store.Replies().Save(ctx, &ReplyRecord{ReviewID: review.Id, ReplyContent: reply})
+		if err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	// a review id sharing the prefix must not be listed
+	if err = store.Attempts().Save(ctx, &ReplyAttempt{ReviewID: review.Id + "0", Success: true}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err = store.Attempts().Save(ctx, &ReplyAttempt{ReviewID: review.Id, Error: "msg:risk control"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err = store.Runs().Finish(run, nil); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+
+	record, err := store.Reviews().Get(review.Id)
+	if err != nil || record.Review.Content != review.Content || record.RunID != run.Id {
+		t.Errorf("Get() got = %#v, error = %v", record, err)
+	}
+	if _, err = store.Reviews().Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, ErrNotFound)
+	}
+	replies, err := store.Replies().ListByReview(review.Id)
+	if err != nil || len(replies) != 2 || replies[0].ReplyContent != "second" {
+		t.Errorf("ListByReview() got = %v, error = %v", replies, err)
+	}
+	attempts, err := store.Attempts().ListByReview(review.Id)
+	if err != nil || len(attempts) != 1 || attempts[0].Success {
+		t.Errorf("ListByReview() got = %v, error = %v", attempts, err)
+	}
+	if attempts, err = store.Attempts().ListByRun(run.Id); err != nil || len(attempts) != 2 {
+		t.Errorf("ListByRun() got = %v, error = %v", attempts, err)
+	}
+	if attempts, err = store.Attempts().ListByRun(run.Id + 1); err != nil || len(attempts) != 0 {
+		t.Errorf("ListByRun() got = %v, error = %v", attempts, err)
+	}
+	runs, err := store.Runs().List(10)
+	if err != nil || len(runs) != 1 || runs[0].FinishedAt.IsZero() {
+		t.Errorf("List() got = %v, error = %v", runs, err)
+	}
+}
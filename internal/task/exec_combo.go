@@ -2,10 +2,13 @@ package task
 
 import (
 	"context"
+
+	"github.com/hashicorp/go-multierror"
 )
 
 type DataProvider[T any] interface {
-	// Provide need to close the channel internally after the task
+	// Provide need to close the channel internally after the task, a send must give up once ctx is
+	// done since nobody receives any more
 	Provide(ctx context.Context) (<-chan T, <-chan error)
 }
 
@@ -14,45 +17,66 @@ type DataHandler[T any] interface {
 }
 
 type Task[T any] struct {
-	provider      DataProvider[T]
-	filterManager FilterChain[T]
+	provider DataProvider[T]
+	handler  DataHandler[T]
+	filters  []Filter[T]
 }
 
 func NewTask[T any](provider DataProvider[T], handler DataHandler[T], filters ...Filter[T]) Executable {
 	return &Task[T]{
-		provider:      provider,
-		filterManager: NewFilterChainManager(handler, filters...),
+		provider: provider,
+		handler:  handler,
+		filters:  filters,
 	}
 }
 
+// Execute consumes the provider channels until both of them are closed. Every batch
+// goes through its own filter chain, errors of each batch and from the provider are
+// collected and returned together.
 func (this *Task[T]) Execute(ctx context.Context) error {
 	ch, errCh := this.provider.Provide(ctx)
-	var err error
-FOR_LOOP:
-	for {
+	var result error
+	for ch != nil || errCh != nil {
 		select {
 		case <-ctx.Done():
-			err = context.Cause(ctx)
-			if err != nil {
-				break FOR_LOOP
-			}
+			// a provider still blocked on a send is released, the batches left are dropped
+			go drain(ch, errCh)
+			return multierror.Append(result, context.Cause(ctx))
 		case data, open := <-ch:
-			if open {
-				err = this.filterManager.Proceed(ctx, &data)
-				break FOR_LOOP
-			} else {
+			if !open {
+				ch = nil
 				continue
 			}
-		case err1, open := <-errCh:
-			if open {
-				err = err1
-				break FOR_LOOP
-			} else {
+			// the chain manager keeps the filter index, so every batch needs a new one
+			err := NewFilterChainManager(this.handler, this.filters...).Proceed(ctx, &data)
+			if err != nil {
+				result = multierror.Append(result, err)
+			}
+		case err, open := <-errCh:
+			if !open {
+				errCh = nil
 				continue
 			}
+			result = multierror.Append(result, err)
+		}
+	}
+	return result
+}
+
+// drain receives from the channels until both of them are closed, a nil channel is skipped.
+func drain[T any](ch <-chan T, errCh <-chan error) {
+	for ch != nil || errCh != nil {
+		select {
+		case _, open := <-ch:
+			if !open {
+				ch = nil
+			}
+		case _, open := <-errCh:
+			if !open {
+				errCh = nil
+			}
 		}
 	}
-	return err
 }
 
 type Filter[T any] interface {
@@ -0,0 +1,116 @@
+package task
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type sliceProvider struct {
+	batches []int
+	errs    []error
+	// done is closed once the provider goroutine exits, if set
+	done chan struct{}
+}
+
+func (this *sliceProvider) Provide(ctx context.Context) (<-chan int, <-chan error) {
+	ch := make(chan int)
+	errCh := make(chan error)
+	go func() {
+		defer func() {
+			close(ch)
+			close(errCh)
+			if this.done != nil {
+				close(this.done)
+			}
+		}()
+		for _, batch := range this.batches {
+			ch <- batch
+		}
+		for _, err := range this.errs {
+			errCh <- err
+		}
+	}()
+	return ch, errCh
+}
+
+type recordHandler struct {
+	handled []int
+	failOn  int
+}
+
+func (this *recordHandler) Execute(ctx context.Context, data int) error {
+	this.handled = append(this.handled, data)
+	if data == this.failOn {
+		return errors.Errorf("handle %d failed", data)
+	}
+	return nil
+}
+
+type doubleFilter struct{}
+
+func (this *doubleFilter) DoFilter(ctx context.Context, data *int, chain FilterChain[int]) error {
+	*data = *data * 2
+	return chain.Proceed(ctx, data)
+}
+
+func TestTask_Execute(t *testing.T) {
+	tests := []struct {
+		name        string
+		provider    *sliceProvider
+		failOn      int
+		wantHandled []int
+		wantErr     bool
+	}{
+		{
+			name:        "all batches handled",
+			provider:    &sliceProvider{batches: []int{1, 2, 3}},
+			wantHandled: []int{2, 4, 6},
+		},
+		{
+			name:        "failed batch does not stop the rest",
+			provider:    &sliceProvider{batches: []int{1, 2, 3}},
+			failOn:      4,
+			wantHandled: []int{2, 4, 6},
+			wantErr:     true,
+		},
+		{
+			name:        "provider error collected",
+			provider:    &sliceProvider{batches: []int{1}, errs: []error{errors.New("provide failed")}},
+			wantHandled: []int{2},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &recordHandler{failOn: tt.failOn}
+			task := NewTask[int](tt.provider, handler, &doubleFilter{})
+			err := task.Execute(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(handler.handled, tt.wantHandled) {
+				t.Errorf("Execute() handled = %v, want %v", handler.handled, tt.wantHandled)
+			}
+		})
+	}
+}
+
+func TestTask_Execute_Canceled(t *testing.T) {
+	// the provider sends without watching ctx, it must not be left blocked
+	provider := &sliceProvider{batches: []int{1, 2, 3}, errs: []error{errors.New("provide failed")}, done: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := NewTask[int](provider, &recordHandler{}, &doubleFilter{}).Execute(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Execute() error = %v, want %v", err, context.Canceled)
+	}
+	select {
+	case <-provider.done:
+	case <-time.After(time.Second):
+		t.Fatal("provider goroutine leaked")
+	}
+}
@@ -0,0 +1,234 @@
+package review
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsreq"
+)
+
+var (
+	ErrAppealNotFound = errors.New("appeal not found")
+	ErrAppealHandled  = errors.New("appeal has been handled")
+)
+
+var (
+	// DefaultAppealKeywords flag the reviews worth appealing, the words are matched case-insensitively.
+	DefaultAppealKeywords = map[xhsreq.AppealReason][]string{
+		xhsreq.AppealReasonAbusive: {"傻逼", "煞笔", "脑残", "智障", "去死", "狗东西", "神经病", "妈的", "tmd", "nmsl", "垃圾店家"},
+		xhsreq.AppealReasonSpam: {"http://", "https://", "www.", "加微信", "加v", "vx:", "vx：", "私聊我", "代购", "刷单",
+			"兼职", "返利"},
+		xhsreq.AppealReasonCompetitor: {"来我店", "来我们店", "我们店铺", "我店有", "关注我的店", "同款更便宜", "别家更便宜", "隔壁店"},
+	}
+	// appealReasons are checked in order, the first matched one is the reason
+	appealReasons = []xhsreq.AppealReason{xhsreq.AppealReasonAbusive, xhsreq.AppealReasonSpam, xhsreq.AppealReasonCompetitor}
+)
+
+// AppealDetector flags the abusive, spam and competitor reviews as appeal candidates. A short or
+// repeated content such as "666" or "好好好" is usually praise, it is not flagged.
+type AppealDetector struct {
+	// Keywords are matched on top of DefaultAppealKeywords
+	Keywords map[xhsreq.AppealReason][]string
+}
+
+// Detect returns the appeal reason and the evidence of the review, false if it is not worth appealing.
+func (this *AppealDetector) Detect(review *xhsreq.Review) (xhsreq.AppealReason, string, bool) {
+	content := strings.ToLower(review.Content)
+	for _, reason := range appealReasons {
+		for _, keywords := range [][]string{DefaultAppealKeywords[reason], this.Keywords[reason]} {
+			for _, keyword := range keywords {
+				if len(keyword) != 0 && strings.Contains(content, strings.ToLower(keyword)) {
+					return reason, appealEvidence(reason, "包含「"+keyword+"」", review.Content), true
+				}
+			}
+		}
+	}
+	if phonePattern.MatchString(review.Content) {
+		return xhsreq.AppealReasonSpam, appealEvidence(xhsreq.AppealReasonSpam, "包含电话号码", review.Content), true
+	}
+	return 0, "", false
+}
+
+func appealEvidence(reason xhsreq.AppealReason, detail string, content string) string {
+	runes := []rune(content)
+	if len(runes) > 200 {
+		content = string(runes[:200]) + "..."
+	}
+	return fmt.Sprintf("该评价属于%s, 评价内容%s, 与商品的真实使用体验无关。原文: %s", reason, detail, content)
+}
+
+// ----------------------------------
+type AppealStatus string
+
+const (
+	AppealPending AppealStatus = "pending"
+	// AppealFiled the appeal has been filed by hand in the seller center
+	AppealFiled     AppealStatus = "filed"
+	AppealDismissed AppealStatus = "dismissed"
+)
+
+type PendingAppeal struct {
+	Id        string              `json:"id"`
+	Content   string              `json:"content"`
+	Reason    xhsreq.AppealReason `json:"reason"`
+	Evidence  string              `json:"evidence"`
+	Status    AppealStatus        `json:"status"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+func (this *PendingAppeal) key() string {
+	return this.Id
+}
+
+func (this *PendingAppeal) status() AppealStatus {
+	return this.Status
+}
+
+func (this *PendingAppeal) createdAt() time.Time {
+	return this.CreatedAt
+}
+
+func (this *PendingAppeal) touch(now time.Time) {
+	this.UpdatedAt = now
+}
+
+func (this *PendingAppeal) clone() *PendingAppeal {
+	copied := *this
+	return &copied
+}
+
+// AppealQueue keeps the appeal candidates in a json file until they are filed or dismissed. There is
+// no request of xiaohongshu to file an appeal, the operator files it in the seller center by the
+// evidence of the entry and marks it filed.
+type AppealQueue struct {
+	queue *jsonQueue[*PendingAppeal, AppealStatus]
+}
+
+func NewAppealQueue(path string) (*AppealQueue, error) {
+	queue, err := loadJSONQueue[*PendingAppeal]("appeal", path, ErrAppealNotFound, ErrAppealHandled)
+	if err != nil {
+		return nil, err
+	}
+	return &AppealQueue{queue: queue}, nil
+}
+
+// Add parks the candidate, it is ignored if the review is already in the queue.
+func (this *AppealQueue) Add(review *xhsreq.Review, reason xhsreq.AppealReason, evidence string) error {
+	now := time.Now()
+	_, _, err := this.queue.add(&PendingAppeal{
+		Id:        review.Id,
+		Content:   review.Content,
+		Reason:    reason,
+		Evidence:  evidence,
+		Status:    AppealPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	return err
+}
+
+// Status returns the status of the review, false if it has never been parked.
+func (this *AppealQueue) Status(id string) (AppealStatus, bool) {
+	entry, ok := this.queue.get(id)
+	if !ok {
+		return "", false
+	}
+	return entry.Status, true
+}
+
+// List returns the entries of the status ordered by creation time, all entries if status is empty.
+func (this *AppealQueue) List(status AppealStatus) []*PendingAppeal {
+	return this.queue.list(status)
+}
+
+// Dismiss gives up the appeal, the review is replied by the next run.
+func (this *AppealQueue) Dismiss(id string) error {
+	_, err := this.queue.transit(id, func(entry *PendingAppeal) error {
+		entry.Status = AppealDismissed
+		return nil
+	}, AppealPending, AppealFiled)
+	return err
+}
+
+// MarkFiled records that the appeal has been filed by hand, the review stays off the replies.
+func (this *AppealQueue) MarkFiled(id string) error {
+	_, err := this.queue.transit(id, func(entry *PendingAppeal) error {
+		entry.Status = AppealFiled
+		return nil
+	}, AppealPending)
+	return err
+}
+
+// ----------------------------------
+// AppealFilter takes the appeal candidates off the batch, they are parked in the queue for a human
+// to file. A review stays off the replies until its appeal is dismissed. It must be placed behind the
+// RoutingFilter, so that an escalated review, e.g. a genuine complaint calling the shop "垃圾店家",
+// reaches a human by the escalation rather than being parked silently, and ahead of the
+// ReplyGenerationFilter, so that no reply is generated for the candidates.
+type AppealFilter struct {
+	detector *AppealDetector
+	queue    *AppealQueue
+}
+
+func NewAppealFilter(ctx context.Context, detector *AppealDetector, queue *AppealQueue) *AppealFilter {
+	if detector == nil {
+		detector = &AppealDetector{}
+	}
+	return &AppealFilter{detector: detector, queue: queue}
+}
+
+func (this *AppealFilter) DoFilter(ctx context.Context, data *[]*ReviewReplyData, chain task.FilterChain[[]*ReviewReplyData]) error {
+	var result error
+	kept := make([]*ReviewReplyData, 0, len(*data))
+	for _, reviewReply := range *data {
+		review := reviewReply.Review
+		if review == nil {
+			kept = append(kept, reviewReply)
+			continue
+		}
+		if status, ok := this.queue.Status(review.Id); ok {
+			if status == AppealDismissed {
+				kept = append(kept, reviewReply)
+				continue
+			}
+			tools.LogFromContext(ctx, "--评价申诉中, 跳过-- reviewId:%s 状态:%s", review.Id, status)
+			continue
+		}
+		reason, evidence, ok := this.detector.Detect(review)
+		if !ok || !review.Appealable() {
+			kept = append(kept, reviewReply)
+			continue
+		}
+		slog.Info("review flagged for appeal.", slog.String("reviewId", review.Id), slog.String("reason", reason.String()))
+		if err := this.appeal(ctx, review, reason, evidence); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	*data = kept
+	if err := chain.Proceed(ctx, data); err != nil {
+		result = multierror.Append(result, err)
+	}
+	return result
+}
+
+func (this *AppealFilter) appeal(ctx context.Context, review *xhsreq.Review, reason xhsreq.AppealReason, evidence string) error {
+	// nothing is parked in dry-run mode, the candidate is only shown
+	if tools.IsDryRun(ctx) {
+		tools.LogFromContext(ctx, "--试运行, 评价可申诉-- reviewId:%s 原因:%s 证据:%s", review.Id, reason, evidence)
+		return nil
+	}
+	if err := this.queue.Add(review, reason, evidence); err != nil {
+		return err
+	}
+	tools.LogFromContext(ctx, "--评价可申诉, 等待人工申诉-- reviewId:%s 原因:%s", review.Id, reason)
+	return nil
+}
@@ -0,0 +1,121 @@
+package review
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/xhsreq"
+)
+
+func TestAppealDetector_Detect(t *testing.T) {
+	detector := &AppealDetector{Keywords: map[xhsreq.AppealReason][]string{xhsreq.AppealReasonCompetitor: {"某某家居"}}}
+	tests := []struct {
+		name       string
+		content    string
+		wantReason xhsreq.AppealReason
+		wantOk     bool
+	}{
+		{name: "complaint", content: "不要买！质量很差"},
+		{name: "images only", content: ""},
+		{name: "praise", content: "好好好, 很喜欢"},
+		{name: "abusive", content: "什么垃圾店家, 神经病", wantReason: xhsreq.AppealReasonAbusive, wantOk: true},
+		{name: "link", content: "同款看这里 https://example.com", wantReason: xhsreq.AppealReasonSpam, wantOk: true},
+		{name: "phone", content: "需要的联系13812345678", wantReason: xhsreq.AppealReasonSpam, wantOk: true},
+		{name: "competitor", content: "去看看某某家居吧", wantReason: xhsreq.AppealReasonCompetitor, wantOk: true},
+		{name: "digits", content: "666"},
+		{name: "repeated", content: "好好好"},
+		{name: "repeated praise", content: "赞赞赞！"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, evidence, ok := detector.Detect(&xhsreq.Review{Content: tt.content})
+			if ok != tt.wantOk || reason != tt.wantReason {
+				t.Errorf("Detect() = %v, %s, %v, want %v, %v", reason, evidence, ok, tt.wantReason, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestAppealFilter_DoFilter(t *testing.T) {
+	queue, err := NewAppealQueue(filepath.Join(t.TempDir(), "appeals.json"))
+	if err != nil {
+		t.Fatalf("NewAppealQueue() error = %v", err)
+	}
+	filter := NewAppealFilter(context.Background(), nil, queue)
+	run := func() []*ReviewReplyData {
+		praise, spam := newReplyData("praise", 5), newReplyData("spam", 1)
+		spam.Review.Content = "加微信领红包"
+		for _, reviewReply := range []*ReviewReplyData{praise, spam} {
+			reviewReply.Review.ButtonList = []*xhsreq.ReviewButton{{ButtonType: xhsreq.ButtonTypeAppeal}}
+		}
+		data := []*ReviewReplyData{praise, spam}
+		next := &recordReplyHandler{}
+		if err := task.NewFilterChainManager[[]*ReviewReplyData](next, filter).Proceed(context.Background(), &data); err != nil {
+			t.Errorf("Proceed() error = %v", err)
+		}
+		return next.sent
+	}
+
+	if sent := run(); len(sent) != 1 || sent[0].ReviewIds[0] != "praise" {
+		t.Errorf("sent = %v, want only the praise", sent)
+	}
+	if status, _ := queue.Status("spam"); status != AppealPending {
+		t.Errorf("Status() = %v, want %v", status, AppealPending)
+	}
+	if list := queue.List(AppealPending); len(list) != 1 || list[0].Reason != xhsreq.AppealReasonSpam || len(list[0].Evidence) == 0 {
+		t.Errorf("List() = %v, want the spam with its evidence", list)
+	}
+
+	// the review stays off the replies once filed, until the appeal is dismissed
+	if err = queue.MarkFiled("spam"); err != nil {
+		t.Fatalf("MarkFiled() error = %v", err)
+	}
+	if err = queue.MarkFiled("spam"); !errors.Is(err, ErrAppealHandled) {
+		t.Errorf("MarkFiled() error = %v, want %v", err, ErrAppealHandled)
+	}
+	if sent := run(); len(sent) != 1 {
+		t.Errorf("sent = %v, want only the praise", sent)
+	}
+	if err = queue.Dismiss("spam"); err != nil {
+		t.Fatalf("Dismiss() error = %v", err)
+	}
+	if sent := run(); len(sent) != 2 {
+		t.Errorf("sent = %v, want the dismissed review replied", sent)
+	}
+}
+
+func TestAppealFilter_BehindRouting(t *testing.T) {
+	queue, err := NewAppealQueue(filepath.Join(t.TempDir(), "appeals.json"))
+	if err != nil {
+		t.Fatalf("NewAppealQueue() error = %v", err)
+	}
+	complaint, spam := newReplyData("complaint", 1), newReplyData("spam", 5)
+	complaint.Review.Content = "垃圾店家, 衣架一挂就断, 要退货"
+	spam.Review.Content = "好评, 加微信领红包"
+	for _, reviewReply := range []*ReviewReplyData{complaint, spam} {
+		reviewReply.Review.ButtonList = []*xhsreq.ReviewButton{{ButtonType: xhsreq.ButtonTypeAppeal}}
+	}
+	data := []*ReviewReplyData{complaint, spam}
+	escalation, next := &recordReplyHandler{}, &recordReplyHandler{}
+	err = task.NewFilterChainManager[[]*ReviewReplyData](next,
+		NewClassificationFilter(context.Background(), &xhsreq.KeywordClassifier{}, nil),
+		NewRoutingFilter(context.Background(), DefaultRoutingPolicy, escalation),
+		NewAppealFilter(context.Background(), nil, queue),
+	).Proceed(context.Background(), &data)
+	if err != nil {
+		t.Fatalf("Proceed() error = %v", err)
+	}
+	if len(escalation.sent) != 1 || escalation.sent[0].ReviewIds[0] != "complaint" {
+		t.Errorf("escalated = %v, want the complaint", escalation.sent)
+	}
+	if list := queue.List(""); len(list) != 1 || list[0].Id != "spam" {
+		t.Errorf("List() = %v, want only the spam parked", list)
+	}
+	if len(next.sent) != 0 {
+		t.Errorf("sent = %v, want none", next.sent)
+	}
+}
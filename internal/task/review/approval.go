@@ -0,0 +1,250 @@
+package review
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsreq"
+)
+
+var (
+	ErrApprovalNotFound = errors.New("pending reply not found")
+	ErrApprovalHandled  = errors.New("pending reply has been handled")
+	// ErrApprovalNoReply the entry was parked without a reply, it has to be edited before approval
+	ErrApprovalNoReply = errors.New("pending reply has no reply content")
+)
+
+type ApprovalStatus string
+
+const (
+	ApprovalPending ApprovalStatus = "pending"
+	// ApprovalApproved the reply is approved and being sent
+	ApprovalApproved ApprovalStatus = "approved"
+	ApprovalRejected ApprovalStatus = "rejected"
+	ApprovalSent     ApprovalStatus = "sent"
+	ApprovalFailed   ApprovalStatus = "failed"
+)
+
+// ApprovalPolicy decides which generated replies can be posted without a human.
+type ApprovalPolicy struct {
+	// AutoApproveMinSkuScore replies of the reviews scored at least this are posted automatically
+	AutoApproveMinSkuScore uint8
+	// MandatoryMaxSkuScore replies of the reviews scored at most this always wait for approval
+	MandatoryMaxSkuScore uint8
+}
+
+var (
+	DefaultApprovalPolicy = &ApprovalPolicy{
+		AutoApproveMinSkuScore: 4,
+		MandatoryMaxSkuScore:   3,
+	}
+)
+
+// RequireApproval returns whether the reply needs approval along with the reason.
+func (this *ApprovalPolicy) RequireApproval(data *ReviewReplyData) (bool, string) {
+	if data.Review == nil || data.Review.Score == nil {
+		return true, "评分未知"
+	}
+	if classification := data.Review.Classification; classification != nil && classification.Urgency == xhsreq.UrgencyHigh {
+		return true, "紧急评价"
+	}
+	skuScore := data.Review.Score.SkuScore
+	if skuScore <= this.MandatoryMaxSkuScore {
+		return true, "低分评价"
+	}
+	if skuScore >= this.AutoApproveMinSkuScore {
+		return false, ""
+	}
+	return true, "未达到自动通过分数"
+}
+
+type PendingReply struct {
+	Id        string           `json:"id"`
+	Data      *ReviewReplyData `json:"data"`
+	Status    ApprovalStatus   `json:"status"`
+	Reason    string           `json:"reason"`
+	Error     string           `json:"error,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+func (this *PendingReply) key() string {
+	return this.Id
+}
+
+func (this *PendingReply) status() ApprovalStatus {
+	return this.Status
+}
+
+func (this *PendingReply) createdAt() time.Time {
+	return this.CreatedAt
+}
+
+func (this *PendingReply) touch(now time.Time) {
+	this.UpdatedAt = now
+}
+
+func (this *PendingReply) clone() *PendingReply {
+	copied := *this
+	return &copied
+}
+
+// ApprovalQueue keeps the replies waiting for approval in a json file.
+type ApprovalQueue struct {
+	queue *jsonQueue[*PendingReply, ApprovalStatus]
+}
+
+func NewApprovalQueue(path string) (*ApprovalQueue, error) {
+	queue, err := loadJSONQueue[*PendingReply]("approval", path, ErrApprovalNotFound, ErrApprovalHandled)
+	if err != nil {
+		return nil, err
+	}
+	return &ApprovalQueue{queue: queue}, nil
+}
+
+func pendingReplyID(data *ReviewReplyData) string {
+	return strings.Join(data.ReviewIds, ",")
+}
+
+// Add parks the reply, it is ignored if the review is already in the queue so that
+// the edited or rejected entries are not overwritten by a later run.
+func (this *ApprovalQueue) Add(data *ReviewReplyData, reason string) error {
+	now := time.Now()
+	entry, existing, err := this.queue.add(&PendingReply{
+		Id:        pendingReplyID(data),
+		Data:      data,
+		Status:    ApprovalPending,
+		Reason:    reason,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if existing {
+		slog.Info("reply already in approval queue.", slog.String("id", entry.Id), slog.String("status", string(entry.Status)))
+	}
+	return err
+}
+
+// Contains tells whether the review has ever been parked, whatever its status is.
+func (this *ApprovalQueue) Contains(id string) bool {
+	_, ok := this.queue.get(id)
+	return ok
+}
+
+// List returns the entries of the status ordered by creation time, all entries if status is empty.
+func (this *ApprovalQueue) List(status ApprovalStatus) []*PendingReply {
+	return this.queue.list(status)
+}
+
+// Edit replaces the reply content of a pending entry.
+func (this *ApprovalQueue) Edit(id string, replyContent string) error {
+	_, err := this.queue.transit(id, func(entry *PendingReply) error {
+		data := *entry.Data
+		data.ReplyContent = replyContent
+		entry.Data = &data
+		return nil
+	}, ApprovalPending, ApprovalFailed)
+	return err
+}
+
+func (this *ApprovalQueue) Reject(id string, reason string) error {
+	_, err := this.queue.transit(id, func(entry *PendingReply) error {
+		entry.Status = ApprovalRejected
+		entry.Reason = reason
+		return nil
+	}, ApprovalPending, ApprovalFailed)
+	return err
+}
+
+// Approve posts the pending entries through handler, all pending entries with a reply are approved
+// if ids is empty. An entry without a reply is refused by ErrApprovalNoReply.
+func (this *ApprovalQueue) Approve(ctx context.Context, handler task.DataHandler[[]*ReviewReplyData], ids ...string) error {
+	if len(ids) == 0 {
+		for _, entry := range this.List(ApprovalPending) {
+			if len(strings.TrimSpace(entry.Data.ReplyContent)) != 0 {
+				ids = append(ids, entry.Id)
+			}
+		}
+	}
+	var result error
+	for _, id := range ids {
+		// the entry is marked approved first so that a concurrent approval can not send it twice
+		entry, err := this.queue.transit(id, func(entry *PendingReply) error {
+			if len(strings.TrimSpace(entry.Data.ReplyContent)) == 0 {
+				return errors.WithMessagef(ErrApprovalNoReply, "id:%s", id)
+			}
+			entry.Status = ApprovalApproved
+			return nil
+		}, ApprovalPending, ApprovalFailed)
+		if err != nil {
+			result = multierror.Append(result, err)
+			continue
+		}
+		data := *entry.Data
+		err = handler.Execute(ctx, []*ReviewReplyData{&data})
+		_, updateErr := this.queue.transit(id, func(entry *PendingReply) error {
+			entry.Status = ApprovalSent
+			entry.Error = ""
+			if err != nil {
+				entry.Status = ApprovalFailed
+				entry.Error = err.Error()
+			}
+			return nil
+		}, ApprovalApproved)
+		if err != nil {
+			result = multierror.Append(result, errors.WithMessagef(err, "send approved reply:%s error.", id))
+		}
+		if updateErr != nil {
+			result = multierror.Append(result, updateErr)
+		}
+	}
+	return result
+}
+
+// ----------------------------------
+// ApprovalReplyHandler posts the replies allowed by the policy through next and parks the others in the queue.
+type ApprovalReplyHandler struct {
+	queue  *ApprovalQueue
+	policy *ApprovalPolicy
+	next   task.DataHandler[[]*ReviewReplyData]
+}
+
+func NewApprovalReplyHandler(ctx context.Context, queue *ApprovalQueue, policy *ApprovalPolicy, next task.DataHandler[[]*ReviewReplyData]) *ApprovalReplyHandler {
+	if policy == nil {
+		policy = DefaultApprovalPolicy
+	}
+	return &ApprovalReplyHandler{queue: queue, policy: policy, next: next}
+}
+
+func (this *ApprovalReplyHandler) Execute(ctx context.Context, data []*ReviewReplyData) error {
+	// nothing is parked in dry-run mode, the next handler prints them all
+	if tools.IsDryRun(ctx) {
+		return this.next.Execute(ctx, data)
+	}
+	var result error
+	approved := make([]*ReviewReplyData, 0, len(data))
+	for _, reviewReply := range data {
+		required, reason := this.policy.RequireApproval(reviewReply)
+		if !required {
+			approved = append(approved, reviewReply)
+			continue
+		}
+		slog.Info("reply waits for approval.", slog.Any("reviewIds", reviewReply.ReviewIds), slog.String("reason", reason))
+		tools.LogFromContext(ctx, "--等待人工审核-- reviewIds:%v reason:%s", reviewReply.ReviewIds, reason)
+		if err := this.queue.Add(reviewReply, reason); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	if len(approved) != 0 {
+		if err := this.next.Execute(ctx, approved); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result
+}
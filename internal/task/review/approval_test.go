@@ -0,0 +1,70 @@
+package review
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"PulseCheck/internal/xhsreq"
+)
+
+type recordReplyHandler struct {
+	sent []*ReviewReplyData
+}
+
+func (this *recordReplyHandler) Execute(ctx context.Context, data []*ReviewReplyData) error {
+	this.sent = append(this.sent, data...)
+	return nil
+}
+
+func newReplyData(id string, skuScore uint8) *ReviewReplyData {
+	return &ReviewReplyData{
+		ReviewIds:     []string{id},
+		ReviewContent: "评价",
+		ReplyContent:  "回复",
+		Review:        &xhsreq.Review{Id: id, Score: &xhsreq.Score{SkuScore: skuScore}},
+	}
+}
+
+func TestApprovalReplyHandler_Execute(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "approval.json")
+	queue, err := NewApprovalQueue(path)
+	if err != nil {
+		t.Fatalf("NewApprovalQueue() error = %v", err)
+	}
+	next := &recordReplyHandler{}
+	handler := NewApprovalReplyHandler(context.Background(), queue, DefaultApprovalPolicy, next)
+	data := []*ReviewReplyData{newReplyData("good", 5), newReplyData("bad", 1)}
+	if err = handler.Execute(context.Background(), data); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(next.sent) != 1 || next.sent[0].ReviewIds[0] != "good" {
+		t.Errorf("Execute() auto approved = %v, want [good]", next.sent)
+	}
+
+	// the queue survives a restart
+	queue, err = NewApprovalQueue(path)
+	if err != nil {
+		t.Fatalf("NewApprovalQueue() error = %v", err)
+	}
+	pending := queue.List(ApprovalPending)
+	if len(pending) != 1 || pending[0].Id != "bad" {
+		t.Fatalf("List() got = %v, want [bad]", pending)
+	}
+	if err = queue.Edit("bad", "抱歉给您带来不好的体验"); err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	sender := &recordReplyHandler{}
+	if err = queue.Approve(context.Background(), sender); err != nil {
+		t.Fatalf("Approve() error = %v", err)
+	}
+	if len(sender.sent) != 1 || sender.sent[0].ReplyContent != "抱歉给您带来不好的体验" {
+		t.Errorf("Approve() sent = %v", sender.sent)
+	}
+	if err = queue.Reject("bad", "sent already"); err == nil {
+		t.Errorf("Reject() of a sent reply should fail")
+	}
+	if got := queue.List(ApprovalSent); len(got) != 1 {
+		t.Errorf("List(sent) got = %v", got)
+	}
+}
@@ -0,0 +1,57 @@
+package review
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/storage"
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsreq"
+)
+
+// ClassificationFilter tags every review of the batch with its sentiment, topics and urgency. It
+// must be placed behind the DedupFilter so that no token is spent on the skipped reviews, and
+// ahead of the ReplyGenerationFilter which hands the tags to the LLM.
+type ClassificationFilter struct {
+	classifier xhsreq.Classifier
+	// store keeps the tagged reviews, nothing is recorded if nil
+	store *storage.Store
+}
+
+func NewClassificationFilter(ctx context.Context, classifier xhsreq.Classifier, store *storage.Store) *ClassificationFilter {
+	return &ClassificationFilter{classifier: classifier, store: store}
+}
+
+func (this *ClassificationFilter) DoFilter(ctx context.Context, data *[]*ReviewReplyData, chain task.FilterChain[[]*ReviewReplyData]) error {
+	var result error
+	classified := make([]*xhsreq.Review, 0, len(*data))
+	for _, reviewReply := range *data {
+		review := reviewReply.Review
+		if review == nil || review.Classification != nil {
+			continue
+		}
+		classification, err := this.classifier.Classify(ctx, review)
+		if err != nil {
+			// the review is still replied, only without the tags
+			result = multierror.Append(result, errors.WithMessagef(err, "classify reviews:%v error.", reviewReply.ReviewIds))
+			continue
+		}
+		review.Classification = classification
+		classified = append(classified, review)
+		tools.LogFromContext(ctx, "--评价分类-- reviewId:%s 情感:%s 话题:%v 紧急程度:%s", review.Id,
+			classification.Sentiment, classification.Topics, classification.Urgency)
+	}
+	if this.store != nil && len(classified) != 0 {
+		if err := this.store.Reviews().Save(ctx, classified...); err != nil {
+			slog.Error("save classified reviews error.", tools.ErrAttr(err))
+		}
+	}
+	if err := chain.Proceed(ctx, data); err != nil {
+		result = multierror.Append(result, err)
+	}
+	return result
+}
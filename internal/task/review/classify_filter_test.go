@@ -0,0 +1,83 @@
+package review
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"PulseCheck/internal/storage"
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/xhsreq"
+)
+
+// paramGenerator keeps the params it is asked with.
+type paramGenerator struct {
+	params []*xhsreq.XHSReviewChatParam
+}
+
+func (this *paramGenerator) Interact(ctx context.Context, param *xhsreq.XHSReviewChatParam) (string, error) {
+	this.params = append(this.params, param)
+	return "谢谢宝子", nil
+}
+
+func TestClassificationFilter_DoFilter(t *testing.T) {
+	store, err := storage.Open(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close()
+	queue, err := NewApprovalQueue(filepath.Join(t.TempDir(), "approval.json"))
+	if err != nil {
+		t.Fatalf("NewApprovalQueue() error = %v", err)
+	}
+	ctx := context.Background()
+	praise, returned := newReplyData("praise", 5), newReplyData("return", 5)
+	praise.Review.Content = "很好用"
+	returned.Review.Content = "钩子断了, 我要退货"
+	data := []*ReviewReplyData{praise, returned}
+	for _, reviewReply := range data {
+		reviewReply.Review.SkuInfo = &xhsreq.SkuInfo{ItemID: "item", SkuName: "衣架"}
+		reviewReply.Review.CreateTime = time.Now()
+	}
+
+	generator := &paramGenerator{}
+	next := &recordReplyHandler{}
+	err = task.NewFilterChainManager[[]*ReviewReplyData](
+		NewApprovalReplyHandler(ctx, queue, DefaultApprovalPolicy, next),
+		NewClassificationFilter(ctx, &xhsreq.KeywordClassifier{}, store),
+		NewReplyGenerationFilter(ctx, generator, nil),
+	).Proceed(ctx, &data)
+	if err != nil {
+		t.Fatalf("Proceed() error = %v", err)
+	}
+	if len(generator.params) != 2 || generator.params[1].Classification == nil ||
+		generator.params[1].Classification.Urgency != xhsreq.UrgencyHigh {
+		t.Errorf("Interact() params = %#v, want the classification of the review", generator.params)
+	}
+	// the 5 stars review asking for a return is urgent, it waits for approval
+	if len(next.sent) != 1 || next.sent[0].ReviewIds[0] != "praise" {
+		t.Errorf("sent = %v, want [praise]", next.sent)
+	}
+	if entries := queue.List(ApprovalPending); len(entries) != 1 || entries[0].Reason != "紧急评价" {
+		t.Errorf("List() = %v, want the urgent review", entries)
+	}
+
+	record, err := store.Reviews().Get("return")
+	if err != nil || record.Review.Classification == nil {
+		t.Fatalf("Get() got = %#v, error = %v, want the classification stored", record, err)
+	}
+	records, err := store.Reviews().ListSince(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("ListSince() error = %v", err)
+	}
+	reviews := make([]*xhsreq.Review, 0, len(records))
+	for _, record := range records {
+		reviews = append(reviews, record.Review)
+	}
+	report := NewClassificationReport(time.Now().Add(-time.Hour), reviews)
+	if report.Total != 2 || report.Sentiments[xhsreq.SentimentPositive] != 2 || report.Topics[xhsreq.TopicQuality] != 1 ||
+		len(report.Urgent) != 1 || report.Urgent[0] != "return" {
+		t.Errorf("NewClassificationReport() = %#v", report)
+	}
+}
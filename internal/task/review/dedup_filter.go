@@ -0,0 +1,67 @@
+package review
+
+import (
+	"context"
+	"log/slog"
+
+	"PulseCheck/internal/storage"
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsreq"
+)
+
+// DedupFilter drops the reviews that are already replied or waiting for approval. It must be
+// placed ahead of the ReplyGenerationFilter so that no token is spent on them.
+type DedupFilter struct {
+	// store holds the ledger of replied reviews, only the review itself is checked if nil
+	store *storage.Store
+	// queue holds the replies waiting for approval, ignored if nil
+	queue *ApprovalQueue
+}
+
+func NewDedupFilter(ctx context.Context, store *storage.Store, queue *ApprovalQueue) *DedupFilter {
+	return &DedupFilter{store: store, queue: queue}
+}
+
+func (this *DedupFilter) DoFilter(ctx context.Context, data *[]*ReviewReplyData, chain task.FilterChain[[]*ReviewReplyData]) error {
+	kept := make([]*ReviewReplyData, 0, len(*data))
+	for _, reviewReply := range *data {
+		if reason := this.skipReason(reviewReply); reason != "" {
+			slog.Info("review skipped.", slog.Any("reviewIds", reviewReply.ReviewIds), slog.String("reason", reason))
+			tools.LogFromContext(ctx, "--跳过评价-- reviewIds:%v 原因:%s", reviewReply.ReviewIds, reason)
+			continue
+		}
+		kept = append(kept, reviewReply)
+	}
+	*data = kept
+	return chain.Proceed(ctx, data)
+}
+
+// skipReason returns why the review must not be replied, empty if it can be.
+func (this *DedupFilter) skipReason(data *ReviewReplyData) string {
+	if review := data.Review; review != nil {
+		if review.ReplyNum > 0 {
+			return "已有回复"
+		}
+		if button := review.Button(xhsreq.ButtonTypeReply); button != nil && button.Disabled {
+			return "回复按钮不可用"
+		}
+	}
+	if this.store != nil {
+		for _, reviewId := range data.ReviewIds {
+			replied, err := this.store.Ledger().Replied(reviewId)
+			if err != nil {
+				// skipping is the safe side, the review is picked up again by the next run
+				slog.Error("read replied ledger error.", slog.String("reviewId", reviewId), tools.ErrAttr(err))
+				return "读取回复记录失败"
+			}
+			if replied {
+				return "回复记录中已存在"
+			}
+		}
+	}
+	if this.queue != nil && this.queue.Contains(pendingReplyID(data)) {
+		return "已在审核队列中"
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package review
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"PulseCheck/internal/storage"
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/xhsreq"
+)
+
+type countGenerator struct {
+	calls int
+}
+
+func (this *countGenerator) Interact(ctx context.Context, param *xhsreq.XHSReviewChatParam) (string, error) {
+	this.calls++
+	return "谢谢宝子", nil
+}
+
+func TestDedupFilter_DoFilter(t *testing.T) {
+	store, err := storage.Open(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close()
+	queue, err := NewApprovalQueue(filepath.Join(t.TempDir(), "approval.json"))
+	if err != nil {
+		t.Fatalf("NewApprovalQueue() error = %v", err)
+	}
+	ctx := context.Background()
+	if err = store.Ledger().Mark(ctx, "ledger", "回复"); err != nil {
+		t.Fatalf("Mark() error = %v", err)
+	}
+	if err = queue.Add(newReplyData("queued", 1), "差评"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	replyNum := newReplyData("reply-num", 5)
+	replyNum.Review.ReplyNum = 1
+	disabled := newReplyData("disabled", 5)
+	disabled.Review.ButtonList = []*xhsreq.ReviewButton{{ButtonType: xhsreq.ButtonTypeReply, Disabled: true}}
+	data := []*ReviewReplyData{
+		newReplyData("ledger", 5), newReplyData("queued", 5), replyNum, disabled, newReplyData("new", 5),
+	}
+	for _, reviewReply := range data {
+		reviewReply.ReplyContent = ""
+		reviewReply.Review.SkuInfo = &xhsreq.SkuInfo{ItemID: "item", SkuName: "衣架"}
+	}
+
+	generator := &countGenerator{}
+	chain := task.NewFilterChainManager[[]*ReviewReplyData](
+		&recordReplyHandler{},
+		NewDedupFilter(ctx, store, queue),
+		NewReplyGenerationFilter(ctx, generator, store),
+	)
+	if err = chain.Proceed(ctx, &data); err != nil {
+		t.Fatalf("Proceed() error = %v", err)
+	}
+	if len(data) != 1 || data[0].ReviewIds[0] != "new" {
+		t.Errorf("DoFilter() got = %v, want [new]", data)
+	}
+	if generator.calls != 1 {
+		t.Errorf("Interact() calls = %d, want 1", generator.calls)
+	}
+	if data[0].ReplyContent != "谢谢宝子" {
+		t.Errorf("ReplyContent = %s, want 谢谢宝子", data[0].ReplyContent)
+	}
+}
@@ -0,0 +1,336 @@
+package review
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsreq"
+)
+
+const (
+	// DefaultEscalateMaxSkuScore the reviews scored at most this are escalated
+	DefaultEscalateMaxSkuScore = 2
+	// NoDraftNote is noted on an escalated review parked without a draft, it can not be approved
+	// before the reply is written
+	NoDraftNote = "无回复草稿, 请编辑回复后再审批"
+)
+
+var (
+	ErrFollowUpNotFound = errors.New("follow-up not found")
+	ErrFollowUpClosed   = errors.New("follow-up has been closed")
+)
+
+// RoutingPolicy decides which reviews are escalated to a human instead of being replied automatically.
+type RoutingPolicy struct {
+	// EscalateMaxSkuScore the reviews scored at most this are escalated, none is escalated by the
+	// score if 0
+	EscalateMaxSkuScore uint8
+}
+
+var (
+	DefaultRoutingPolicy = &RoutingPolicy{EscalateMaxSkuScore: DefaultEscalateMaxSkuScore}
+)
+
+// Escalate returns whether the review is escalated along with the reason.
+func (this *RoutingPolicy) Escalate(data *ReviewReplyData) (bool, string) {
+	if data.Review == nil {
+		return false, ""
+	}
+	if classification := data.Review.Classification; classification != nil {
+		switch {
+		case classification.Urgency == xhsreq.UrgencyHigh:
+			return true, "紧急评价"
+		case classification.Sentiment == xhsreq.SentimentNegative:
+			return true, "负面评价"
+		}
+	}
+	if score := data.Review.Score; score != nil && score.SkuScore > 0 && score.SkuScore <= this.EscalateMaxSkuScore {
+		return true, "低分评价"
+	}
+	return false, ""
+}
+
+// ----------------------------------
+// RoutingFilter diverts the escalated reviews to the escalation handler, the others go on down the
+// chain to be replied automatically. It must be placed behind the ClassificationFilter whose tags
+// it routes by, and ahead of the ReplyGenerationFilter.
+type RoutingFilter struct {
+	policy     *RoutingPolicy
+	escalation task.DataHandler[[]*ReviewReplyData]
+}
+
+func NewRoutingFilter(ctx context.Context, policy *RoutingPolicy, escalation task.DataHandler[[]*ReviewReplyData]) *RoutingFilter {
+	if policy == nil {
+		policy = DefaultRoutingPolicy
+	}
+	return &RoutingFilter{policy: policy, escalation: escalation}
+}
+
+func (this *RoutingFilter) DoFilter(ctx context.Context, data *[]*ReviewReplyData, chain task.FilterChain[[]*ReviewReplyData]) error {
+	var result error
+	routine := make([]*ReviewReplyData, 0, len(*data))
+	escalated := make([]*ReviewReplyData, 0)
+	for _, reviewReply := range *data {
+		escalate, reason := this.policy.Escalate(reviewReply)
+		if !escalate {
+			routine = append(routine, reviewReply)
+			continue
+		}
+		slog.Info("review escalated.", slog.Any("reviewIds", reviewReply.ReviewIds), slog.String("reason", reason))
+		tools.LogFromContext(ctx, "--评价已升级人工处理-- reviewIds:%v 原因:%s", reviewReply.ReviewIds, reason)
+		escalated = append(escalated, reviewReply)
+	}
+	if len(escalated) != 0 {
+		if err := this.escalation.Execute(ctx, escalated); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	*data = routine
+	if err := chain.Proceed(ctx, data); err != nil {
+		result = multierror.Append(result, err)
+	}
+	return result
+}
+
+// ----------------------------------
+// Escalation is a review taken off the automatic reply.
+type Escalation struct {
+	Data   *ReviewReplyData
+	Reason string
+	// FollowUpId the after-sales follow-up opened for the review, empty if none
+	FollowUpId string
+}
+
+// EscalationNotifier tells the operators about the escalated reviews.
+type EscalationNotifier interface {
+	NotifyEscalation(ctx context.Context, escalations []*Escalation) error
+}
+
+type EscalationOption func(handler *EscalationHandler)
+
+// WithDraft generates the draft reply of the escalated reviews by generation, so that the operator
+// only has to edit it. The reviews are parked without a reply if not set.
+func WithDraft(generation *ReplyGenerationFilter) EscalationOption {
+	return func(handler *EscalationHandler) {
+		handler.generation = generation
+	}
+}
+
+// WithDraftGuardrail checks the drafts by guardrail like the automatic replies, a rejected draft is
+// dropped and the review is parked without a draft.
+func WithDraftGuardrail(guardrail *Guardrail) EscalationOption {
+	return func(handler *EscalationHandler) {
+		handler.guardrail = guardrail
+	}
+}
+
+// WithEscalationNotifier adds a notifier, every one of them is told about the escalated reviews.
+func WithEscalationNotifier(notifier EscalationNotifier) EscalationOption {
+	return func(handler *EscalationHandler) {
+		handler.notifiers = append(handler.notifiers, notifier)
+	}
+}
+
+// WithFollowUp opens an after-sales follow-up of every escalated review in followUps.
+func WithFollowUp(followUps *FollowUpQueue) EscalationOption {
+	return func(handler *EscalationHandler) {
+		handler.followUps = followUps
+	}
+}
+
+// EscalationHandler parks the escalated reviews in the approval queue, optionally with a draft
+// reply and an after-sales follow-up, and notifies the operators. A review without a draft is parked
+// with NoDraftNote.
+type EscalationHandler struct {
+	queue      *ApprovalQueue
+	policy     *RoutingPolicy
+	generation *ReplyGenerationFilter
+	guardrail  *Guardrail
+	notifiers  []EscalationNotifier
+	followUps  *FollowUpQueue
+}
+
+func NewEscalationHandler(ctx context.Context, queue *ApprovalQueue, policy *RoutingPolicy, opts ...EscalationOption) *EscalationHandler {
+	if policy == nil {
+		policy = DefaultRoutingPolicy
+	}
+	handler := &EscalationHandler{queue: queue, policy: policy}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	return handler
+}
+
+func (this *EscalationHandler) Execute(ctx context.Context, data []*ReviewReplyData) error {
+	var result error
+	escalations := make([]*Escalation, 0, len(data))
+	for _, reviewReply := range data {
+		_, reason := this.policy.Escalate(reviewReply)
+		if len(reason) == 0 {
+			reason = "人工处理"
+		}
+		note := "升级人工处理: " + reason
+		if this.generation != nil {
+			note += this.draft(ctx, reviewReply)
+		}
+		if len(strings.TrimSpace(reviewReply.ReplyContent)) == 0 {
+			reviewReply.ReplyContent = ""
+			note += ", " + NoDraftNote
+		}
+		escalation := &Escalation{Data: reviewReply, Reason: reason}
+		escalations = append(escalations, escalation)
+		// nothing is parked in dry-run mode, the escalation is only shown
+		if tools.IsDryRun(ctx) {
+			tools.LogFromContext(ctx, "--试运行, 评价升级人工处理-- reviewIds:%v 原因:%s 草稿:%s",
+				reviewReply.ReviewIds, reason, reviewReply.ReplyContent)
+			continue
+		}
+		if err := this.queue.Add(reviewReply, note); err != nil {
+			result = multierror.Append(result, err)
+		}
+		if this.followUps != nil {
+			id, err := this.followUps.Open(reviewReply, reason)
+			if err != nil {
+				result = multierror.Append(result, err)
+			}
+			escalation.FollowUpId = id
+		}
+	}
+	if tools.IsDryRun(ctx) || len(escalations) == 0 {
+		return result
+	}
+	if len(this.notifiers) == 0 {
+		slog.Warn("reviews escalated, no notifier is set.", slog.Int("count", len(escalations)))
+		return result
+	}
+	for _, notifier := range this.notifiers {
+		if err := notifier.NotifyEscalation(ctx, escalations); err != nil {
+			result = multierror.Append(result, errors.WithMessagef(err, "notify %d escalated reviews error.", len(escalations)))
+		}
+	}
+	return result
+}
+
+// draft generates the draft reply and checks it by the guardrail, the draft is dropped if either
+// fails, the review is parked anyway and the operator writes the reply. It returns what is noted
+// about the draft.
+func (this *EscalationHandler) draft(ctx context.Context, reviewReply *ReviewReplyData) string {
+	if err := this.generation.generate(ctx, reviewReply); err != nil {
+		slog.Error("generate draft reply error.", slog.Any("reviewIds", reviewReply.ReviewIds), tools.ErrAttr(err))
+		reviewReply.ReplyContent = ""
+		return ""
+	}
+	if this.guardrail == nil {
+		return ""
+	}
+	reason := this.guardrail.Check(reviewReply)
+	if len(reason) == 0 {
+		return ""
+	}
+	slog.Warn("draft reply rejected by guardrail.", slog.Any("reviewIds", reviewReply.ReviewIds),
+		slog.String("reply", reviewReply.ReplyContent), slog.String("reason", reason))
+	tools.LogFromContext(ctx, "--回复草稿未通过检查, 已丢弃-- reviewIds:%v 原因:%s", reviewReply.ReviewIds, reason)
+	reviewReply.ReplyContent = ""
+	return ", 草稿未通过检查: " + reason
+}
+
+// ----------------------------------
+type FollowUpStatus string
+
+const (
+	FollowUpOpen   FollowUpStatus = "open"
+	FollowUpClosed FollowUpStatus = "closed"
+)
+
+// FollowUp is an after-sales task of an escalated review, e.g. contacting the buyer through the
+// order for a replacement.
+type FollowUp struct {
+	Id       string         `json:"id"`
+	ReviewId string         `json:"review_id"`
+	OrderId  string         `json:"order_id,omitempty"`
+	Content  string         `json:"content"`
+	Reason   string         `json:"reason"`
+	Status   FollowUpStatus `json:"status"`
+	// Note how the follow-up was closed
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (this *FollowUp) key() string {
+	return this.Id
+}
+
+func (this *FollowUp) status() FollowUpStatus {
+	return this.Status
+}
+
+func (this *FollowUp) createdAt() time.Time {
+	return this.CreatedAt
+}
+
+func (this *FollowUp) touch(now time.Time) {
+	this.UpdatedAt = now
+}
+
+func (this *FollowUp) clone() *FollowUp {
+	copied := *this
+	return &copied
+}
+
+// FollowUpQueue keeps the after-sales follow-ups in a json file.
+type FollowUpQueue struct {
+	queue *jsonQueue[*FollowUp, FollowUpStatus]
+}
+
+func NewFollowUpQueue(path string) (*FollowUpQueue, error) {
+	queue, err := loadJSONQueue[*FollowUp]("follow-up", path, ErrFollowUpNotFound, ErrFollowUpClosed)
+	if err != nil {
+		return nil, err
+	}
+	return &FollowUpQueue{queue: queue}, nil
+}
+
+// Open adds the follow-up of the review and returns its id, the existing one is kept if the
+// review already has one.
+func (this *FollowUpQueue) Open(data *ReviewReplyData, reason string) (string, error) {
+	now := time.Now()
+	followUp := &FollowUp{
+		Id:        pendingReplyID(data),
+		Content:   data.ReviewContent,
+		Reason:    reason,
+		Status:    FollowUpOpen,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if review := data.Review; review != nil {
+		followUp.ReviewId = review.Id
+		followUp.Content = review.Content
+		if review.SkuInfo != nil {
+			followUp.OrderId = review.SkuInfo.OrderID
+		}
+	}
+	_, _, err := this.queue.add(followUp)
+	return followUp.Id, err
+}
+
+// List returns the follow-ups of the status ordered by creation time, all of them if status is empty.
+func (this *FollowUpQueue) List(status FollowUpStatus) []*FollowUp {
+	return this.queue.list(status)
+}
+
+func (this *FollowUpQueue) Close(id string, note string) error {
+	_, err := this.queue.transit(id, func(entry *FollowUp) error {
+		entry.Status = FollowUpClosed
+		entry.Note = note
+		return nil
+	}, FollowUpOpen)
+	return err
+}
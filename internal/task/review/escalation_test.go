@@ -0,0 +1,164 @@
+package review
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsreq"
+)
+
+type recordNotifier struct {
+	escalations []*Escalation
+}
+
+func (this *recordNotifier) NotifyEscalation(ctx context.Context, escalations []*Escalation) error {
+	this.escalations = append(this.escalations, escalations...)
+	return nil
+}
+
+func TestRoutingPolicy_Escalate(t *testing.T) {
+	tests := []struct {
+		name           string
+		skuScore       uint8
+		classification *xhsreq.Classification
+		want           bool
+	}{
+		{name: "praise", skuScore: 5, classification: &xhsreq.Classification{Sentiment: xhsreq.SentimentPositive, Urgency: xhsreq.UrgencyLow}},
+		{name: "low score", skuScore: 1, want: true},
+		{name: "unscored", skuScore: 0},
+		{name: "middle score", skuScore: 3},
+		{name: "negative", skuScore: 5, classification: &xhsreq.Classification{Sentiment: xhsreq.SentimentNegative, Urgency: xhsreq.UrgencyMedium}, want: true},
+		{name: "urgent", skuScore: 4, classification: &xhsreq.Classification{Sentiment: xhsreq.SentimentNeutral, Urgency: xhsreq.UrgencyHigh}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := newReplyData(tt.name, tt.skuScore)
+			data.Review.Classification = tt.classification
+			if got, reason := DefaultRoutingPolicy.Escalate(data); got != tt.want {
+				t.Errorf("Escalate() = %v, %s, want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutingFilter_DoFilter(t *testing.T) {
+	tests := []struct {
+		name          string
+		dryRun        bool
+		guardrail     *Guardrail
+		wantDraft     string
+		wantParked    int
+		wantNotified  int
+		wantFollowUps int
+	}{
+		{name: "escalated", wantDraft: "抱歉宝子", wantParked: 1, wantNotified: 1, wantFollowUps: 1},
+		{name: "draft rejected", guardrail: &Guardrail{BannedWords: []string{"宝子"}}, wantParked: 1, wantNotified: 1,
+			wantFollowUps: 1},
+		{name: "dry run", dryRun: true, wantDraft: "抱歉宝子"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue, err := NewApprovalQueue(filepath.Join(t.TempDir(), "approval.json"))
+			if err != nil {
+				t.Fatalf("NewApprovalQueue() error = %v", err)
+			}
+			followUps, err := NewFollowUpQueue(filepath.Join(t.TempDir(), "followups.json"))
+			if err != nil {
+				t.Fatalf("NewFollowUpQueue() error = %v", err)
+			}
+			ctx := tools.AppendDryRun(context.Background(), tt.dryRun)
+			praise, complaint := newReplyData("praise", 5), newReplyData("complaint", 1)
+			complaint.Review.Content = "不要买！质量很差"
+			data := []*ReviewReplyData{praise, complaint}
+			for _, reviewReply := range data {
+				reviewReply.ReplyContent = ""
+				reviewReply.Review.SkuInfo = &xhsreq.SkuInfo{ItemID: "item", SkuName: "衣架", OrderID: "P" + reviewReply.Review.Id}
+			}
+
+			generation := NewReplyGenerationFilter(ctx, &scriptGenerator{replies: []string{"抱歉宝子"}}, nil)
+			notifier := &recordNotifier{}
+			opts := []EscalationOption{WithDraft(generation), WithEscalationNotifier(notifier), WithFollowUp(followUps)}
+			if tt.guardrail != nil {
+				opts = append(opts, WithDraftGuardrail(tt.guardrail))
+			}
+			escalation := NewEscalationHandler(ctx, queue, DefaultRoutingPolicy, opts...)
+			next := &recordReplyHandler{}
+			err = task.NewFilterChainManager[[]*ReviewReplyData](next,
+				NewRoutingFilter(ctx, DefaultRoutingPolicy, escalation),
+			).Proceed(ctx, &data)
+			if err != nil {
+				t.Fatalf("Proceed() error = %v", err)
+			}
+			if len(next.sent) != 1 || next.sent[0].ReviewIds[0] != "praise" {
+				t.Errorf("sent = %v, want only the praise", next.sent)
+			}
+			if complaint.ReplyContent != tt.wantDraft {
+				t.Errorf("draft = %s, want %s", complaint.ReplyContent, tt.wantDraft)
+			}
+			entries := queue.List(ApprovalPending)
+			if len(entries) != tt.wantParked {
+				t.Fatalf("List() = %v, want %d parked", entries, tt.wantParked)
+			}
+			if len(entries) != 0 && entries[0].Data.ReplyContent != tt.wantDraft {
+				t.Errorf("parked reply = %s, want %s", entries[0].Data.ReplyContent, tt.wantDraft)
+			}
+			if len(entries) != 0 && len(tt.wantDraft) == 0 {
+				// a review without a draft waits for the operator to write the reply
+				if !strings.Contains(entries[0].Reason, NoDraftNote) {
+					t.Errorf("parked reason = %s, want %s noted", entries[0].Reason, NoDraftNote)
+				}
+				if err = queue.Approve(ctx, next, entries[0].Id); !errors.Is(err, ErrApprovalNoReply) {
+					t.Errorf("Approve() error = %v, want %v", err, ErrApprovalNoReply)
+				}
+				if err = queue.Approve(ctx, next); err != nil || len(queue.List(ApprovalPending)) != 1 {
+					t.Errorf("Approve() of all error = %v, the entry without a draft should be left pending", err)
+				}
+			}
+			if len(notifier.escalations) != tt.wantNotified {
+				t.Errorf("notified = %v, want %d", notifier.escalations, tt.wantNotified)
+			}
+			opened := followUps.List(FollowUpOpen)
+			if len(opened) != tt.wantFollowUps {
+				t.Fatalf("follow-ups = %v, want %d", opened, tt.wantFollowUps)
+			}
+			if len(opened) != 0 && (opened[0].OrderId != "Pcomplaint" || notifier.escalations[0].FollowUpId != opened[0].Id) {
+				t.Errorf("follow-up = %#v, escalation = %#v", opened[0], notifier.escalations[0])
+			}
+		})
+	}
+}
+
+func TestFollowUpQueue_Close(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "followups.json")
+	followUps, err := NewFollowUpQueue(path)
+	if err != nil {
+		t.Fatalf("NewFollowUpQueue() error = %v", err)
+	}
+	id, err := followUps.Open(newReplyData("complaint", 1), "低分评价")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err = followUps.Close(id, "已补发"); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err = followUps.Close(id, "已补发"); !errors.Is(err, ErrFollowUpClosed) {
+		t.Errorf("Close() error = %v, want %v", err, ErrFollowUpClosed)
+	}
+	if err = followUps.Close("unknown", ""); !errors.Is(err, ErrFollowUpNotFound) {
+		t.Errorf("Close() error = %v, want %v", err, ErrFollowUpNotFound)
+	}
+
+	reloaded, err := NewFollowUpQueue(path)
+	if err != nil {
+		t.Fatalf("NewFollowUpQueue() error = %v", err)
+	}
+	if got := reloaded.List(FollowUpClosed); len(got) != 1 || got[0].Note != "已补发" {
+		t.Errorf("List() = %v, want the closed follow-up", got)
+	}
+}
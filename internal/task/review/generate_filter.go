@@ -0,0 +1,81 @@
+package review
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/storage"
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsreq"
+)
+
+// ReplyGenerationFilter asks the generator for the reply of every review in the batch. A failed
+// review is dropped from the batch so that the rest of it still gets replied.
+type ReplyGenerationFilter struct {
+	generator xhsreq.ReplyGenerator
+	// store records the generated replies, nothing is recorded if nil
+	store *storage.Store
+}
+
+func NewReplyGenerationFilter(ctx context.Context, generator xhsreq.ReplyGenerator, store *storage.Store) *ReplyGenerationFilter {
+	return &ReplyGenerationFilter{generator: generator, store: store}
+}
+
+func (this *ReplyGenerationFilter) DoFilter(ctx context.Context, data *[]*ReviewReplyData, chain task.FilterChain[[]*ReviewReplyData]) error {
+	if len(*data) == 0 {
+		return chain.Proceed(ctx, data)
+	}
+	tools.LogFromContext(ctx, "\n--正在获取回复生成内容--")
+	var result error
+	generated := make([]*ReviewReplyData, 0, len(*data))
+	for _, reviewReply := range *data {
+		if err := this.generate(ctx, reviewReply); err != nil {
+			tools.LogFromContext(ctx, "--获取失败-- reviewIds:%v error:%v", reviewReply.ReviewIds, err)
+			result = multierror.Append(result, errors.WithMessagef(err, "generate reply for reviews:%v error.", reviewReply.ReviewIds))
+			continue
+		}
+		generated = append(generated, reviewReply)
+		tools.LogFromContext(ctx, "\n--获取成功--")
+		tools.LogFromContext(ctx, "reviewId:%+v", reviewReply.ReviewIds)
+		tools.LogFromContext(ctx, "reviewContent:%s", reviewReply.ReviewContent)
+		tools.LogFromContext(ctx, "answer:%s", reviewReply.ReplyContent)
+	}
+	*data = generated
+	if err := chain.Proceed(ctx, data); err != nil {
+		result = multierror.Append(result, err)
+	}
+	return result
+}
+
+func (this *ReplyGenerationFilter) generate(ctx context.Context, reviewReply *ReviewReplyData) error {
+	review := reviewReply.Review
+	if review == nil || review.SkuInfo == nil {
+		return errors.New("review has no sku info")
+	}
+	param := &xhsreq.XHSReviewChatParam{
+		ItemId:         review.SkuInfo.ItemID,
+		ItemInfo:       review.SkuInfo.SkuName,
+		ReviewContent:  review.Content,
+		Classification: review.Classification,
+	}
+	answer, err := this.generator.Interact(ctx, param)
+	if err != nil {
+		return err
+	}
+	reviewReply.ReplyContent = answer
+	if this.store != nil {
+		err = this.store.Replies().Save(ctx, &storage.ReplyRecord{
+			ReviewID:      review.Id,
+			ReviewContent: review.Content,
+			ReplyContent:  answer,
+		})
+		if err != nil {
+			slog.Error("save reply error.", slog.String("reviewId", review.Id), tools.ErrAttr(err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package review
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/catalog"
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/tools"
+)
+
+const (
+	// DefaultMaxReplyLength the longest reply xiaohongshu accepts
+	DefaultMaxReplyLength = 500
+	DefaultMinReplyLength = 2
+)
+
+var (
+	ErrReplyRejected = errors.New("reply rejected by guardrail")
+
+	// DefaultBannedWords are never posted whatever the shop configures: the contacts leading the
+	// buyer off the platform, the refunds only the after-sales may promise, and the absolute
+	// claims forbidden by the advertising law.
+	DefaultBannedWords = []string{
+		"微信", "vx", "v信", "wx", "加v", "qq", "私聊", "淘宝", "拼多多", "抖音", "京东",
+		"退款", "全额退", "赔偿", "返现", "包退", "包赔",
+		"最佳", "全网最", "销量第一", "全网第一", "顶级", "国家级", "万能", "100%",
+	}
+
+	// leakMarkers are the pieces of the prompt and of the query json, the answer containing any of
+	// them is an echo of the input rather than a reply
+	leakMarkers = []string{
+		"sku_info", "review_info", "item_type", "item_introduction", "selling_points", "forbidden_claims",
+		"{\"", "```", "你是一名小红书店铺的客服", "只输出回复内容",
+	}
+
+	phonePattern = regexp.MustCompile(`1[3-9]\d{9}`)
+)
+
+// Guardrail checks a generated reply before it is posted.
+type Guardrail struct {
+	MinLength int
+	MaxLength int
+	// BannedWords are matched case-insensitively on top of DefaultBannedWords
+	BannedWords []string
+	// Catalog supplies the forbidden claims of the product of the review, ignored if nil
+	Catalog *catalog.Catalog
+}
+
+// Check returns why the reply must not be posted, empty if it can be.
+func (this *Guardrail) Check(data *ReviewReplyData) string {
+	reply := strings.TrimSpace(data.ReplyContent)
+	length := utf8.RuneCountInString(reply)
+	if length < max(this.MinLength, 1) {
+		return "回复过短"
+	}
+	if this.MaxLength > 0 && length > this.MaxLength {
+		return "回复过长"
+	}
+	lower := strings.ToLower(reply)
+	for _, marker := range leakMarkers {
+		if strings.Contains(lower, strings.ToLower(marker)) {
+			return "回复泄露了提示词:" + marker
+		}
+	}
+	if phonePattern.MatchString(reply) {
+		return "回复包含电话号码"
+	}
+	for _, words := range [][]string{DefaultBannedWords, this.BannedWords} {
+		for _, word := range words {
+			if len(word) != 0 && strings.Contains(lower, strings.ToLower(word)) {
+				return "回复包含违禁词:" + word
+			}
+		}
+	}
+	for _, claim := range this.forbiddenClaims(data) {
+		if len(claim) != 0 && strings.Contains(lower, strings.ToLower(claim)) {
+			return "回复包含商品禁用说法:" + claim
+		}
+	}
+	return ""
+}
+
+func (this *Guardrail) forbiddenClaims(data *ReviewReplyData) []string {
+	if this.Catalog == nil || data.Review == nil || data.Review.SkuInfo == nil {
+		return nil
+	}
+	product, err := this.Catalog.Lookup(data.Review.SkuInfo.ItemID, data.Review.SkuInfo.SkuName)
+	if err != nil {
+		return nil
+	}
+	return product.ForbiddenClaims
+}
+
+// ----------------------------------
+// GuardrailFilter checks the replies generated by the ReplyGenerationFilter, so it must be placed
+// behind it. A rejected reply is generated again at most regenerations times, then it is parked
+// in the approval queue for a human, or dropped if there is no queue.
+type GuardrailFilter struct {
+	guardrail *Guardrail
+	// generation regenerates the rejected replies
+	generation    *ReplyGenerationFilter
+	regenerations int
+	queue         *ApprovalQueue
+}
+
+func NewGuardrailFilter(ctx context.Context, guardrail *Guardrail, generation *ReplyGenerationFilter, regenerations int,
+	queue *ApprovalQueue) *GuardrailFilter {
+	return &GuardrailFilter{guardrail: guardrail, generation: generation, regenerations: regenerations, queue: queue}
+}
+
+func (this *GuardrailFilter) DoFilter(ctx context.Context, data *[]*ReviewReplyData, chain task.FilterChain[[]*ReviewReplyData]) error {
+	var result error
+	passed := make([]*ReviewReplyData, 0, len(*data))
+	for _, reviewReply := range *data {
+		reason := this.check(ctx, reviewReply)
+		if len(reason) == 0 {
+			passed = append(passed, reviewReply)
+			continue
+		}
+		slog.Warn("reply rejected by guardrail.", slog.Any("reviewIds", reviewReply.ReviewIds),
+			slog.String("reply", reviewReply.ReplyContent), slog.String("reason", reason))
+		if err := this.reject(ctx, reviewReply, reason); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	*data = passed
+	if err := chain.Proceed(ctx, data); err != nil {
+		result = multierror.Append(result, err)
+	}
+	return result
+}
+
+// check returns the reason of the last rejection, empty once a reply passes.
+func (this *GuardrailFilter) check(ctx context.Context, reviewReply *ReviewReplyData) string {
+	reason := this.guardrail.Check(reviewReply)
+	for i := 0; len(reason) != 0 && i < this.regenerations && this.generation != nil; i++ {
+		tools.LogFromContext(ctx, "--回复未通过检查, 重新生成-- reviewIds:%v 原因:%s", reviewReply.ReviewIds, reason)
+		if err := this.generation.generate(ctx, reviewReply); err != nil {
+			slog.Error("regenerate reply error.", slog.Any("reviewIds", reviewReply.ReviewIds), tools.ErrAttr(err))
+			return reason
+		}
+		reason = this.guardrail.Check(reviewReply)
+	}
+	return reason
+}
+
+func (this *GuardrailFilter) reject(ctx context.Context, reviewReply *ReviewReplyData, reason string) error {
+	reason = "回复未通过检查: " + reason
+	// nothing is parked in dry-run mode, the rejection is only shown
+	if tools.IsDryRun(ctx) {
+		tools.LogFromContext(ctx, "--试运行, 回复未通过检查-- reviewIds:%v reply:%s 原因:%s",
+			reviewReply.ReviewIds, reviewReply.ReplyContent, reason)
+		return nil
+	}
+	if this.queue == nil {
+		tools.LogFromContext(ctx, "--回复未通过检查, 已丢弃-- reviewIds:%v 原因:%s", reviewReply.ReviewIds, reason)
+		return errors.WithMessagef(ErrReplyRejected, "reviews:%v reply:%s reason:%s",
+			reviewReply.ReviewIds, reviewReply.ReplyContent, reason)
+	}
+	tools.LogFromContext(ctx, "--回复未通过检查, 等待人工审核-- reviewIds:%v 原因:%s", reviewReply.ReviewIds, reason)
+	return this.queue.Add(reviewReply, reason)
+}
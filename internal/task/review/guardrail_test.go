@@ -0,0 +1,149 @@
+package review
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/catalog"
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/xhsreq"
+)
+
+// scriptGenerator answers the replies in turn, the last one is repeated.
+type scriptGenerator struct {
+	replies []string
+	calls   int
+}
+
+func (this *scriptGenerator) Interact(ctx context.Context, param *xhsreq.XHSReviewChatParam) (string, error) {
+	reply := this.replies[min(this.calls, len(this.replies)-1)]
+	this.calls++
+	return reply, nil
+}
+
+func newGuardrailCatalog(t *testing.T) *catalog.Catalog {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "catalog.yaml")
+	content := "products:\n  - item_id: item\n    type: 衣架\n    forbidden_claims:\n      - 永不变形\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	productCatalog, err := catalog.NewCatalog(path)
+	if err != nil {
+		t.Fatalf("NewCatalog() error = %v", err)
+	}
+	return productCatalog
+}
+
+func TestGuardrail_Check(t *testing.T) {
+	guardrail := &Guardrail{
+		MinLength:   DefaultMinReplyLength,
+		MaxLength:   20,
+		BannedWords: []string{"便宜"},
+		Catalog:     newGuardrailCatalog(t),
+	}
+	tests := []struct {
+		name       string
+		reply      string
+		wantReject bool
+	}{
+		{name: "passed", reply: "谢谢宝子的认可, 欢迎再来~"},
+		{name: "too short", reply: " 嗯 ", wantReject: true},
+		{name: "too long", reply: "谢谢宝子的认可, 衣架用得顺手的话欢迎再来逛逛哦~", wantReject: true},
+		{name: "contact", reply: "加我VX领取优惠", wantReject: true},
+		{name: "phone", reply: "有问题打13812345678", wantReject: true},
+		{name: "refund promise", reply: "不满意给你全额退款", wantReject: true},
+		{name: "absolute claim", reply: "全网最好用的衣架", wantReject: true},
+		{name: "banned by config", reply: "我们家最便宜啦", wantReject: true},
+		{name: "leaked json", reply: `{"sku_info":{"item_type":"衣架"}}`, wantReject: true},
+		{name: "leaked prompt", reply: "你是一名小红书店铺的客服", wantReject: true},
+		{name: "forbidden claim", reply: "衣架永不变形哦", wantReject: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := newReplyData("review", 5)
+			data.ReplyContent = tt.reply
+			data.Review.SkuInfo = &xhsreq.SkuInfo{ItemID: "item", SkuName: "衣架"}
+			if got := guardrail.Check(data); (len(got) != 0) != tt.wantReject {
+				t.Errorf("Check() = %v, wantReject %v", got, tt.wantReject)
+			}
+		})
+	}
+}
+
+func TestGuardrailFilter_DoFilter(t *testing.T) {
+	tests := []struct {
+		name          string
+		replies       []string
+		withQueue     bool
+		wantSent      int
+		wantQueued    int
+		wantCalls     int
+		wantRejectErr bool
+	}{
+		{
+			name:      "passed",
+			replies:   []string{"谢谢宝子"},
+			withQueue: true,
+			wantSent:  1,
+			wantCalls: 1,
+		},
+		{
+			name:      "regenerated",
+			replies:   []string{"加微信返现哦", "谢谢宝子"},
+			withQueue: true,
+			wantSent:  1,
+			wantCalls: 2,
+		},
+		{
+			name:       "queued",
+			replies:    []string{"加微信返现哦"},
+			withQueue:  true,
+			wantQueued: 1,
+			wantCalls:  2,
+		},
+		{
+			name:          "dropped",
+			replies:       []string{"加微信返现哦"},
+			wantCalls:     2,
+			wantRejectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var queue *ApprovalQueue
+			if tt.withQueue {
+				var err error
+				if queue, err = NewApprovalQueue(filepath.Join(t.TempDir(), "approval.json")); err != nil {
+					t.Fatalf("NewApprovalQueue() error = %v", err)
+				}
+			}
+			generator := &scriptGenerator{replies: tt.replies}
+			generation := NewReplyGenerationFilter(ctx, generator, nil)
+			guardrail := &Guardrail{MinLength: DefaultMinReplyLength, MaxLength: DefaultMaxReplyLength}
+			next := &recordReplyHandler{}
+			data := []*ReviewReplyData{newReplyData("review", 5)}
+			data[0].Review.SkuInfo = &xhsreq.SkuInfo{ItemID: "item", SkuName: "衣架"}
+			err := task.NewFilterChainManager[[]*ReviewReplyData](
+				next, generation, NewGuardrailFilter(ctx, guardrail, generation, 1, queue),
+			).Proceed(ctx, &data)
+			if (err != nil) != tt.wantRejectErr || (err != nil && !errors.Is(err, ErrReplyRejected)) {
+				t.Errorf("Proceed() error = %v, wantRejectErr %v", err, tt.wantRejectErr)
+			}
+			if len(next.sent) != tt.wantSent {
+				t.Errorf("sent = %d, want %d", len(next.sent), tt.wantSent)
+			}
+			if queue != nil && len(queue.List(ApprovalPending)) != tt.wantQueued {
+				t.Errorf("List() = %d, want %d", len(queue.List(ApprovalPending)), tt.wantQueued)
+			}
+			if generator.calls != tt.wantCalls {
+				t.Errorf("Interact() calls = %d, want %d", generator.calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package review
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"PulseCheck/internal/storage"
+	"PulseCheck/internal/task"
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsfake"
+	"PulseCheck/internal/xhsreq"
+)
+
+// TestPipeline runs the reply task of the cron job against a xhsfake server: the good reviews
+// are replied, the bad ones wait for approval and a second run replies nothing.
+func TestPipeline(t *testing.T) {
+	now := time.Now()
+	fake := xhsfake.New(xhsfake.SampleReviews(5, now)...)
+	fake.SetToken("AT-test-token")
+	server := fake.Start()
+	defer server.Close()
+
+	store, err := storage.Open(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close()
+	queue, err := NewApprovalQueue(filepath.Join(t.TempDir(), "approval.json"))
+	if err != nil {
+		t.Fatalf("NewApprovalQueue() error = %v", err)
+	}
+	ctx := tools.AppendXHSToken(context.Background(), "AT-test-token")
+	httpClient := tools.NewHttpsClient(xhsreq.XiaohongshuDomain)
+	reviewManager := xhsreq.NewReviewManager(ctx, httpClient, xhsreq.WithBaseURL(server.URL))
+	reviewReply := xhsreq.NewReviewReply(ctx, httpClient, xhsreq.WithBaseURL(server.URL))
+	start := now.Add(-24 * time.Hour)
+	param := &xhsreq.ReviewSearchParam{
+		ContentTypeList:       []int{xhsfake.ContentTypeText},
+		ReviewReplyStatusList: []int{xhsfake.ReplyStatusUnreplied},
+		StartTime:             &start,
+		EndTime:               &now,
+		PageSize:              2,
+	}
+
+	generator := &countGenerator{}
+	run := func() error {
+		return task.NewTask[[]*ReviewReplyData](
+			NewReviewProvider(param, reviewManager, store),
+			NewApprovalReplyHandler(ctx, queue, DefaultApprovalPolicy, NewReviewReplyHandler(ctx, reviewReply, store)),
+			NewDedupFilter(ctx, store, queue),
+			NewReplyGenerationFilter(ctx, generator, store),
+		).Execute(ctx)
+	}
+	if err = run(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	// the sku scores of the samples are 5, 2, 5, 3, 1
+	if got := len(fake.Replies()); got != 2 {
+		t.Errorf("Replies() got = %d, want 2", got)
+	}
+	if got := len(queue.List(ApprovalPending)); got != 3 {
+		t.Errorf("List() got = %d, want 3", got)
+	}
+	for _, reply := range fake.Replies() {
+		if replied, _ := store.Ledger().Replied(reply.ReviewIDs[0]); !replied {
+			t.Errorf("Replied(%s) = false, want true", reply.ReviewIDs[0])
+		}
+	}
+	if generator.calls != 5 {
+		t.Errorf("Interact() calls = %d, want 5", generator.calls)
+	}
+
+	if err = run(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if got := len(fake.Replies()); got != 2 {
+		t.Errorf("Replies() got = %d after the second run, want 2", got)
+	}
+	if generator.calls != 5 {
+		t.Errorf("Interact() calls = %d after the second run, want 5", generator.calls)
+	}
+
+	if err = queue.Approve(ctx, NewReviewReplyHandler(ctx, reviewReply, store)); err != nil {
+		t.Fatalf("Approve() error = %v", err)
+	}
+	if got := len(fake.Replies()); got != 5 {
+		t.Errorf("Replies() got = %d after approval, want 5", got)
+	}
+}
+
+func TestPipeline_RiskControl(t *testing.T) {
+	now := time.Now()
+	fake := xhsfake.New(xhsfake.SampleReviews(3, now)...)
+	fake.Inject(xhsreq.ReviewReplyPath, xhsfake.FaultRiskControl)
+	server := fake.Start()
+	defer server.Close()
+
+	ctx := tools.AppendXHSToken(context.Background(), "AT-test-token")
+	httpClient := tools.NewHttpsClient(xhsreq.XiaohongshuDomain)
+	reviewManager := xhsreq.NewReviewManager(ctx, httpClient, xhsreq.WithBaseURL(server.URL))
+	reviewReply := xhsreq.NewReviewReply(ctx, httpClient, xhsreq.WithBaseURL(server.URL))
+	param := &xhsreq.ReviewSearchParam{ReviewReplyStatusList: []int{xhsfake.ReplyStatusUnreplied}}
+	err := task.NewTask[[]*ReviewReplyData](
+		NewReviewProvider(param, reviewManager, nil),
+		NewReviewReplyHandler(ctx, reviewReply, nil),
+		NewReplyGenerationFilter(ctx, &countGenerator{}, nil),
+	).Execute(ctx)
+	if err == nil {
+		t.Errorf("Execute() error = nil, want the risk control error")
+	}
+	// the failed reply does not stop the others
+	if got := len(fake.Replies()); got != 2 {
+		t.Errorf("Replies() got = %d, want 2", got)
+	}
+}
@@ -0,0 +1,130 @@
+package review
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/tools"
+)
+
+// queueEntry is an entry of a jsonQueue, E is the pointer type implementing it and S its status.
+type queueEntry[E any, S ~string] interface {
+	key() string
+	status() S
+	createdAt() time.Time
+	touch(now time.Time)
+	// clone returns a copy which can be handed out of the lock
+	clone() E
+}
+
+// jsonQueue keeps the entries in a json file, which is written again on every change. It backs the
+// approval, follow-up and appeal queues.
+type jsonQueue[E queueEntry[E, S], S ~string] struct {
+	// name of the queue in the errors
+	name    string
+	path    string
+	entries map[string]E
+	// errNotFound and errHandled are wrapped when transit does not find the entry or its status
+	errNotFound error
+	errHandled  error
+	mu          sync.Mutex
+}
+
+func loadJSONQueue[E queueEntry[E, S], S ~string](name string, path string, errNotFound error, errHandled error) (*jsonQueue[E, S], error) {
+	queue := &jsonQueue[E, S]{name: name, path: path, entries: make(map[string]E), errNotFound: errNotFound, errHandled: errHandled}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return queue, nil
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read %s queue:%s error.", name, path)
+	}
+	entries := make([]E, 0)
+	if err = json.Unmarshal(b, &entries); err != nil {
+		return nil, errors.WithMessagef(err, "unmarshal %s queue:%s error.", name, path)
+	}
+	for _, entry := range entries {
+		queue.entries[entry.key()] = entry
+	}
+	return queue, nil
+}
+
+// add puts the entry in the queue, it is ignored if an entry of the same key exists. It returns a
+// copy of the entry kept and whether it is the existing one.
+func (this *jsonQueue[E, S]) add(entry E) (E, bool, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if existing, ok := this.entries[entry.key()]; ok {
+		return existing.clone(), true, nil
+	}
+	this.entries[entry.key()] = entry
+	return entry.clone(), false, this.save()
+}
+
+// get returns a copy of the entry, false if it is not in the queue.
+func (this *jsonQueue[E, S]) get(key string) (E, bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	entry, ok := this.entries[key]
+	if !ok {
+		var zero E
+		return zero, false
+	}
+	return entry.clone(), true
+}
+
+// list returns copies of the entries of the status ordered by creation time, all entries if status is empty.
+func (this *jsonQueue[E, S]) list(status S) []E {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	list := make([]E, 0, len(this.entries))
+	for _, entry := range this.entries {
+		if len(status) == 0 || entry.status() == status {
+			list = append(list, entry.clone())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].createdAt().Before(list[j].createdAt())
+	})
+	return list
+}
+
+// transit modifies the entry if its status is one of from, and returns a copy of it. The entry is
+// left as it is if fn fails.
+func (this *jsonQueue[E, S]) transit(key string, fn func(entry E) error, from ...S) (E, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	var zero E
+	entry, ok := this.entries[key]
+	if !ok {
+		return zero, errors.WithMessagef(this.errNotFound, "id:%s", key)
+	}
+	if !slices.Contains(from, entry.status()) {
+		return zero, errors.WithMessagef(this.errHandled, "id:%s status:%s", key, entry.status())
+	}
+	modified := entry.clone()
+	if err := fn(modified); err != nil {
+		return zero, err
+	}
+	modified.touch(time.Now())
+	this.entries[key] = modified
+	return modified.clone(), this.save()
+}
+
+func (this *jsonQueue[E, S]) save() error {
+	entries := make([]E, 0, len(this.entries))
+	for _, entry := range this.entries {
+		entries = append(entries, entry)
+	}
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return errors.WithMessagef(err, "marshal %s queue error.", this.name)
+	}
+	return tools.WriteFileAtomic(this.path, b, 0o644)
+}
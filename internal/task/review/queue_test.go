@@ -0,0 +1,64 @@
+package review
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestJSONQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "follow_up.json")
+	queue, err := loadJSONQueue[*FollowUp]("follow-up", path, ErrFollowUpNotFound, ErrFollowUpClosed)
+	if err != nil {
+		t.Fatalf("loadJSONQueue() error = %v", err)
+	}
+	now := time.Now()
+	for i, id := range []string{"b", "a"} {
+		created := now.Add(time.Duration(i) * time.Minute)
+		if _, existing, err := queue.add(&FollowUp{Id: id, Status: FollowUpOpen, CreatedAt: created}); err != nil || existing {
+			t.Fatalf("add() existing = %v, error = %v", existing, err)
+		}
+	}
+	if got, existing, _ := queue.add(&FollowUp{Id: "a", Status: FollowUpClosed}); !existing || got.Status != FollowUpOpen {
+		t.Errorf("add() = %#v, %v, want the existing open one", got, existing)
+	}
+
+	failed := errors.New("refused")
+	if _, err = queue.transit("a", func(entry *FollowUp) error {
+		entry.Note = "half done"
+		return failed
+	}, FollowUpOpen); !errors.Is(err, failed) {
+		t.Errorf("transit() error = %v, want %v", err, failed)
+	}
+	if entry, _ := queue.get("a"); len(entry.Note) != 0 {
+		t.Errorf("transit() left note = %v, want the entry untouched", entry.Note)
+	}
+	closed, err := queue.transit("a", func(entry *FollowUp) error {
+		entry.Status = FollowUpClosed
+		return nil
+	}, FollowUpOpen)
+	if err != nil || closed.Status != FollowUpClosed || !closed.UpdatedAt.After(now) {
+		t.Errorf("transit() = %#v, %v, want closed and touched", closed, err)
+	}
+	closed.Note = "modified copy"
+	if _, err = queue.transit("a", func(entry *FollowUp) error { return nil }, FollowUpOpen); !errors.Is(err, ErrFollowUpClosed) {
+		t.Errorf("transit() error = %v, want %v", err, ErrFollowUpClosed)
+	}
+	if _, err = queue.transit("c", func(entry *FollowUp) error { return nil }, FollowUpOpen); !errors.Is(err, ErrFollowUpNotFound) {
+		t.Errorf("transit() error = %v, want %v", err, ErrFollowUpNotFound)
+	}
+
+	reloaded, err := loadJSONQueue[*FollowUp]("follow-up", path, ErrFollowUpNotFound, ErrFollowUpClosed)
+	if err != nil {
+		t.Fatalf("loadJSONQueue() error = %v", err)
+	}
+	list := reloaded.list("")
+	if len(list) != 2 || list[0].Id != "b" || list[1].Id != "a" || list[1].Status != FollowUpClosed || len(list[1].Note) != 0 {
+		t.Errorf("list() = %#v, want b then the closed a", list)
+	}
+	if open := reloaded.list(FollowUpOpen); len(open) != 1 || open[0].Id != "b" {
+		t.Errorf("list(open) = %#v, want b", open)
+	}
+}
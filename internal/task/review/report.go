@@ -0,0 +1,92 @@
+package review
+
+import (
+	"time"
+
+	"PulseCheck/internal/storage"
+	"PulseCheck/internal/xhsreq"
+)
+
+// ClassificationReport counts the reviews of a period by their classification.
+type ClassificationReport struct {
+	Since        time.Time                `json:"since"`
+	Total        int                      `json:"total"`
+	Unclassified int                      `json:"unclassified"`
+	Sentiments   map[xhsreq.Sentiment]int `json:"sentiments"`
+	Topics       map[xhsreq.Topic]int     `json:"topics"`
+	Urgencies    map[xhsreq.Urgency]int   `json:"urgencies"`
+	// Urgent the ids of the reviews of high urgency
+	Urgent []string `json:"urgent"`
+}
+
+func NewClassificationReport(since time.Time, reviews []*xhsreq.Review) *ClassificationReport {
+	report := &ClassificationReport{
+		Since:      since,
+		Sentiments: make(map[xhsreq.Sentiment]int),
+		Topics:     make(map[xhsreq.Topic]int),
+		Urgencies:  make(map[xhsreq.Urgency]int),
+		Urgent:     make([]string, 0),
+	}
+	for _, review := range reviews {
+		report.Total++
+		classification := review.Classification
+		if classification == nil {
+			report.Unclassified++
+			continue
+		}
+		report.Sentiments[classification.Sentiment]++
+		for _, topic := range classification.Topics {
+			report.Topics[topic]++
+		}
+		report.Urgencies[classification.Urgency]++
+		if classification.Urgency == xhsreq.UrgencyHigh {
+			report.Urgent = append(report.Urgent, review.Id)
+		}
+	}
+	return report
+}
+
+// ----------------------------------
+// Digest sums up what the service did over a period, for the operators who do not watch it.
+type Digest struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	// Runs the task runs started in the period, FailedRuns those finished with an error
+	Runs       int `json:"runs"`
+	FailedRuns int `json:"failed_runs"`
+	// Reviews the reviews fetched, by their classification
+	Reviews *ClassificationReport `json:"reviews"`
+	Replied int                   `json:"replied"`
+	// Failures the reply attempts failed in the period
+	Failures []*storage.ReplyAttempt `json:"failures"`
+	// PendingApprovals the replies waiting for a human, of all the shops
+	PendingApprovals int `json:"pending_approvals"`
+}
+
+func NewDigest(since time.Time, until time.Time, runs []*storage.TaskRun, reviews []*xhsreq.Review,
+	attempts []*storage.ReplyAttempt, pendingApprovals int) *Digest {
+	digest := &Digest{
+		Since:            since,
+		Until:            until,
+		Reviews:          NewClassificationReport(since, reviews),
+		Failures:         make([]*storage.ReplyAttempt, 0),
+		PendingApprovals: pendingApprovals,
+	}
+	for _, run := range runs {
+		if run.StartedAt.Before(since) || run.StartedAt.After(until) {
+			continue
+		}
+		digest.Runs++
+		if len(run.Error) != 0 {
+			digest.FailedRuns++
+		}
+	}
+	for _, attempt := range attempts {
+		if attempt.Success {
+			digest.Replied++
+			continue
+		}
+		digest.Failures = append(digest.Failures, attempt)
+	}
+	return digest
+}
@@ -2,35 +2,44 @@ package review
 
 import (
 	"context"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 
+	"PulseCheck/internal/storage"
 	"PulseCheck/internal/tools"
 	"PulseCheck/internal/xhsreq"
 )
 
 type ReviewReplyData struct {
-	ReviewIds     []string
-	ReviewContent string
-	ReplyContent  string
+	ReviewIds     []string       `json:"review_ids"`
+	ReviewContent string         `json:"review_content"`
+	ReplyContent  string         `json:"reply_content"`
+	Review        *xhsreq.Review `json:"review,omitempty"`
 }
 
+// OrderIdReviewProvider fetches the reviews, the replies are generated later by the
+// ReplyGenerationFilter so that the filters ahead of it can drop reviews without spending tokens.
 type OrderIdReviewProvider struct {
 	searchParam   *xhsreq.ReviewSearchParam
 	reviewManager *xhsreq.ReviewManager
-	xhsReviewChat *xhsreq.XHSReviewChat
+	// store records the fetched reviews, nothing is recorded if nil
+	store *storage.Store
 }
 
-func NewReviewProvider(searchParam *xhsreq.ReviewSearchParam, reviewManager *xhsreq.ReviewManager, xhsReviewChat *xhsreq.XHSReviewChat) *OrderIdReviewProvider {
-	return &OrderIdReviewProvider{searchParam: searchParam, reviewManager: reviewManager, xhsReviewChat: xhsReviewChat}
+func NewReviewProvider(searchParam *xhsreq.ReviewSearchParam, reviewManager *xhsreq.ReviewManager, store *storage.Store) *OrderIdReviewProvider {
+	return &OrderIdReviewProvider{searchParam: searchParam, reviewManager: reviewManager, store: store}
 }
 
-func NewOrderIdReviewProvider(ctx context.Context, orderId string, reviewManager *xhsreq.ReviewManager, xhsReviewChat *xhsreq.XHSReviewChat) *OrderIdReviewProvider {
+func NewOrderIdReviewProvider(ctx context.Context, orderId string, reviewManager *xhsreq.ReviewManager, store *storage.Store) *OrderIdReviewProvider {
 	param := &xhsreq.ReviewSearchParam{
 		OrderID: orderId,
 	}
-	return &OrderIdReviewProvider{searchParam: param, reviewManager: reviewManager, xhsReviewChat: xhsReviewChat}
+	return &OrderIdReviewProvider{searchParam: param, reviewManager: reviewManager, store: store}
 }
 
 func (this *OrderIdReviewProvider) Provide(ctx context.Context) (<-chan []*ReviewReplyData, <-chan error) {
@@ -44,12 +53,26 @@ func (this *OrderIdReviewProvider) Provide(ctx context.Context) (<-chan []*Revie
 		reviewSearchParam := this.searchParam
 		tools.LogFromContext(ctx, "--正在获取获取小红书商品评价信息--")
 		tools.LogFromContext(ctx, "searchParam: %#v", *this.searchParam)
-		reviews, err := this.reviewManager.GetReviews(ctx, reviewSearchParam)
-		if err != nil {
-			errChan <- err
+		// all pages are fetched before replying, otherwise the replied reviews would drop out of
+		// the unreplied search result and shift the following pages.
+		reviews, total, err := this.reviewManager.GetReviews(ctx, reviewSearchParam)
+		if errors.Is(err, xhsreq.ErrReviewsTruncated) {
+			// the fetched reviews are replied anyway, the rest are left to the next run
+			tools.LogFromContext(ctx, "--评价页数超过上限, 仅处理已获取的评价-- error:%v", err)
+		} else if err != nil {
+			select {
+			case errChan <- err:
+			case <-ctx.Done():
+			}
 			return
 		}
 		tools.LogFromContext(ctx, "\n--获取成功--")
+		tools.LogFromContext(ctx, "评价总数:%d 已获取:%d", total, len(reviews))
+		if this.store != nil {
+			if err := this.store.Reviews().Save(ctx, reviews...); err != nil {
+				slog.Error("save reviews error.", tools.ErrAttr(err))
+			}
+		}
 		for _, review := range reviews {
 			tools.LogFromContext(ctx, "评论ID:%s", review.Id)
 			tools.LogFromContext(ctx, "评论信息:%s", review.Content)
@@ -57,34 +80,26 @@ func (this *OrderIdReviewProvider) Provide(ctx context.Context) (<-chan []*Revie
 			tools.LogFromContext(ctx, "评分信息:%#v", *review.Score)
 		}
 
-		tools.LogFromContext(ctx, "\n--正在获取回复生成内容--")
-		reviewReplyDataList := make([]*ReviewReplyData, 0, len(reviews))
-		for _, review := range reviews {
-			param := &xhsreq.XHSReviewChatParam{
-				ItemId:        review.SkuInfo.ItemID,
-				ItemInfo:      review.SkuInfo.SkuName,
-				ReviewContent: review.Content,
+		batchSize := reviewSearchParam.PageSize
+		if batchSize <= 0 {
+			batchSize = xhsreq.DefaultPageSizeValue
+		}
+		for start := 0; start < len(reviews); start += batchSize {
+			end := min(start+batchSize, len(reviews))
+			reviewReplyDataList := make([]*ReviewReplyData, 0, end-start)
+			for _, review := range reviews[start:end] {
+				reviewReplyDataList = append(reviewReplyDataList, &ReviewReplyData{
+					ReviewIds:     []string{review.Id},
+					ReviewContent: review.Content,
+					Review:        review,
+				})
 			}
-
-			answer, err := this.xhsReviewChat.Interact(ctx, param)
-			if err != nil {
-				errChan <- err
+			select {
+			case replyDataChan <- reviewReplyDataList:
+			case <-ctx.Done():
 				return
 			}
-			reviewReplyData := &ReviewReplyData{
-				ReviewIds:     []string{review.Id},
-				ReviewContent: review.Content,
-				ReplyContent:  answer,
-			}
-			reviewReplyDataList = append(reviewReplyDataList, reviewReplyData)
-			tools.LogFromContext(ctx, "\n--获取成功--")
-			tools.LogFromContext(ctx, "reviewId:%+v", reviewReplyData.ReviewIds)
-			tools.LogFromContext(ctx, "reviewContent:%s", reviewReplyData.ReviewContent)
-			tools.LogFromContext(ctx, "skuInfo:%#v", *review.SkuInfo)
-			tools.LogFromContext(ctx, "score:%#v", *review.Score)
-			tools.LogFromContext(ctx, "answer:%s", reviewReplyData.ReplyContent)
 		}
-		replyDataChan <- reviewReplyDataList
 	}()
 	return replyDataChan, errChan
 }
@@ -92,16 +107,44 @@ func (this *OrderIdReviewProvider) Provide(ctx context.Context) (<-chan []*Revie
 // ----------------------------------
 type ReviewReplyHandler struct {
 	reviewReply *xhsreq.ReviewReply
+	// store records every reply attempt, nothing is recorded if nil
+	store *storage.Store
+	// proposals are the replies skipped in dry-run mode
+	proposals []*ReviewReplyData
+	// a random delay between minDelay and maxDelay is waited since the last reply before posting
+	// the next one, so that the replies do not look like a bot to the risk control of xiaohongshu
+	minDelay    time.Duration
+	maxDelay    time.Duration
+	lastReplyAt time.Time
+	mu          sync.Mutex
+}
+
+type ReplyHandlerOption func(handler *ReviewReplyHandler)
+
+// WithReplyDelay waits a random delay between minDelay and maxDelay between two replies.
+func WithReplyDelay(minDelay time.Duration, maxDelay time.Duration) ReplyHandlerOption {
+	return func(handler *ReviewReplyHandler) {
+		handler.minDelay = minDelay
+		handler.maxDelay = max(minDelay, maxDelay)
+	}
 }
 
-func NewReviewReplyHandler(ctx context.Context, reviewReply *xhsreq.ReviewReply) *ReviewReplyHandler {
-	return &ReviewReplyHandler{reviewReply: reviewReply}
+func NewReviewReplyHandler(ctx context.Context, reviewReply *xhsreq.ReviewReply, store *storage.Store, opts ...ReplyHandlerOption) *ReviewReplyHandler {
+	handler := &ReviewReplyHandler{reviewReply: reviewReply, store: store}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	return handler
 }
 
 func (this *ReviewReplyHandler) Execute(ctx context.Context, data []*ReviewReplyData) error {
 	if len(data) == 0 {
 		return nil
 	}
+	if tools.IsDryRun(ctx) {
+		this.propose(ctx, data)
+		return nil
+	}
 	tools.LogFromContext(ctx, "\n--正在发起小红书回复--")
 
 	var result error
@@ -112,14 +155,118 @@ func (this *ReviewReplyHandler) Execute(ctx context.Context, data []*ReviewReply
 		}
 		tools.LogFromContext(ctx, "reviewIds:%v", reviewReply.ReviewIds)
 		tools.LogFromContext(ctx, "reply:%s", reviewReply.ReplyContent)
+		// checked again right before posting, the approval queue or a concurrent run may have
+		// replied the review after it passed the DedupFilter
+		if this.replied(reviewReply) {
+			tools.LogFromContext(ctx, "--已回复, 跳过--")
+			continue
+		}
+		if err := this.pace(ctx); err != nil {
+			return multierror.Append(result, err)
+		}
 
 		err := this.reviewReply.Reply(ctx, param)
+		this.mu.Lock()
+		this.lastReplyAt = time.Now()
+		this.mu.Unlock()
+		this.recordAttempt(ctx, reviewReply, err)
 		if err != nil {
 			result = multierror.Append(result, errors.WithMessagef(err, "request param:%#v", *param))
 			tools.LogFromContext(ctx, "--回复失败--")
 			tools.LogFromContext(ctx, "error:%#v", err)
+			continue
 		}
+		this.markReplied(ctx, reviewReply)
 		tools.LogFromContext(ctx, "\n--回复成功--")
 	}
 	return result
 }
+
+// pace waits until a random delay has passed since the last reply, it returns early with the
+// error of ctx if ctx is done.
+func (this *ReviewReplyHandler) pace(ctx context.Context) error {
+	this.mu.Lock()
+	lastReplyAt := this.lastReplyAt
+	this.mu.Unlock()
+	if this.maxDelay <= 0 || lastReplyAt.IsZero() {
+		return nil
+	}
+	delay := this.minDelay + time.Duration(rand.Int64N(int64(this.maxDelay-this.minDelay)+1))
+	wait := time.Until(lastReplyAt.Add(delay))
+	if wait <= 0 {
+		return nil
+	}
+	tools.LogFromContext(ctx, "--等待%v后回复--", wait.Round(time.Second))
+	select {
+	case <-ctx.Done():
+		return errors.WithMessagef(context.Cause(ctx), "wait before reply canceled.")
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+func (this *ReviewReplyHandler) replied(reviewReply *ReviewReplyData) bool {
+	if this.store == nil {
+		return false
+	}
+	for _, reviewId := range reviewReply.ReviewIds {
+		if replied, err := this.store.Ledger().Replied(reviewId); err != nil || replied {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *ReviewReplyHandler) markReplied(ctx context.Context, reviewReply *ReviewReplyData) {
+	if this.store == nil {
+		return
+	}
+	for _, reviewId := range reviewReply.ReviewIds {
+		if err := this.store.Ledger().Mark(ctx, reviewId, reviewReply.ReplyContent); err != nil {
+			slog.Error("mark review replied error.", slog.String("reviewId", reviewId), tools.ErrAttr(err))
+		}
+	}
+}
+
+func (this *ReviewReplyHandler) recordAttempt(ctx context.Context, reviewReply *ReviewReplyData, replyErr error) {
+	if this.store == nil {
+		return
+	}
+	for _, reviewId := range reviewReply.ReviewIds {
+		attempt := &storage.ReplyAttempt{
+			ReviewID:     reviewId,
+			ReplyContent: reviewReply.ReplyContent,
+			Success:      replyErr == nil,
+		}
+		if replyErr != nil {
+			attempt.Error = replyErr.Error()
+		}
+		if err := this.store.Attempts().Save(ctx, attempt); err != nil {
+			slog.Error("save reply attempt error.", slog.String("reviewId", reviewId), tools.ErrAttr(err))
+		}
+	}
+}
+
+func (this *ReviewReplyHandler) propose(ctx context.Context, data []*ReviewReplyData) {
+	tools.LogFromContext(ctx, "\n--试运行, 以下回复不会发布--")
+	for _, reviewReply := range data {
+		slog.Info("dry run, reply not posted.",
+			slog.Any("reviewIds", reviewReply.ReviewIds),
+			slog.String("review", reviewReply.ReviewContent),
+			slog.String("reply", reviewReply.ReplyContent),
+		)
+		tools.LogFromContext(ctx, "reviewIds:%v", reviewReply.ReviewIds)
+		tools.LogFromContext(ctx, "review:%s", reviewReply.ReviewContent)
+		tools.LogFromContext(ctx, "reply:%s", reviewReply.ReplyContent)
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.proposals = append(this.proposals, data...)
+}
+
+// Proposals returns the replies recorded instead of being posted in dry-run mode.
+func (this *ReviewReplyHandler) Proposals() []*ReviewReplyData {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return append([]*ReviewReplyData(nil), this.proposals...)
+}
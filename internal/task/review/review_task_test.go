@@ -0,0 +1,67 @@
+package review
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsreq"
+)
+
+func TestReviewReplyHandler_Execute_DryRun(t *testing.T) {
+	// reviewReply is nil, any attempt to post the reply panics
+	handler := NewReviewReplyHandler(context.Background(), nil, nil)
+	ctx := tools.AppendDryRun(context.Background(), true)
+	data := []*ReviewReplyData{
+		{ReviewIds: []string{"414154303596118952"}, ReviewContent: "包装特别烂", ReplyContent: "抱歉宝子"},
+		{ReviewIds: []string{"414147469536208725"}, ReviewContent: "衣架很有质感", ReplyContent: "谢谢宝子"},
+	}
+	if err := handler.Execute(ctx, data); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if got := handler.Proposals(); len(got) != len(data) {
+		t.Errorf("Proposals() got = %d, want %d", len(got), len(data))
+	}
+}
+
+func TestReviewReplyHandler_Execute_ReplyDelay(t *testing.T) {
+	var postedAt []time.Time
+	httpClient := &http.Client{Transport: tools.RoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		postedAt = append(postedAt, time.Now())
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"code":0,"success":true}`)),
+			Request:    request,
+		}, nil
+	})}
+	ctx := tools.AppendXHSToken(context.Background(), "AT-test-token")
+	minDelay, maxDelay := 50*time.Millisecond, 80*time.Millisecond
+	handler := NewReviewReplyHandler(ctx, xhsreq.NewReviewReply(ctx, httpClient), nil, WithReplyDelay(minDelay, maxDelay))
+	data := []*ReviewReplyData{
+		{ReviewIds: []string{"414154303596118952"}, ReplyContent: "抱歉宝子"},
+		{ReviewIds: []string{"414147469536208725"}, ReplyContent: "谢谢宝子"},
+		{ReviewIds: []string{"414147469536208726"}, ReplyContent: "谢谢宝子"},
+	}
+	if err := handler.Execute(ctx, data); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(postedAt) != len(data) {
+		t.Fatalf("Execute() posted = %d, want %d", len(postedAt), len(data))
+	}
+	for i := 1; i < len(postedAt); i++ {
+		if gap := postedAt[i].Sub(postedAt[i-1]); gap < minDelay {
+			t.Errorf("Execute() gap between reply %d and %d = %v, want at least %v", i-1, i, gap, minDelay)
+		}
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	more := []*ReviewReplyData{{ReviewIds: []string{"414147469536208727"}, ReplyContent: "谢谢宝子"}}
+	if err := handler.Execute(canceled, more); err == nil {
+		t.Errorf("Execute() error = nil, want canceled while waiting")
+	}
+}
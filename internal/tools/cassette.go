@@ -0,0 +1,222 @@
+package tools
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+type CassetteMode string
+
+const (
+	// CassetteReplay answers the requests by the recorded interactions, nothing is sent
+	CassetteReplay CassetteMode = "replay"
+	// CassetteRecord sends the requests and records the interactions, saved by Cassette.Save
+	CassetteRecord CassetteMode = "record"
+
+	// CassetteModeEnv switches the cassettes of the tests to record, e.g. cassette=record go test ./...
+	CassetteModeEnv = "cassette"
+)
+
+var (
+	ErrCassetteMiss = errors.New("no recorded interaction matches the request")
+
+	// scrubbedHeaders never reach the disk, whatever their value is
+	scrubbedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-S"}
+)
+
+// CassetteModeFromEnv returns CassetteRecord if the env cassette is record, CassetteReplay otherwise.
+func CassetteModeFromEnv() CassetteMode {
+	if CassetteMode(os.Getenv(CassetteModeEnv)) == CassetteRecord {
+		return CassetteRecord
+	}
+	return CassetteReplay
+}
+
+type RecordedRequest struct {
+	Method string      `yaml:"method"`
+	URL    string      `yaml:"url"`
+	Header http.Header `yaml:"header,omitempty"`
+	Body   string      `yaml:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `yaml:"status_code"`
+	Header     http.Header `yaml:"header,omitempty"`
+	Body       string      `yaml:"body,omitempty"`
+}
+
+type Interaction struct {
+	Request  RecordedRequest  `yaml:"request"`
+	Response RecordedResponse `yaml:"response"`
+}
+
+// Cassette records the http interactions to a yaml file and replays them, so that the code
+// calling xiaohongshu or the llm can be tested offline. A request is answered by the first
+// interaction not replayed yet with the same method, url and body. The secrets registered by
+// RegisterSecret and the auth headers are scrubbed before recording.
+type Cassette struct {
+	path         string
+	mode         CassetteMode
+	interactions []*Interaction
+	replayed     []bool
+	mu           sync.Mutex
+}
+
+// NewCassette loads the interactions of path in replay mode, a missing file is an error then.
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	cassette := &Cassette{path: path, mode: mode}
+	if mode == CassetteRecord {
+		return cassette, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read cassette:%s error.", path)
+	}
+	if err = yaml.Unmarshal(b, &cassette.interactions); err != nil {
+		return nil, errors.WithMessagef(err, "unmarshal cassette:%s error.", path)
+	}
+	cassette.replayed = make([]bool, len(cassette.interactions))
+	return cassette, nil
+}
+
+func (this *Cassette) Mode() CassetteMode {
+	return this.mode
+}
+
+// Save writes the recorded interactions to the file, nothing is done in replay mode.
+func (this *Cassette) Save() error {
+	if this.mode != CassetteRecord {
+		return nil
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	b, err := yaml.Marshal(this.interactions)
+	if err != nil {
+		return errors.WithMessagef(err, "marshal cassette:%s error.", this.path)
+	}
+	return errors.WithMessagef(WriteFileAtomic(this.path, b, 0o644), "write cassette:%s error.", this.path)
+}
+
+// Middleware replays or records the requests, in replay mode next is never called.
+func (this *Cassette) Middleware(next http.RoundTripper) http.RoundTripper {
+	return &cassetteTransport{next: next, cassette: this}
+}
+
+func (this *Cassette) replay(request *http.Request, body string) (*http.Response, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for i, interaction := range this.interactions {
+		recorded := interaction.Request
+		// the secrets were scrubbed when recorded, so are they before compared
+		if this.replayed[i] || recorded.Method != request.Method || recorded.URL != Redact(request.URL.String()) ||
+			recorded.Body != Redact(body) {
+			continue
+		}
+		this.replayed[i] = true
+		return &http.Response{
+			Status:        http.StatusText(interaction.Response.StatusCode),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Header.Clone(),
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       request,
+		}, nil
+	}
+	return nil, errors.WithMessagef(ErrCassetteMiss, "cassette:%s %s %s body:%s", this.path, request.Method, request.URL, body)
+}
+
+func (this *Cassette) record(request *http.Request, body string, response *http.Response) (*http.Response, error) {
+	b, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read response body of %s error.", request.URL)
+	}
+	response.Body = io.NopCloser(bytes.NewReader(b))
+	interaction := &Interaction{
+		Request: RecordedRequest{
+			Method: request.Method,
+			URL:    Redact(request.URL.String()),
+			Header: scrubHeader(request.Header),
+			Body:   Redact(body),
+		},
+		Response: RecordedResponse{
+			StatusCode: response.StatusCode,
+			Header:     scrubHeader(response.Header),
+			Body:       Redact(string(b)),
+		},
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.interactions = append(this.interactions, interaction)
+	slog.Info("interaction recorded.", slog.String("cassette", this.path), slog.String("url", interaction.Request.URL))
+	return response, nil
+}
+
+func scrubHeader(header http.Header) http.Header {
+	scrubbed := http.Header{}
+	for key, values := range header {
+		for _, value := range values {
+			scrubbed.Add(key, Redact(value))
+		}
+	}
+	for _, key := range scrubbedHeaders {
+		if len(scrubbed.Values(key)) != 0 {
+			scrubbed.Set(key, RedactedValue)
+		}
+	}
+	return scrubbed
+}
+
+// ----------------------------------
+type cassetteTransport struct {
+	next     http.RoundTripper
+	cassette *Cassette
+}
+
+func (this *cassetteTransport) Unwrap() http.RoundTripper {
+	return this.next
+}
+
+func (this *cassetteTransport) setNext(next http.RoundTripper) {
+	this.next = next
+}
+
+func (this *cassetteTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	var body []byte
+	if request.Body != nil && request.Body != http.NoBody {
+		b, err := io.ReadAll(request.Body)
+		_ = request.Body.Close()
+		if err != nil {
+			return nil, errors.WithMessagef(err, "read request body of %s error.", request.URL)
+		}
+		body = b
+		request.Body = io.NopCloser(bytes.NewReader(b))
+	}
+	if this.cassette.mode != CassetteRecord {
+		return this.cassette.replay(request, string(body))
+	}
+	response, err := this.next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	return this.cassette.record(request, string(body), response)
+}
+
+// WithCassette replays or records the requests of the client by cassette, underneath the retries
+// and the rate limits so that every attempt is an interaction.
+func WithCassette(cassette *Cassette) Option {
+	return func(c *http.Client) {
+		wrapTransport(c, cassette.Middleware)
+	}
+}
@@ -9,6 +9,7 @@ import (
 const (
 	XHSToken = "XHS-Token"
 	Writer   = "writer"
+	DryRun   = "dry-run"
 )
 
 func NewValueContext(data map[string]string) context.Context {
@@ -32,6 +33,12 @@ func WithdrawXHSToken(ctx context.Context) string {
 	return token
 }
 
+// LookupXHSToken is WithdrawXHSToken without panic, false is returned if ctx has no token.
+func LookupXHSToken(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(XHSToken).(string)
+	return token, ok
+}
+
 func AppendWriter(ctx context.Context, writeCloser io.Writer) context.Context {
 	return context.WithValue(ctx, Writer, writeCloser)
 }
@@ -43,3 +50,13 @@ func WithdrawWriter(ctx context.Context) io.Writer {
 	}
 	return writer
 }
+
+// AppendDryRun marks the context so that the replies are only generated and recorded, never posted.
+func AppendDryRun(ctx context.Context, dryRun bool) context.Context {
+	return context.WithValue(ctx, DryRun, dryRun)
+}
+
+func IsDryRun(ctx context.Context) bool {
+	dryRun, ok := ctx.Value(DryRun).(bool)
+	return ok && dryRun
+}
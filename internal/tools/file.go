@@ -0,0 +1,23 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// WriteFileAtomic replaces the file through a temporary one so a crash never leaves half of it.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.WithMessagef(err, "create dir of %s error.", path)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return errors.WithMessagef(err, "write file:%s error.", tmp)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.WithMessagef(err, "rename file:%s error.", tmp)
+	}
+	return nil
+}
@@ -43,22 +43,24 @@ type Option func(c *http.Client)
 
 func WithMaxIdleConn(maxIdleConns int) Option {
 	return func(c *http.Client) {
-		c.Transport.(*http.Transport).MaxIdleConns = maxIdleConns
+		transportOf(c).MaxIdleConns = maxIdleConns
 	}
 }
 
 func WithMaxConnsPerHost(maxConnsPerHost int) Option {
 	return func(c *http.Client) {
-		c.Transport.(*http.Transport).MaxConnsPerHost = maxConnsPerHost
+		transportOf(c).MaxConnsPerHost = maxConnsPerHost
 	}
 }
 
 func WithMaxIdleConnsPerHost(maxIdleConnsPerHost int) Option {
 	return func(c *http.Client) {
-		c.Transport.(*http.Transport).MaxIdleConnsPerHost = maxIdleConnsPerHost
+		transportOf(c).MaxIdleConnsPerHost = maxIdleConnsPerHost
 	}
 }
 
+// WithTimeout bounds a request with all its retries, redirects and the read of the body, 0 means
+// no timeout. A retry is not made if its delay would run past the timeout.
 func WithTimeout(timeout time.Duration) Option {
 	return func(c *http.Client) {
 		c.Timeout = timeout
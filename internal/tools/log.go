@@ -17,5 +17,5 @@ func LogFromContext(ctx context.Context, format string, args ...interface{}) {
 			flusher.Flush()
 		}
 	}()
-	fmt.Fprintf(writer, format+"\n", args...)
+	fmt.Fprint(writer, Redact(fmt.Sprintf(format+"\n", args...)))
 }
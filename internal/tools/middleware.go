@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"net/http"
+)
+
+// Middleware wraps the RoundTripper of a client, e.g. to retry or throttle the requests.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to http.RoundTripper.
+type RoundTripperFunc func(request *http.Request) (*http.Response, error)
+
+func (this RoundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return this(request)
+}
+
+// unwrapper is implemented by the middlewares, so that the options can still reach the
+// *http.Transport and the other middlewares underneath.
+type unwrapper interface {
+	Unwrap() http.RoundTripper
+}
+
+// chained is implemented by the middlewares of this package, so that a middleware can be inserted
+// right above the *http.Transport.
+type chained interface {
+	unwrapper
+	setNext(next http.RoundTripper)
+}
+
+// wrapTransport wraps the *http.Transport of the client by middleware, underneath the middlewares
+// of this package, e.g. a request is throttled on every retry rather than once.
+func wrapTransport(c *http.Client, middleware Middleware) {
+	link, ok := c.Transport.(chained)
+	if !ok {
+		c.Transport = middleware(c.Transport)
+		return
+	}
+	for {
+		next, ok := link.Unwrap().(chained)
+		if !ok {
+			link.setNext(middleware(link.Unwrap()))
+			return
+		}
+		link = next
+	}
+}
+
+// WithMiddleware wraps the transport of the client by the middlewares, the first one is the outermost.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(c *http.Client) {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			c.Transport = middlewares[i](c.Transport)
+		}
+	}
+}
+
+// transportOf returns the *http.Transport underneath the middlewares of the client.
+func transportOf(c *http.Client) *http.Transport {
+	roundTripper := c.Transport
+	for {
+		switch t := roundTripper.(type) {
+		case *http.Transport:
+			return t
+		case unwrapper:
+			roundTripper = t.Unwrap()
+		default:
+			panic("http client transport is not *http.Transport")
+		}
+	}
+}
+
+// findRoundTripper returns the first RoundTripper of type T in the middleware chain of the client.
+func findRoundTripper[T http.RoundTripper](c *http.Client) (T, bool) {
+	roundTripper := c.Transport
+	for roundTripper != nil {
+		if t, ok := roundTripper.(T); ok {
+			return t, true
+		}
+		u, ok := roundTripper.(unwrapper)
+		if !ok {
+			break
+		}
+		roundTripper = u.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// Limit is a token bucket refilled by Rate tokens per second and holding at most Burst tokens.
+// A zero Rate means no limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimiter throttles the requests per host, a host without a Limit is not throttled.
+// A RateLimiter can be shared by several clients, e.g. all the shops calling the same llm.
+type RateLimiter struct {
+	limits   map[string]Limit
+	limiters map[string]*rate.Limiter
+	mu       sync.Mutex
+}
+
+func NewRateLimiter(limits map[string]Limit) *RateLimiter {
+	return &RateLimiter{limits: limits, limiters: map[string]*rate.Limiter{}}
+}
+
+// limiter returns the token bucket of host, nil if host is not throttled.
+func (this *RateLimiter) limiter(host string) *rate.Limiter {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if limiter, ok := this.limiters[host]; ok {
+		return limiter
+	}
+	limit, ok := this.limits[host]
+	if !ok || limit.Rate <= 0 {
+		this.limiters[host] = nil
+		return nil
+	}
+	limiter := rate.NewLimiter(rate.Limit(limit.Rate), max(limit.Burst, 1))
+	this.limiters[host] = limiter
+	return limiter
+}
+
+// rateLimitTransport waits for a token of every RateLimiter before sending a request.
+type rateLimitTransport struct {
+	next     http.RoundTripper
+	limiters []*RateLimiter
+}
+
+func (this *rateLimitTransport) Unwrap() http.RoundTripper {
+	return this.next
+}
+
+func (this *rateLimitTransport) setNext(next http.RoundTripper) {
+	this.next = next
+}
+
+func (this *rateLimitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	host := request.URL.Hostname()
+	for _, rateLimiter := range this.limiters {
+		limiter := rateLimiter.limiter(host)
+		if limiter == nil {
+			continue
+		}
+		if err := limiter.Wait(request.Context()); err != nil {
+			return nil, errors.WithMessagef(err, "wait for rate limit of %s error.", host)
+		}
+	}
+	return this.next.RoundTrip(request)
+}
+
+// WithRateLimit throttles the requests by every limiter, the retries included.
+func WithRateLimit(limiters ...*RateLimiter) Option {
+	return func(c *http.Client) {
+		wrapTransport(c, func(next http.RoundTripper) http.RoundTripper {
+			return &rateLimitTransport{next: next, limiters: limiters}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	tests := []struct {
+		name     string
+		limits   map[string]Limit
+		requests int
+		// wantMin the least time the requests take
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{
+			name:     "throttled",
+			limits:   map[string]Limit{u.Hostname(): {Rate: 20, Burst: 1}},
+			requests: 5,
+			wantMin:  150 * time.Millisecond,
+			wantMax:  time.Second,
+		},
+		{
+			name:     "burst",
+			limits:   map[string]Limit{u.Hostname(): {Rate: 1, Burst: 5}},
+			requests: 5,
+			wantMax:  500 * time.Millisecond,
+		},
+		{
+			name:     "other host",
+			limits:   map[string]Limit{"ark.xiaohongshu.com": {Rate: 1, Burst: 1}},
+			requests: 5,
+			wantMax:  500 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewHttpsClient(u.Hostname(), WithRetry(1), WithRateLimit(NewRateLimiter(tt.limits)), WithMaxIdleConn(1))
+			start := time.Now()
+			for i := 0; i < tt.requests; i++ {
+				response, err := client.Get(server.URL)
+				if err != nil {
+					t.Fatalf("Get() error = %v", err)
+				}
+				_ = response.Body.Close()
+			}
+			if elapsed := time.Since(start); elapsed < tt.wantMin || elapsed > tt.wantMax {
+				t.Errorf("Get() took %v, want between %v and %v", elapsed, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestRateLimit_Shared(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	// two clients, e.g. two shops, share the limit of the host
+	limiter := NewRateLimiter(map[string]Limit{u.Hostname(): {Rate: 1, Burst: 1}})
+	first := NewHttpsClient(u.Hostname(), WithRateLimit(limiter))
+	second := NewHttpsClient(u.Hostname(), WithRateLimit(limiter))
+	response, err := first.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	_ = response.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if _, err := second.Do(request); err == nil {
+		t.Errorf("Do() error = nil, want the token taken by the first client")
+	}
+}
+
+func TestWrapTransport(t *testing.T) {
+	client := NewHttpsClient("127.0.0.1", WithRetry(1), WithRateLimit(NewRateLimiter(nil)), WithMaxIdleConn(7))
+	retry, ok := client.Transport.(*retryTransport)
+	if !ok {
+		t.Fatalf("Transport = %T, want *retryTransport outermost", client.Transport)
+	}
+	if _, ok := retry.Unwrap().(*rateLimitTransport); !ok {
+		t.Errorf("Unwrap() = %T, want *rateLimitTransport under the retry", retry.Unwrap())
+	}
+	if got := transportOf(client).MaxIdleConns; got != 7 {
+		t.Errorf("MaxIdleConns = %v, want 7", got)
+	}
+}
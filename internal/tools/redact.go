@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	RedactedValue = "******"
+	// minRedactLength shorter values are not registered, otherwise ordinary words would be redacted
+	minRedactLength = 6
+)
+
+var (
+	redactValues   = map[string]struct{}{}
+	redactMu       sync.Mutex
+	redactReplacer atomic.Pointer[strings.Replacer]
+)
+
+// RegisterSecret makes Redact hide the values from then on.
+func RegisterSecret(values ...string) {
+	redactMu.Lock()
+	defer redactMu.Unlock()
+	changed := false
+	for _, value := range values {
+		if len(value) < minRedactLength {
+			continue
+		}
+		if _, ok := redactValues[value]; ok {
+			continue
+		}
+		redactValues[value] = struct{}{}
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	// the replacer prefers the values given earlier at the same position, the longest goes first so
+	// that a secret containing another one is hidden as a whole
+	sorted := make([]string, 0, len(redactValues))
+	for value := range redactValues {
+		sorted = append(sorted, value)
+	}
+	slices.SortFunc(sorted, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(b), len(a)), strings.Compare(a, b))
+	})
+	oldnew := make([]string, 0, 2*len(sorted))
+	for _, value := range sorted {
+		oldnew = append(oldnew, value, RedactedValue)
+	}
+	redactReplacer.Store(strings.NewReplacer(oldnew...))
+}
+
+// Redact replaces the registered secrets in s.
+func Redact(s string) string {
+	replacer := redactReplacer.Load()
+	if replacer == nil {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+// Mask keeps the head and tail of a secret so that it can still be told apart in logs.
+func Mask(secret string) string {
+	if len(secret) < 2*minRedactLength {
+		return RedactedValue
+	}
+	return secret[:3] + RedactedValue + secret[len(secret)-3:]
+}
@@ -0,0 +1,39 @@
+package tools
+
+import (
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	// the signed token begins with the token, both are registered
+	RegisterSecret("a1b2c3-token")
+	RegisterSecret("a1b2c3-token-0400", "a1b2c3-token")
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{
+			name: "overlapping secrets",
+			s:    "cookie: web_session=a1b2c3-token-0400; path=/",
+			want: "cookie: web_session=" + RedactedValue + "; path=/",
+		},
+		{
+			name: "shorter secret alone",
+			s:    "authorization: a1b2c3-token",
+			want: "authorization: " + RedactedValue,
+		},
+		{
+			name: "too short to register",
+			s:    "code: 0",
+			want: "code: 0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Redact(tt.s); got != tt.want {
+				t.Errorf("Redact() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	Idempotent = "idempotent"
+
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay  = 30 * time.Second
+)
+
+var (
+	// DefaultRetryOnStatus the statuses worth another try, the server is overloaded or restarting
+	DefaultRetryOnStatus = []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+)
+
+// AppendIdempotent marks the requests made with ctx safe to be sent more than once, which is
+// required to retry a POST if WithIdempotentPOSTOnly is set.
+func AppendIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, Idempotent, true)
+}
+
+func IsIdempotent(ctx context.Context) bool {
+	idempotent, ok := ctx.Value(Idempotent).(bool)
+	return ok && idempotent
+}
+
+// retryTransport retries the requests failed by a network error or by one of the statuses in
+// retryOnStatus, with exponential backoff and jitter in between. Retry-After is respected, the
+// request is given up if the server asks to wait longer than maxDelay.
+//
+// All the attempts and the delays in between are bounded by the deadline of the request, which
+// is set by http.Client.Timeout (60s by default, see WithTimeout) as well, so the request is given
+// up as soon as the next delay would run past it, the last response or error is returned then.
+type retryTransport struct {
+	next          http.RoundTripper
+	maxRetries    int
+	baseDelay     time.Duration
+	maxDelay      time.Duration
+	retryOnStatus []int
+	// idempotentPOSTOnly retries POST only if its context is marked by AppendIdempotent
+	idempotentPOSTOnly bool
+}
+
+func (this *retryTransport) Unwrap() http.RoundTripper {
+	return this.next
+}
+
+func (this *retryTransport) setNext(next http.RoundTripper) {
+	this.next = next
+}
+
+func (this *retryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	retryable := this.retryable(request)
+	for attempt := 0; ; attempt++ {
+		// a RoundTripper must not modify the request, a retry is sent by a copy of a fresh body
+		attemptRequest := request
+		if attempt > 0 && request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, errors.WithMessagef(err, "rewind request body of %s error.", request.URL)
+			}
+			attemptRequest = request.Clone(request.Context())
+			attemptRequest.Body = body
+		}
+		response, err := this.next.RoundTrip(attemptRequest)
+		if !retryable || attempt >= this.maxRetries || !this.shouldRetry(request, response, err) {
+			return response, err
+		}
+		delay := this.backoff(attempt)
+		if response != nil {
+			retryAfter, ok := parseRetryAfter(response.Header.Get("Retry-After"))
+			if ok && retryAfter > this.maxDelay {
+				slog.Warn("retry after is too long, request given up.",
+					slog.String("url", request.URL.String()), slog.Duration("retryAfter", retryAfter))
+				return response, err
+			}
+			delay = max(delay, retryAfter)
+		}
+		if deadline, ok := request.Context().Deadline(); ok && time.Until(deadline) < delay {
+			slog.Warn("retry would run past the deadline, request given up.",
+				slog.String("url", request.URL.String()), slog.Duration("delay", delay), slog.Time("deadline", deadline))
+			return response, err
+		}
+		if response != nil {
+			// the connection can only be reused if the body is drained
+			_, _ = io.Copy(io.Discard, response.Body)
+			_ = response.Body.Close()
+		}
+		slog.Warn("request failed, retrying.",
+			slog.String("method", request.Method),
+			slog.String("url", request.URL.String()),
+			slog.Int("attempt", attempt+1),
+			slog.Duration("delay", delay),
+			statusAttr(response),
+			ErrAttr(err),
+		)
+		select {
+		case <-request.Context().Done():
+			return nil, context.Cause(request.Context())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryable tells whether the request can be sent again at all.
+func (this *retryTransport) retryable(request *http.Request) bool {
+	if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+		return false
+	}
+	if request.Method == http.MethodPost && this.idempotentPOSTOnly {
+		return IsIdempotent(request.Context())
+	}
+	return true
+}
+
+func (this *retryTransport) shouldRetry(request *http.Request, response *http.Response, err error) bool {
+	if err != nil {
+		// the caller gave up or the request is not recorded, retrying is pointless
+		return request.Context().Err() == nil && !errors.Is(err, ErrCassetteMiss)
+	}
+	return slices.Contains(this.retryOnStatus, response.StatusCode)
+}
+
+// backoff doubles the delay on every attempt, half of it is random so that the clients
+// failed at the same time do not retry at the same time.
+func (this *retryTransport) backoff(attempt int) time.Duration {
+	delay := this.baseDelay << attempt
+	if delay <= 0 || delay > this.maxDelay {
+		delay = this.maxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int64N(int64(half)+1))
+}
+
+// parseRetryAfter reads both the seconds and the http date form of Retry-After.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if len(value) == 0 {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+func statusAttr(response *http.Response) slog.Attr {
+	if response == nil {
+		return slog.Int("statusCode", 0)
+	}
+	return slog.Int("statusCode", response.StatusCode)
+}
+
+// retryOf returns the retry middleware of the client, it is installed with no retry if missing
+// so that the retry options can be given in any order.
+func retryOf(c *http.Client) *retryTransport {
+	if retry, ok := findRoundTripper[*retryTransport](c); ok {
+		return retry
+	}
+	retry := &retryTransport{
+		next:          c.Transport,
+		baseDelay:     defaultRetryBaseDelay,
+		maxDelay:      defaultRetryMaxDelay,
+		retryOnStatus: DefaultRetryOnStatus,
+	}
+	c.Transport = retry
+	return retry
+}
+
+// WithRetry retries a failed request at most maxRetries times.
+func WithRetry(maxRetries int) Option {
+	return func(c *http.Client) {
+		retryOf(c).maxRetries = maxRetries
+	}
+}
+
+// WithBackoff sets the delay before the first retry, doubled on every retry up to maxDelay.
+func WithBackoff(baseDelay time.Duration, maxDelay time.Duration) Option {
+	return func(c *http.Client) {
+		retry := retryOf(c)
+		retry.baseDelay = baseDelay
+		retry.maxDelay = maxDelay
+	}
+}
+
+// WithRetryOnStatus replaces the statuses retried, DefaultRetryOnStatus by default.
+func WithRetryOnStatus(statuses ...int) Option {
+	return func(c *http.Client) {
+		retryOf(c).retryOnStatus = statuses
+	}
+}
+
+// WithIdempotentPOSTOnly retries a POST only if it is made with a context marked by AppendIdempotent.
+func WithIdempotentPOSTOnly() Option {
+	return func(c *http.Client) {
+		retryOf(c).idempotentPOSTOnly = true
+	}
+}
@@ -0,0 +1,229 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		idempotent bool
+		options    []Option
+		// statuses answered in turn, the last one is repeated
+		statuses   []int
+		retryAfter string
+		wantStatus int
+		wantCalls  int32
+	}{
+		{
+			name:       "retried until ok",
+			method:     http.MethodGet,
+			options:    []Option{WithRetry(3)},
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			wantStatus: http.StatusOK,
+			wantCalls:  3,
+		},
+		{
+			name:       "given up after max retries",
+			method:     http.MethodGet,
+			options:    []Option{WithRetry(2)},
+			statuses:   []int{http.StatusServiceUnavailable},
+			wantStatus: http.StatusServiceUnavailable,
+			wantCalls:  3,
+		},
+		{
+			name:       "status not retried",
+			method:     http.MethodGet,
+			options:    []Option{WithRetry(3)},
+			statuses:   []int{http.StatusInternalServerError, http.StatusOK},
+			wantStatus: http.StatusInternalServerError,
+			wantCalls:  1,
+		},
+		{
+			name:       "retry on status replaced",
+			method:     http.MethodGet,
+			options:    []Option{WithRetryOnStatus(http.StatusInternalServerError), WithRetry(3)},
+			statuses:   []int{http.StatusInternalServerError, http.StatusOK},
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			name:       "post retried",
+			method:     http.MethodPost,
+			options:    []Option{WithRetry(3)},
+			statuses:   []int{http.StatusTooManyRequests, http.StatusOK},
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			name:       "post not idempotent",
+			method:     http.MethodPost,
+			options:    []Option{WithRetry(3), WithIdempotentPOSTOnly()},
+			statuses:   []int{http.StatusTooManyRequests, http.StatusOK},
+			wantStatus: http.StatusTooManyRequests,
+			wantCalls:  1,
+		},
+		{
+			name:       "post idempotent",
+			method:     http.MethodPost,
+			idempotent: true,
+			options:    []Option{WithRetry(3), WithIdempotentPOSTOnly()},
+			statuses:   []int{http.StatusTooManyRequests, http.StatusOK},
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			name:       "retry after too long",
+			method:     http.MethodGet,
+			options:    []Option{WithRetry(3)},
+			statuses:   []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter: "3600",
+			wantStatus: http.StatusTooManyRequests,
+			wantCalls:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				call := calls.Add(1)
+				if b, _ := io.ReadAll(request.Body); request.Method == http.MethodPost && string(b) != "body" {
+					t.Errorf("RoundTrip() body = %s, want body", b)
+				}
+				if len(tt.retryAfter) != 0 {
+					writer.Header().Set("Retry-After", tt.retryAfter)
+				}
+				writer.WriteHeader(tt.statuses[min(int(call), len(tt.statuses))-1])
+			}))
+			defer server.Close()
+
+			options := append([]Option{WithBackoff(time.Millisecond, 10*time.Millisecond)}, tt.options...)
+			client := NewHttpsClient("127.0.0.1", options...)
+			ctx := context.Background()
+			if tt.idempotent {
+				ctx = AppendIdempotent(ctx)
+			}
+			request, err := http.NewRequestWithContext(ctx, tt.method, server.URL, strings.NewReader("body"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			response, err := client.Do(request)
+			if err != nil {
+				t.Errorf("Do() error = %v", err)
+				return
+			}
+			_ = response.Body.Close()
+			if response.StatusCode != tt.wantStatus {
+				t.Errorf("Do() status = %v, want %v", response.StatusCode, tt.wantStatus)
+			}
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("Do() calls = %v, want %v", calls.Load(), tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetry_RequestUntouched(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if b, _ := io.ReadAll(request.Body); string(b) != "body" {
+			t.Errorf("RoundTrip() body = %s, want body", b)
+		}
+		if calls.Add(1) < 3 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	client := NewHttpsClient("127.0.0.1", WithRetry(3), WithBackoff(time.Millisecond, 10*time.Millisecond))
+	request, _ := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("body"))
+	body := request.Body
+	response, err := client.Transport.RoundTrip(request)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Errorf("RoundTrip() status = %v calls = %v, want 200 after 3 calls", response.StatusCode, calls.Load())
+	}
+	if request.Body != body {
+		t.Errorf("RoundTrip() replaced the body of the request")
+	}
+}
+
+func TestRetry_ContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewHttpsClient("127.0.0.1", WithRetry(5), WithBackoff(time.Hour, time.Hour), WithTimeout(0), WithMaxIdleConn(1))
+	// canceled with no deadline, a deadline would give up the retry before waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(50*time.Millisecond, cancel)
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	start := time.Now()
+	if _, err := client.Do(request); err == nil {
+		t.Errorf("Do() error = nil, want context canceled")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Do() took %v, the backoff should stop with the context", elapsed)
+	}
+}
+
+func TestRetry_DeadlineBoundsRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		calls.Add(1)
+		writer.Header().Set("Retry-After", "2")
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// the server asks for a wait within maxDelay, but longer than the client timeout
+	client := NewHttpsClient("127.0.0.1", WithRetry(5), WithBackoff(time.Millisecond, time.Minute),
+		WithTimeout(time.Second), WithMaxIdleConn(1))
+	start := time.Now()
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v, want the last response", err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Errorf("Get() status = %v calls = %v, want 503 after 1 call", response.StatusCode, calls.Load())
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Get() took %v, the retry past the deadline should not be waited", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{value: "", wantOk: false},
+		{value: "120", want: 120 * time.Second, wantOk: true},
+		{value: "-1", want: 0, wantOk: true},
+		{value: "Wed, 21 Oct 2015 07:28:00 GMT", want: 0, wantOk: true},
+		{value: "soon", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("parseRetryAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
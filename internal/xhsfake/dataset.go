@@ -0,0 +1,63 @@
+package xhsfake
+
+import (
+	"fmt"
+	"time"
+
+	"PulseCheck/internal/xhsreq"
+)
+
+// sampleContents are cycled through by SampleReviews, the bad ones are there on purpose.
+var sampleContents = []struct {
+	text     string
+	skuScore uint8
+}{
+	{text: "衣架很有质感也很实用 分别挂了吊带 长裙和健身的小背心", skuScore: 5},
+	{text: "包装特别烂，薄薄的一层纸盒其它没了，纸盒多处破损", skuScore: 2},
+	{text: "挂得多还不占地方，回购了", skuScore: 5},
+	{text: "物流太慢了，等了一个星期", skuScore: 3},
+	{text: "夹子夹不紧，裤子老是掉", skuScore: 1},
+}
+
+var sampleProducts = []struct {
+	itemID string
+	name   string
+}{
+	{itemID: "669b9f0c0916240001ff6ac4", name: "实木波浪衣架内衣吊带衣架家用多功能挂钩 原木色20钩 3个装"},
+	{itemID: "6564c049474aad0001c7641a", name: "不锈钢带钩裤夹多功能夹子无痕 米白 买15送15--共30个"},
+}
+
+// SampleReviews returns n unreplied reviews created one hour apart before now, a dataset for
+// trying the pipeline locally.
+func SampleReviews(n int, now time.Time) []*xhsreq.Review {
+	reviews := make([]*xhsreq.Review, 0, n)
+	for i := 0; i < n; i++ {
+		content := sampleContents[i%len(sampleContents)]
+		product := sampleProducts[i%len(sampleProducts)]
+		reviews = append(reviews, &xhsreq.Review{
+			Id:          fmt.Sprintf("4141%014d", i+1),
+			Content:     content.text,
+			Images:      []string{},
+			CreateTime:  now.Add(-time.Duration(i+1) * time.Hour).Truncate(time.Second),
+			Tags:        []string{},
+			ReviewType:  4,
+			SearchID:    fmt.Sprintf("9272%04d", i+1),
+			Descendants: []*xhsreq.Descendant{},
+			SkuInfo: &xhsreq.SkuInfo{
+				SkuID:    product.itemID,
+				SkuName:  product.name,
+				SkuPrice: 4502,
+				ItemID:   product.itemID,
+				OrderID:  fmt.Sprintf("P7444%014d", i+1),
+				Quantity: 1,
+				Variants: []*xhsreq.SkuVariant{},
+			},
+			Score: &xhsreq.Score{SkuScore: content.skuScore, ServiceScore: 5, LogisticsScore: 5},
+			ButtonList: []*xhsreq.ReviewButton{
+				{Text: "回复评价", ButtonType: xhsreq.ButtonTypeReply},
+				{Text: "申诉评价", ButtonType: xhsreq.ButtonTypeAppeal},
+			},
+		})
+	}
+	return reviews
+}
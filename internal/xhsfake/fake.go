@@ -0,0 +1,411 @@
+// Package xhsfake is an in-process stand-in of the review_manager and seller_reply endpoints of the xiaohongshu seller api, so that the reply pipeline can be run end to end without
+// a shop.
+package xhsfake
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsreq"
+)
+
+const (
+	// the reply statuses of review_reply_status_list, as the fake understands them
+	ReplyStatusReplied   = 1
+	ReplyStatusUnreplied = 2
+	// the content types of content_type_list, as the fake understands them
+	ContentTypeImage = 1
+	ContentTypeText  = 2
+
+	CodeSuccess     = 0
+	CodeExpired     = -100
+	CodeRiskControl = 300011
+	CodeReplied     = -1
+	CodeIllegal     = -2
+)
+
+var (
+	FaultExpired     = Fault{Code: CodeExpired, Msg: "登录已过期"}
+	FaultRiskControl = Fault{Code: CodeRiskControl, Msg: "操作过于频繁, 请稍后再试"}
+	FaultUnavailable = Fault{StatusCode: http.StatusServiceUnavailable, Msg: "service unavailable"}
+)
+
+// Fault is answered instead of the normal response, StatusCode 200 if zero.
+type Fault struct {
+	StatusCode int
+	Code       int64
+	Msg        string
+	// Delay is waited before answering, e.g. to trigger the timeout of the client
+	Delay time.Duration
+}
+
+// Reply is a reply posted to the seller_reply endpoint.
+type Reply struct {
+	ReviewIDs []string  `json:"review_ids"`
+	Content   string    `json:"content"`
+	RepliedAt time.Time `json:"replied_at"`
+}
+
+// Fake serves the reviews it is given, filtered and paged like xiaohongshu does, and records the
+// replies. It is an http.Handler, Start serves it by an httptest.Server.
+type Fake struct {
+	reviews []*xhsreq.Review
+	replies []*Reply
+	// faults are answered one per request before the normal responses, by path
+	faults   map[string][]Fault
+	requests map[string]int
+	// maxPageSize caps the page size requested if set
+	maxPageSize int
+	// token must be carried by the cookie if set
+	token   string
+	expired bool
+	mu      sync.Mutex
+}
+
+func New(reviews ...*xhsreq.Review) *Fake {
+	fake := &Fake{faults: map[string][]Fault{}, requests: map[string]int{}}
+	fake.AddReviews(reviews...)
+	return fake
+}
+
+// Start serves the fake on a local port, the server must be closed by the caller.
+func (this *Fake) Start() *httptest.Server {
+	return httptest.NewServer(this)
+}
+
+func (this *Fake) AddReviews(reviews ...*xhsreq.Review) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.reviews = append(this.reviews, reviews...)
+	// the newest first, like the seller center
+	slices.SortStableFunc(this.reviews, func(a, b *xhsreq.Review) int {
+		return b.CreateTime.Compare(a.CreateTime)
+	})
+}
+
+// SetMaxPageSize answers at most size reviews per page whatever page size is requested, like the
+// server capping a large page size.
+func (this *Fake) SetMaxPageSize(size int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.maxPageSize = size
+}
+
+// SetToken requires the cookie of every request to carry token, any token is accepted if empty.
+// The fake is no longer expired then.
+func (this *Fake) SetToken(token string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.token = token
+	this.expired = false
+}
+
+// Expire answers every request with an expired login until SetToken is called.
+func (this *Fake) Expire() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.expired = true
+}
+
+// Inject answers the next requests to path, e.g. xhsreq.ReviewReplyPath, by the faults in order.
+func (this *Fake) Inject(path string, faults ...Fault) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.faults[path] = append(this.faults[path], faults...)
+}
+
+// Replies returns the replies posted successfully.
+func (this *Fake) Replies() []*Reply {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return append([]*Reply(nil), this.replies...)
+}
+
+// Requests returns the number of requests received by path, the failed ones included.
+func (this *Fake) Requests(path string) int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.requests[path]
+}
+
+// Review returns the review of id with its reply state, nil if unknown.
+func (this *Fake) Review(id string) *xhsreq.Review {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.find(id)
+}
+
+func (this *Fake) find(id string) *xhsreq.Review {
+	for _, review := range this.reviews {
+		if review.Id == id {
+			return review
+		}
+	}
+	return nil
+}
+
+func (this *Fake) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	this.mu.Lock()
+	this.requests[request.URL.Path]++
+	this.mu.Unlock()
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if fault, ok := this.fault(request); ok {
+		time.Sleep(fault.Delay)
+		writeResult(writer, fault.StatusCode, fault.Code, fault.Msg, nil)
+		return
+	}
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		writeResult(writer, http.StatusBadRequest, CodeIllegal, err.Error(), nil)
+		return
+	}
+	jsonData := gjson.ParseBytes(body)
+	switch request.URL.Path {
+	case xhsreq.ReviewManagerPath:
+		this.reviewManager(writer, jsonData)
+	case xhsreq.ReviewReplyPath:
+		this.sellerReply(writer, jsonData)
+	default:
+		writer.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// fault returns the fault to answer the request with, an injected one or an expired login.
+func (this *Fake) fault(request *http.Request) (Fault, bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if faults := this.faults[request.URL.Path]; len(faults) != 0 {
+		this.faults[request.URL.Path] = faults[1:]
+		return faults[0], true
+	}
+	if this.expired || !strings.Contains(request.Header.Get("cookie"), this.token) {
+		return FaultExpired, true
+	}
+	return Fault{}, false
+}
+
+func (this *Fake) reviewManager(writer http.ResponseWriter, jsonData gjson.Result) {
+	pageSize := int(jsonData.Get(xhsreq.PageSizeKey).Int())
+	if pageSize <= 0 {
+		pageSize = xhsreq.DefaultPageSizeValue
+	}
+	pageNum := max(int(jsonData.Get(xhsreq.PageNumKey).Int()), xhsreq.DefaultPageNumValue)
+
+	this.mu.Lock()
+	if this.maxPageSize > 0 {
+		pageSize = min(pageSize, this.maxPageSize)
+	}
+	matched := make([]*xhsreq.Review, 0, len(this.reviews))
+	for _, review := range this.reviews {
+		if match(review, jsonData) {
+			matched = append(matched, review)
+		}
+	}
+	from, to := min((pageNum-1)*pageSize, len(matched)), min(pageNum*pageSize, len(matched))
+	list := make([]any, 0, to-from)
+	for _, review := range matched[from:to] {
+		list = append(list, marshalReview(review))
+	}
+	this.mu.Unlock()
+
+	writeResult(writer, http.StatusOK, CodeSuccess, "成功", map[string]any{
+		xhsreq.ReviewInfoList.String(): list,
+		xhsreq.Total.String():          len(matched),
+	})
+}
+
+// match tells whether the review meets the search condition of the request body.
+func match(review *xhsreq.Review, jsonData gjson.Result) bool {
+	if orderID := jsonData.Get(xhsreq.OrderIdKey).String(); len(orderID) != 0 {
+		return review.SkuInfo != nil && review.SkuInfo.OrderID == orderID
+	}
+	if statuses := ints(jsonData.Get(strings.TrimSuffix(xhsreq.ReviewReplyStatusArrayPrefix, "."))); len(statuses) != 0 {
+		status := ReplyStatusUnreplied
+		if review.ReplyNum > 0 {
+			status = ReplyStatusReplied
+		}
+		if !slices.Contains(statuses, status) {
+			return false
+		}
+	}
+	if contentTypes := ints(jsonData.Get(strings.TrimSuffix(xhsreq.ContentTypeArrayPrefix, "."))); len(contentTypes) != 0 {
+		withImage := slices.Contains(contentTypes, ContentTypeImage) && len(review.Images) != 0
+		withText := slices.Contains(contentTypes, ContentTypeText) && len(review.Content) != 0
+		if !withImage && !withText {
+			return false
+		}
+	}
+	if start := jsonData.Get(xhsreq.ReviewStartTimeKey); start.Exists() && review.CreateTime.Unix() < start.Int() {
+		return false
+	}
+	if end := jsonData.Get(xhsreq.ReviewEndTimeKey); end.Exists() && review.CreateTime.Unix() > end.Int() {
+		return false
+	}
+	return true
+}
+
+func ints(result gjson.Result) []int {
+	values := make([]int, 0)
+	for _, value := range result.Array() {
+		values = append(values, int(value.Int()))
+	}
+	return values
+}
+
+func (this *Fake) sellerReply(writer http.ResponseWriter, jsonData gjson.Result) {
+	content := jsonData.Get(xhsreq.ContentKey.Join(xhsreq.TextKey).String()).String()
+	reviewIDs := make([]string, 0)
+	for _, id := range jsonData.Get(xhsreq.ReviewIDKey.String()).Array() {
+		reviewIDs = append(reviewIDs, id.String())
+	}
+	if len(content) == 0 || len(reviewIDs) == 0 {
+		writeResult(writer, http.StatusOK, CodeIllegal, "参数错误", nil)
+		return
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	reviews := make([]*xhsreq.Review, 0, len(reviewIDs))
+	for _, id := range reviewIDs {
+		review := this.find(id)
+		if review == nil {
+			writeResult(writer, http.StatusOK, CodeIllegal, "评价不存在", nil)
+			return
+		}
+		if !review.Replyable() {
+			writeResult(writer, http.StatusOK, CodeReplied, "该评价已回复", nil)
+			return
+		}
+		reviews = append(reviews, review)
+	}
+	for _, review := range reviews {
+		review.ReplyNum++
+		if button := review.Button(xhsreq.ButtonTypeReply); button != nil {
+			button.Disabled = true
+		}
+	}
+	this.replies = append(this.replies, &Reply{ReviewIDs: reviewIDs, Content: content, RepliedAt: time.Now()})
+	slog.Info("xhsfake reply recorded.", slog.Any("reviewIds", reviewIDs), slog.String("content", content))
+	writeResult(writer, http.StatusOK, CodeSuccess, "成功", map[string]any{})
+}
+
+// marshalReview renders the review the way review_manager does.
+func marshalReview(review *xhsreq.Review) map[string]any {
+	images := func(links []string) []any {
+		list := make([]any, 0, len(links))
+		for _, link := range links {
+			list = append(list, map[string]any{xhsreq.ImageLink.String(): link})
+		}
+		return list
+	}
+	descendants := make([]any, 0, len(review.Descendants))
+	for _, descendant := range review.Descendants {
+		descendants = append(descendants, map[string]any{
+			xhsreq.ReviewID.String():   descendant.Id,
+			xhsreq.Content.String():    map[string]any{xhsreq.Text.String(): descendant.Content, xhsreq.Images.String(): images(descendant.Images)},
+			xhsreq.CreateTime.String(): descendant.CreateTime.Unix(),
+		})
+	}
+	reviewData := map[string]any{
+		xhsreq.ReviewID.String():    review.Id,
+		xhsreq.Content.String():     map[string]any{xhsreq.Text.String(): review.Content, xhsreq.Images.String(): images(review.Images)},
+		xhsreq.CreateTime.String():  review.CreateTime.Unix(),
+		xhsreq.Tags.String():        append([]string{}, review.Tags...),
+		xhsreq.Anonymous.String():   review.Anonymous,
+		xhsreq.ReviewType.String():  review.ReviewType,
+		xhsreq.SearchID.String():    review.SearchID,
+		xhsreq.Descendants.String(): descendants,
+	}
+	if review.Score != nil {
+		reviewData[xhsreq.SkuScore.String()] = review.Score.SkuScore
+		reviewData[xhsreq.ServiceScore.String()] = review.Score.ServiceScore
+		reviewData[xhsreq.LogisticsScore.String()] = review.Score.LogisticsScore
+	}
+	buttons := make([]any, 0, len(review.ButtonList))
+	for _, button := range review.ButtonList {
+		disabled := 0
+		if button.Disabled {
+			disabled = 1
+		}
+		buttons = append(buttons, map[string]any{
+			xhsreq.ButtonText.String(): button.Text,
+			xhsreq.Disabled.String():   disabled,
+			xhsreq.ButtonType.String(): button.ButtonType,
+			xhsreq.Status.String():     button.Status,
+		})
+	}
+	reviewInfo := map[string]any{
+		xhsreq.ReviewData.String():      reviewData,
+		xhsreq.InteractionInfo.String(): map[string]any{xhsreq.ReplyNum.String(): review.ReplyNum, xhsreq.LikeNum.String(): review.LikeNum},
+		xhsreq.ButtonList.String():      buttons,
+	}
+	if sku := review.SkuInfo; sku != nil {
+		variants := make([]any, 0, len(sku.Variants))
+		for _, variant := range sku.Variants {
+			variants = append(variants, map[string]any{
+				xhsreq.VariantID.String():    variant.Id,
+				xhsreq.VariantName.String():  variant.Name,
+				xhsreq.VariantValue.String(): variant.Value,
+			})
+		}
+		reviewInfo[xhsreq.SkuInfo1.String()] = map[string]any{
+			xhsreq.SkuID.String():        sku.SkuID,
+			xhsreq.SkuName.String():      sku.SkuName,
+			xhsreq.SkuPrice.String():     sku.SkuPrice,
+			xhsreq.ItemID.String():       sku.ItemID,
+			xhsreq.OrderID.String():      sku.OrderID,
+			xhsreq.SkuQuantity.String():  sku.Quantity,
+			xhsreq.SkuImageLink.String(): sku.ImageLink,
+			xhsreq.Variants.String():     variants,
+		}
+	}
+	return reviewInfo
+}
+
+func writeResult(writer http.ResponseWriter, statusCode int, code int64, msg string, data any) {
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(statusCode)
+	result := map[string]any{
+		xhsreq.Code.String(): code,
+		"success":            code == CodeSuccess,
+		xhsreq.Msg.String():  msg,
+	}
+	if data != nil {
+		result[xhsreq.Data.String()] = data
+	}
+	if err := json.NewEncoder(writer).Encode(result); err != nil {
+		slog.Error("xhsfake write response error.", tools.ErrAttr(err))
+	}
+}
+
+// ----------------------------------
+// LoadReviews reads a dataset, a json array of xhsreq.Review.
+func LoadReviews(path string) ([]*xhsreq.Review, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read reviews:%s error.", path)
+	}
+	reviews := make([]*xhsreq.Review, 0)
+	if err = json.Unmarshal(b, &reviews); err != nil {
+		return nil, errors.WithMessagef(err, "unmarshal reviews:%s error.", path)
+	}
+	return reviews, nil
+}
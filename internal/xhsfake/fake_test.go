@@ -0,0 +1,185 @@
+package xhsfake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/session"
+	"PulseCheck/internal/tools"
+	"PulseCheck/internal/xhsreq"
+)
+
+func TestFake_ReviewManager(t *testing.T) {
+	now := time.Now()
+	reviews := SampleReviews(5, now)
+	reviews[0].ReplyNum = 1
+	reviews[1].Content = ""
+	fake := New(reviews...)
+	server := fake.Start()
+	defer server.Close()
+
+	ctx := tools.AppendXHSToken(context.Background(), "AT-test-token")
+	manager := xhsreq.NewReviewManager(ctx, tools.NewHttpsClient(xhsreq.XiaohongshuDomain), xhsreq.WithBaseURL(server.URL))
+	start := now.Add(-3*time.Hour - time.Minute)
+	tests := []struct {
+		name      string
+		param     *xhsreq.ReviewSearchParam
+		wantIds   []string
+		wantTotal int
+	}{
+		{
+			name:      "all pages",
+			param:     &xhsreq.ReviewSearchParam{PageSize: 2},
+			wantIds:   []string{reviews[0].Id, reviews[1].Id, reviews[2].Id, reviews[3].Id, reviews[4].Id},
+			wantTotal: 5,
+		},
+		{
+			name:      "by order id",
+			param:     &xhsreq.ReviewSearchParam{OrderID: reviews[3].SkuInfo.OrderID},
+			wantIds:   []string{reviews[3].Id},
+			wantTotal: 1,
+		},
+		{
+			name:      "unreplied with text",
+			param:     &xhsreq.ReviewSearchParam{ReviewReplyStatusList: []int{ReplyStatusUnreplied}, ContentTypeList: []int{ContentTypeText}},
+			wantIds:   []string{reviews[2].Id, reviews[3].Id, reviews[4].Id},
+			wantTotal: 3,
+		},
+		{
+			name:      "created after start",
+			param:     &xhsreq.ReviewSearchParam{StartTime: &start, EndTime: &now},
+			wantIds:   []string{reviews[0].Id, reviews[1].Id, reviews[2].Id},
+			wantTotal: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := manager.GetReviews(ctx, tt.param)
+			if err != nil {
+				t.Fatalf("GetReviews() error = %v", err)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("GetReviews() total = %v, want %v", total, tt.wantTotal)
+			}
+			gotIds := make([]string, 0, len(got))
+			for _, review := range got {
+				gotIds = append(gotIds, review.Id)
+			}
+			if len(gotIds) != len(tt.wantIds) {
+				t.Fatalf("GetReviews() ids = %v, want %v", gotIds, tt.wantIds)
+			}
+			for i := range gotIds {
+				if gotIds[i] != tt.wantIds[i] {
+					t.Errorf("GetReviews() ids = %v, want %v", gotIds, tt.wantIds)
+					break
+				}
+			}
+		})
+	}
+	// the review survives the round trip
+	got, _, _ := manager.GetReviews(ctx, &xhsreq.ReviewSearchParam{OrderID: reviews[2].SkuInfo.OrderID})
+	if len(got) != 1 || got[0].Score.SkuScore != reviews[2].Score.SkuScore || !got[0].CreateTime.Equal(reviews[2].CreateTime) ||
+		got[0].SkuInfo.ItemID != reviews[2].SkuInfo.ItemID || !got[0].Replyable() {
+		t.Errorf("GetReviews() got = %+v, want %+v", got, reviews[2])
+	}
+}
+
+func TestFake_ReviewManager_Truncated(t *testing.T) {
+	reviews := SampleReviews(xhsreq.MaxPageNum+1, time.Now())
+	server := New(reviews...).Start()
+	defer server.Close()
+
+	ctx := tools.AppendXHSToken(context.Background(), "AT-test-token")
+	manager := xhsreq.NewReviewManager(ctx, tools.NewHttpsClient(xhsreq.XiaohongshuDomain), xhsreq.WithBaseURL(server.URL))
+	got, total, err := manager.GetReviews(ctx, &xhsreq.ReviewSearchParam{PageSize: 1})
+	if !errors.Is(err, xhsreq.ErrReviewsTruncated) {
+		t.Fatalf("GetReviews() error = %v, want %v", err, xhsreq.ErrReviewsTruncated)
+	}
+	if len(got) != xhsreq.MaxPageNum || total != len(reviews) {
+		t.Errorf("GetReviews() fetched = %d, total = %d", len(got), total)
+	}
+}
+
+func TestFake_ReviewManager_PageSizeCapped(t *testing.T) {
+	reviews := SampleReviews(7, time.Now())
+	fake := New(reviews...)
+	fake.SetMaxPageSize(3)
+	server := fake.Start()
+	defer server.Close()
+
+	ctx := tools.AppendXHSToken(context.Background(), "AT-test-token")
+	manager := xhsreq.NewReviewManager(ctx, tools.NewHttpsClient(xhsreq.XiaohongshuDomain), xhsreq.WithBaseURL(server.URL))
+	got, total, err := manager.GetReviews(ctx, &xhsreq.ReviewSearchParam{PageSize: 5})
+	if err != nil {
+		t.Fatalf("GetReviews() error = %v", err)
+	}
+	if len(got) != len(reviews) || total != len(reviews) {
+		t.Errorf("GetReviews() fetched = %d, total = %d, want %d", len(got), total, len(reviews))
+	}
+}
+
+func TestFake_SellerReply(t *testing.T) {
+	reviews := SampleReviews(2, time.Now())
+	fake := New(reviews...)
+	fake.SetToken("AT-test-token")
+	server := fake.Start()
+	defer server.Close()
+
+	shopSession := session.New("test", nil)
+	ctx := session.AppendSession(tools.AppendXHSToken(context.Background(), "AT-test-token"), shopSession)
+	reply := xhsreq.NewReviewReply(ctx, tools.NewHttpsClient(xhsreq.XiaohongshuDomain), xhsreq.WithBaseURL(server.URL))
+	param := func(id string) *xhsreq.ReviewReplyParam {
+		return &xhsreq.ReviewReplyParam{ReviewIds: []string{id}, ReplyContent: "谢谢宝子"}
+	}
+
+	if err := reply.Reply(ctx, param(reviews[0].Id)); err != nil {
+		t.Fatalf("Reply() error = %v", err)
+	}
+	if got := fake.Review(reviews[0].Id); got.ReplyNum != 1 || got.Replyable() {
+		t.Errorf("Review() got = %+v, want replied", got)
+	}
+	if err := reply.Reply(ctx, param(reviews[0].Id)); err == nil {
+		t.Errorf("Reply() error = nil, want replied already")
+	}
+	if err := reply.Reply(ctx, param("unknown")); err == nil {
+		t.Errorf("Reply() error = nil, want unknown review")
+	}
+
+	fake.Inject(xhsreq.ReviewReplyPath, FaultRiskControl)
+	if err := reply.Reply(ctx, param(reviews[1].Id)); err == nil || errors.Is(err, session.ErrSessionExpired) {
+		t.Errorf("Reply() error = %v, want risk control", err)
+	}
+
+	fake.Expire()
+	err := reply.Reply(ctx, param(reviews[1].Id))
+	if !errors.Is(err, session.ErrSessionExpired) {
+		t.Errorf("Reply() error = %v, want %v", err, session.ErrSessionExpired)
+	}
+	// the session stops the calls once expired
+	requests := fake.Requests(xhsreq.ReviewReplyPath)
+	if err := reply.Reply(ctx, param(reviews[1].Id)); !errors.Is(err, session.ErrSessionExpired) {
+		t.Errorf("Reply() error = %v, want %v", err, session.ErrSessionExpired)
+	}
+	if got := fake.Requests(xhsreq.ReviewReplyPath); got != requests {
+		t.Errorf("Requests() got = %d, want %d", got, requests)
+	}
+	if got := len(fake.Replies()); got != 1 {
+		t.Errorf("Replies() got = %d, want 1", got)
+	}
+}
+
+func TestFake_Token(t *testing.T) {
+	fake := New(SampleReviews(1, time.Now())...)
+	fake.SetToken("AT-test-token")
+	server := fake.Start()
+	defer server.Close()
+
+	ctx := tools.AppendXHSToken(context.Background(), "AT-wrong-token")
+	manager := xhsreq.NewReviewManager(ctx, tools.NewHttpsClient(xhsreq.XiaohongshuDomain), xhsreq.WithBaseURL(server.URL))
+	if _, _, err := manager.GetReviews(ctx, &xhsreq.ReviewSearchParam{}); !errors.Is(err, session.ErrSessionExpired) {
+		t.Errorf("GetReviews() error = %v, want %v", err, session.ErrSessionExpired)
+	}
+}
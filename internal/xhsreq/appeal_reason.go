@@ -0,0 +1,47 @@
+package xhsreq
+
+// AppealReason is why a review is worth appealing by the "申诉评价" button, the operator files the
+// appeal in the seller center by it.
+type AppealReason int
+
+const (
+	// AppealReasonAbusive insults or personal attacks
+	AppealReasonAbusive AppealReason = iota + 1
+	// AppealReasonSpam ads, contacts or links leading off the platform
+	AppealReasonSpam
+	// AppealReasonCompetitor a competitor running the shop down or promoting its own
+	AppealReasonCompetitor
+	// AppealReasonIrrelevant meaningless or not about the item
+	AppealReasonIrrelevant
+	AppealReasonOther
+)
+
+var (
+	// AppealReasonNames names the reasons in the configuration
+	AppealReasonNames = map[string]AppealReason{
+		"abusive":    AppealReasonAbusive,
+		"spam":       AppealReasonSpam,
+		"competitor": AppealReasonCompetitor,
+		"irrelevant": AppealReasonIrrelevant,
+		"other":      AppealReasonOther,
+	}
+	appealReasonTexts = map[AppealReason]string{
+		AppealReasonAbusive:    "辱骂/人身攻击",
+		AppealReasonSpam:       "广告/垃圾信息",
+		AppealReasonCompetitor: "同行恶意评价",
+		AppealReasonIrrelevant: "与商品无关",
+		AppealReasonOther:      "其他",
+	}
+)
+
+func (this AppealReason) String() string {
+	if text, ok := appealReasonTexts[this]; ok {
+		return text
+	}
+	return "未知"
+}
+
+func (this AppealReason) Valid() bool {
+	_, ok := appealReasonTexts[this]
+	return ok
+}
@@ -0,0 +1,37 @@
+package xhsreq
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"PulseCheck/internal/session"
+)
+
+var (
+	// authExpiredCodes the codes xiaohongshu answers with once the access token is no longer accepted
+	authExpiredCodes = []int64{-100, -101, -104, 401, 403}
+	// authExpiredMessages are looked for in msg in case a new code shows up
+	authExpiredMessages = []string{"登录已过期", "登录过期", "未登录", "请重新登录", "登录失效", "token失效", "token过期"}
+)
+
+// checkAuthExpired returns an error wrapping session.ErrSessionExpired if the response tells the
+// access token expired, nil otherwise.
+func checkAuthExpired(statusCode int, jsonData gjson.Result) error {
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		return errors.WithMessagef(session.ErrSessionExpired, "statusCode:%d", statusCode)
+	}
+	code, msg := jsonData.Get(Code.String()), jsonData.Get(Msg.String()).String()
+	if code.Exists() && slices.Contains(authExpiredCodes, code.Int()) {
+		return errors.WithMessagef(session.ErrSessionExpired, "code:%d msg:%s", code.Int(), msg)
+	}
+	for _, message := range authExpiredMessages {
+		if strings.Contains(strings.ToLower(msg), message) {
+			return errors.WithMessagef(session.ErrSessionExpired, "code:%d msg:%s", code.Int(), msg)
+		}
+	}
+	return nil
+}
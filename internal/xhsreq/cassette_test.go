@@ -0,0 +1,46 @@
+package xhsreq
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"PulseCheck/internal/secret"
+	"PulseCheck/internal/tools"
+)
+
+// The tests of this package replay the interactions under testdata, nothing is sent. To record
+// them again against the live services run
+//
+//	cassette=record auth=<token> llm_key=<key> go test ./internal/xhsreq
+//
+// the token and the key are scrubbed from the recorded files.
+
+// newCassetteClient returns a client replaying testdata/<name>.yaml, or recording it if the env
+// cassette is record.
+func newCassetteClient(t *testing.T, name string, domain string) *http.Client {
+	t.Helper()
+	cassette, err := tools.NewCassette(filepath.Join("testdata", name+".yaml"), tools.CassetteModeFromEnv())
+	if err != nil {
+		t.Fatalf("NewCassette() error = %v", err)
+	}
+	t.Cleanup(func() {
+		if err := cassette.Save(); err != nil {
+			t.Errorf("Save() error = %v", err)
+		}
+	})
+	return tools.NewHttpsClient(domain, tools.WithCassette(cassette))
+}
+
+// testSecrets returns the real token and llm key from the env when recording, fake ones otherwise.
+func testSecrets() secret.Provider {
+	if tools.CassetteModeFromEnv() == tools.CassetteRecord {
+		return secret.NewEnvProvider()
+	}
+	return secret.Static{secret.XHSToken: "AT-test-token", secret.LLMKey: "app-test-key"}
+}
+
+func testContext() context.Context {
+	return secret.AppendProvider(context.Background(), testSecrets())
+}
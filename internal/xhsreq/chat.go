@@ -6,7 +6,6 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
@@ -15,34 +14,41 @@ import (
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 
+	"PulseCheck/internal/catalog"
+	"PulseCheck/internal/secret"
 	"PulseCheck/internal/tools"
 )
 
-var (
-	// initialize item type - item id mapping
-	itemIDTypeMapping = map[string]string{
-		"6564c049474aad0001c7641a": "裤夹|通过裤夹可以将裤子挂起来收纳到衣柜中,简单方便,整齐,省空间",
-		"660ced34f46f6600013ee667": "垃圾架|可以适配各种类型的外卖袋和购物袋颜值超高,清洗方便",
-		"669b9f0c0916240001ff6ac4": "吊带衣架|一个顶20个的吊带衣架,挂的多,省空间,拿取方便",
-		"65e0718b3f330b0001d94c29": "缩脖子衣架|衣架缩脖子设计,省空间,垂直空间节约8厘米",
-		"66ad1c39274e530001234bf9": "收纳线槽|桌底收纳电线整齐,方便调整",
-	}
-)
-
 type XHSReviewChatParam struct {
 	ItemId        string `json:"item_id" validate:"required"`
 	ItemInfo      string `json:"item_info" validate:"required"`
 	ReviewContent string `json:"review_content" validate:"required"`
+	// Classification of the review is handed to the LLM along with it, if tagged
+	Classification *Classification `json:"classification,omitempty" validate:"-"`
 }
 
+// XHSReviewChat generates the reply by a dify chat app
 type XHSReviewChat struct {
 	httpClient *http.Client
+	catalog    *catalog.Catalog
+	url        string
+	// responseMode is blocking or streaming, a streamed answer is given up after idleTimeout
+	// without any event
+	responseMode ResponseMode
+	idleTimeout  time.Duration
+	// secrets holds the bearer key of the dify app, looked up on every request so that a rotated
+	// key takes effect without restart
+	secrets secret.Provider
 }
 
 const (
 	SkuInfoPath    Path = "sku_info"
 	ItemTypePath   Path = "item_type"
 	ItemIntroPath  Path = "item_introduction"
+	SellingPath    Path = "selling_points"
+	FAQPath        Path = "faq"
+	ForbiddenPath  Path = "forbidden_claims"
+	TonePath       Path = "tone"
 	ReviewInfoPath Path = "review_info"
 	TextPath       Path = "text"
 
@@ -54,23 +60,14 @@ const (
 )
 
 func (this *XHSReviewChat) newRequestBody(ctx context.Context, param *XHSReviewChatParam) ([]byte, error) {
-	queryJsonData := []byte("{}")
-	tools.LogFromContext(ctx, "\n--正在转化商品信息--")
-	itemTypeInfo, ok := itemIDTypeMapping[param.ItemId]
-	if !ok {
-		return nil, errors.Errorf("could find itemtype by itemid. SearchParam:%#v", param)
+	query, err := newReviewQuery(ctx, this.catalog, param)
+	if err != nil {
+		return nil, err
 	}
-	splitItemTypeInfo := strings.Split(itemTypeInfo, "|")
-	tools.LogFromContext(ctx, "itemId:%s -> itemType:%s", param.ItemId, splitItemTypeInfo[0])
-	tools.LogFromContext(ctx, "text:%s", splitItemTypeInfo[1])
-
-	queryJsonData, _ = sjson.SetBytes(queryJsonData, SkuInfoPath.Join(ItemTypePath).String(), splitItemTypeInfo[0])
-	queryJsonData, _ = sjson.SetBytes(queryJsonData, SkuInfoPath.Join(ItemIntroPath).String(), splitItemTypeInfo[1])
-	queryJsonData, _ = sjson.SetBytes(queryJsonData, ReviewInfoPath.Join(TextPath).String(), param.ReviewContent)
 
 	difyData := []byte("{}")
-	difyData, _ = sjson.SetBytes(difyData, QueryPath.String(), queryJsonData)
-	difyData, _ = sjson.SetBytes(difyData, ResponseModePath.String(), "blocking")
+	difyData, _ = sjson.SetBytes(difyData, QueryPath.String(), query.JSON())
+	difyData, _ = sjson.SetBytes(difyData, ResponseModePath.String(), this.responseMode)
 	difyData, _ = sjson.SetBytes(difyData, UserPath.String(), "abc-123")
 	difyData, _ = sjson.SetBytes(difyData, ConversationPath.String(), "")
 	difyData, _ = sjson.SetRawBytes(difyData, InputPath.String(), []byte("{}"))
@@ -84,29 +81,56 @@ func (this *XHSReviewChat) validate(ctx context.Context, param *XHSReviewChatPar
 	return errors.WithMessagef(err, "param:%#v", param)
 }
 
-const (
-	difyKey = "Bearer app-SpZD4UXXSR5AQsyq5FF5ohZ9"
-)
-
 func (this *XHSReviewChat) Interact(ctx context.Context, param *XHSReviewChatParam) (string, error) {
 	err := this.validate(ctx, param)
 	if nil != err {
 		return "", err
 	}
 	body, err := this.newRequestBody(ctx, param)
+	if nil != err {
+		return "", err
+	}
 	bodyStr := string(body)
 	slog.Info(spew.Sprintf("new request body:%s with param:%#v", bodyStr, param))
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.dify.ai/v1/chat-messages", bytes.NewBuffer(body))
+	requestCtx, idle := ctx, (*time.Timer)(nil)
+	if this.responseMode == StreamingMode {
+		// the request is canceled once the stream is idle, the client given by the caller should have no
+		// timeout (see NewXHSReviewChatWithHTTP), or a long answer is cut by it however active the stream is
+		var cancel context.CancelCauseFunc
+		requestCtx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		idle = time.AfterFunc(this.idleTimeout, func() {
+			cancel(errors.WithMessagef(ErrStreamIdle, "no event within %v", this.idleTimeout))
+		})
+		defer idle.Stop()
+	}
+	request, err := http.NewRequestWithContext(requestCtx, http.MethodPost, this.url, bytes.NewBuffer(body))
 	if nil != err {
 		return "", errors.WithMessagef(err, "new request error. body:%s", bodyStr)
 	}
-	request.Header.Set("Authorization", difyKey)
+	apiKey, err := this.secrets.Get(ctx, secret.LLMKey)
+	if nil != err {
+		return "", errors.WithMessagef(err, "get dify api key error.")
+	}
+	request.Header.Set("Authorization", "Bearer "+apiKey)
 	request.Header.Set("Content-Type", "application/json")
 
 	response, err := this.httpClient.Do(request)
 	if nil != err {
+		if cause := context.Cause(requestCtx); cause != nil && ctx.Err() == nil {
+			err = cause
+		}
 		return "", errors.WithMessagef(err, "request failed with param:%#v requestBody:%s", param, bodyStr)
 	}
+	respBody := response.Body
+	defer func() {
+		// drained so that the connection is reused after an early return
+		_, _ = io.Copy(io.Discard, respBody)
+		err := respBody.Close()
+		if err != nil {
+			slog.Error("close response body err.", tools.ErrAttr(err))
+		}
+	}()
 	statusCode := response.StatusCode
 	if statusCode != http.StatusOK {
 		slog.Error("get dify response error.",
@@ -114,15 +138,12 @@ func (this *XHSReviewChat) Interact(ctx context.Context, param *XHSReviewChatPar
 			slog.String("body", bodyStr),
 		)
 		return "", errors.Errorf("get dify response error. difyURL:%s statusCode:%d requestBody:%s",
-			DifyDomain, statusCode, bodyStr)
+			this.url, statusCode, bodyStr)
+	}
+	if this.responseMode == StreamingMode {
+		answer, err := this.readStream(requestCtx, respBody, idle)
+		return answer, errors.WithMessagef(err, "read dify stream fail with param:%#v body:%s", param, bodyStr)
 	}
-	respBody := response.Body
-	defer func() {
-		err := respBody.Close()
-		if err != nil {
-			slog.Error("close response body err.", tools.ErrAttr(err))
-		}
-	}()
 	b, err := io.ReadAll(respBody)
 	if err != nil {
 		return "", errors.WithMessagef(err, "read response body fail with param:%#v body:%#v", param, bodyStr)
@@ -144,10 +165,30 @@ func (this *XHSReviewChat) withdrawAnswer(ctx context.Context, response []byte)
 	return result.String(), nil
 }
 
-func NewXHSReviewChat(ctx context.Context, httpClient *http.Client) *XHSReviewChat {
-	return &XHSReviewChat{httpClient: httpClient}
+// NewXHSReviewChat answers in blocking mode unless WithStreaming is given, the base url of
+// WithBaseURL is ignored, url is the full endpoint.
+func NewXHSReviewChat(ctx context.Context, httpClient *http.Client, productCatalog *catalog.Catalog, url string, secrets secret.Provider,
+	opts ...ClientOption) *XHSReviewChat {
+	conf := newClientConfig(DifyBaseURL, opts)
+	return &XHSReviewChat{
+		httpClient:   httpClient,
+		catalog:      productCatalog,
+		url:          url,
+		responseMode: conf.responseMode,
+		idleTimeout:  conf.idleTimeout,
+		secrets:      secrets,
+	}
 }
 
-func NewXHSReviewChatWithHTTP(ctx context.Context) *XHSReviewChat {
-	return &XHSReviewChat{httpClient: tools.NewHttpsClient(DifyDomain, tools.WithTimeout(2*time.Minute))}
+// NewXHSReviewChatWithHTTP posts to DifyChatURL, or to the chat-messages endpoint under the url of
+// WithBaseURL, e.g. a difyfake server.
+func NewXHSReviewChatWithHTTP(ctx context.Context, productCatalog *catalog.Catalog, secrets secret.Provider, opts ...ClientOption) *XHSReviewChat {
+	conf := newClientConfig(DifyBaseURL, opts)
+	httpOptions := []tools.Option{tools.WithTimeout(DefaultGeneratorTimeout)}
+	if conf.responseMode == StreamingMode {
+		// the stream is bounded by the idle timeout only, a long answer may take longer than any timeout
+		httpOptions = []tools.Option{tools.WithTimeout(0)}
+	}
+	httpClient := tools.NewHttpsClient(DifyDomain, httpOptions...)
+	return NewXHSReviewChat(ctx, httpClient, productCatalog, conf.baseURL+DifyChatPath, secrets, opts...)
 }
@@ -0,0 +1,91 @@
+package xhsreq
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"PulseCheck/internal/tools"
+)
+
+type ResponseMode string
+
+const (
+	// BlockingMode answers when the whole answer is generated
+	BlockingMode ResponseMode = "blocking"
+	// StreamingMode answers by server-sent events as the answer is generated
+	StreamingMode ResponseMode = "streaming"
+
+	EventPath        Path = "event"
+	ErrorMessagePath Path = "message"
+	ErrorCodePath    Path = "code"
+	ErrorStatusPath  Path = "status"
+	TotalTokensPath  Path = "metadata.usage.total_tokens"
+
+	EventMessage        = "message"
+	EventAgentMessage   = "agent_message"
+	EventMessageReplace = "message_replace"
+	EventMessageEnd     = "message_end"
+	EventError          = "error"
+
+	// maxEventSize the message_end event carries the retriever resources, which can be large
+	maxEventSize = 1 << 20
+)
+
+var (
+	ErrStreamIdle       = errors.New("dify stream idle")
+	ErrStreamIncomplete = errors.New("dify stream ended without message_end")
+)
+
+// readStream assembles the answer from the message events until message_end, the progress is
+// written to the caller by tools.LogFromContext. idle is reset on every line received.
+func (this *XHSReviewChat) readStream(ctx context.Context, body io.Reader, idle *time.Timer) (string, error) {
+	tools.LogFromContext(ctx, "\n--正在生成回复--")
+	var answer strings.Builder
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEventSize)
+	for scanner.Scan() {
+		if idle != nil {
+			idle.Reset(this.idleTimeout)
+		}
+		// the other lines are the event names, the pings and the blank lines between the events
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		event := gjson.Parse(strings.TrimSpace(data))
+		switch event.Get(EventPath.String()).String() {
+		case EventMessage, EventAgentMessage:
+			chunk := event.Get(AnswerPath.String()).String()
+			answer.WriteString(chunk)
+			tools.LogFromContext(ctx, "已生成%d字:%s", utf8.RuneCountInString(answer.String()), chunk)
+		case EventMessageReplace:
+			// the answer is replaced as a whole, e.g. by the content moderation of dify
+			answer.Reset()
+			answer.WriteString(event.Get(AnswerPath.String()).String())
+			tools.LogFromContext(ctx, "回复被替换为:%s", answer.String())
+		case EventMessageEnd:
+			slog.Info("dify stream ended.", slog.Int64("totalTokens", event.Get(TotalTokensPath.String()).Int()))
+			tools.LogFromContext(ctx, "--回复生成完毕--")
+			return answer.String(), nil
+		case EventError:
+			return "", errors.Errorf("dify stream error event. status:%d code:%s message:%s answer so far:%s",
+				event.Get(ErrorStatusPath.String()).Int(), event.Get(ErrorCodePath.String()).String(),
+				event.Get(ErrorMessagePath.String()).String(), answer.String())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if cause := context.Cause(ctx); cause != nil {
+			err = cause
+		}
+		return "", errors.WithMessagef(err, "read dify stream error. answer so far:%s", answer.String())
+	}
+	return "", errors.WithMessagef(ErrStreamIncomplete, "answer so far:%s", answer.String())
+}
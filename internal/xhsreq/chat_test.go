@@ -3,46 +3,65 @@ package xhsreq
 import (
 	"context"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"PulseCheck/internal/catalog"
+	"PulseCheck/internal/difyfake"
+	"PulseCheck/internal/secret"
 	"PulseCheck/internal/tools"
 )
 
 func TestXHSReviewChat_Interact(t *testing.T) {
-	type fields struct {
-		httpClient *http.Client
+	productCatalog, err := catalog.NewCatalog("testdata/catalog.yaml")
+	if err != nil {
+		t.Fatalf("NewCatalog() error = %v", err)
 	}
 	type args struct {
 		ctx   context.Context
 		param *XHSReviewChatParam
 	}
 	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		want    string
-		wantErr bool
+		name     string
+		cassette string
+		args     args
+		want     string
+		wantErr  bool
 	}{
 		{
-			name: "test",
-			fields: fields{
-				httpClient: tools.NewHttpsClient(nil, DifyDomain),
+			name:     "answered",
+			cassette: "dify_chat",
+			args: args{
+				ctx: testContext(),
+				param: &XHSReviewChatParam{
+					ItemId:        "6564c049474aad0001c7641a",
+					ItemInfo:      "通过裤夹可以将裤子挂起来收纳到衣柜中,简单方便,整齐,省空间",
+					ReviewContent: "不要买！ 质量很差 ！跟我之前买的一点也不一样！合住都对不上！",
+				},
 			},
+			want: "宝子抱歉给你带来不好的体验😭 裤夹合不上可能是夹口被挤压变形了, 麻烦联系客服给你补发或者退换哦~",
+		},
+		{
+			name:     "unauthorized",
+			cassette: "dify_chat_unauthorized",
 			args: args{
-				ctx: tools.AppendXHSToken(context.Background(), "AT-68c517428216101088487948dfhuvp629ni26cvc"),
+				ctx: testContext(),
 				param: &XHSReviewChatParam{
 					ItemId:        "6564c049474aad0001c7641a",
 					ItemInfo:      "通过裤夹可以将裤子挂起来收纳到衣柜中,简单方便,整齐,省空间",
 					ReviewContent: "不要买！ 质量很差 ！跟我之前买的一点也不一样！合住都对不上！",
 				},
 			},
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			this := &XHSReviewChat{
-				httpClient: tt.fields.httpClient,
-			}
+			this := NewXHSReviewChat(tt.args.ctx, newCassetteClient(t, tt.cassette, DifyDomain), productCatalog, DifyChatURL, testSecrets())
 			got, err := this.Interact(tt.args.ctx, tt.args.param)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Interact() error = %v, wantErr %v", err, tt.wantErr)
@@ -54,3 +73,400 @@ func TestXHSReviewChat_Interact(t *testing.T) {
 		})
 	}
 }
+
+func TestXHSReviewChat_newRequestBody(t *testing.T) {
+	knowledge, err := catalog.NewCatalog("testdata/catalog_knowledge.yaml")
+	if err != nil {
+		t.Fatalf("NewCatalog() error = %v", err)
+	}
+	withFallback, err := catalog.NewCatalog("testdata/catalog.yaml")
+	if err != nil {
+		t.Fatalf("NewCatalog() error = %v", err)
+	}
+	tests := []struct {
+		name      string
+		catalog   *catalog.Catalog
+		param     *XHSReviewChatParam
+		wantQuery string
+		wantErr   bool
+	}{
+		{
+			name:    "product knowledge",
+			catalog: knowledge,
+			param: &XHSReviewChatParam{
+				ItemId:        "6564c049474aad0001c7641a",
+				ItemInfo:      "裤夹 10个装",
+				ReviewContent: "夹得很紧",
+			},
+			wantQuery: `{"sku_info":{"item_type":"裤夹","item_introduction":"通过裤夹可以将裤子挂起来收纳到衣柜中,简单方便,整齐,省空间",` +
+				`"selling_points":["防滑夹口","一次挂5条"],"faq":[{"question":"夹口会留印子吗","answer":"夹口有软垫, 不会留印子"}],` +
+				`"forbidden_claims":["永久不坏"],"tone":"活泼"},"review_info":{"text":"夹得很紧"}}`,
+		},
+		{
+			name:    "fallback",
+			catalog: withFallback,
+			param: &XHSReviewChatParam{
+				ItemId:        "unknown",
+				ItemInfo:      "懒人挂钩 白色",
+				ReviewContent: "挺好用",
+			},
+			wantQuery: `{"sku_info":{"item_type":"商品","item_introduction":"懒人挂钩 白色"},"review_info":{"text":"挺好用"}}`,
+		},
+		{
+			name:    "classified",
+			catalog: withFallback,
+			param: &XHSReviewChatParam{
+				ItemId:        "unknown",
+				ItemInfo:      "懒人挂钩 白色",
+				ReviewContent: "钩子断了, 要退货",
+				Classification: &Classification{
+					Sentiment: SentimentNegative,
+					Topics:    []Topic{TopicQuality},
+					Urgency:   UrgencyHigh,
+				},
+			},
+			wantQuery: `{"sku_info":{"item_type":"商品","item_introduction":"懒人挂钩 白色"},` +
+				`"review_info":{"text":"钩子断了, 要退货","sentiment":"negative","topics":["quality"],"urgency":"high"}}`,
+		},
+		{
+			name:    "unknown item",
+			catalog: knowledge,
+			param: &XHSReviewChatParam{
+				ItemId:        "unknown",
+				ItemInfo:      "懒人挂钩 白色",
+				ReviewContent: "挺好用",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "review content missing",
+			catalog: knowledge,
+			param: &XHSReviewChatParam{
+				ItemId:   "6564c049474aad0001c7641a",
+				ItemInfo: "裤夹 10个装",
+			},
+			wantErr: true,
+		},
+		{
+			name: "catalog missing",
+			param: &XHSReviewChatParam{
+				ItemId:        "6564c049474aad0001c7641a",
+				ItemInfo:      "裤夹 10个装",
+				ReviewContent: "夹得很紧",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			this := NewXHSReviewChat(context.Background(), http.DefaultClient, tt.catalog, DifyChatURL, testSecrets())
+			got, err := this.newRequestBody(context.Background(), tt.param)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newRequestBody() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			jsonData := gjson.ParseBytes(got)
+			if query := jsonData.Get(QueryPath.String()).String(); query != tt.wantQuery {
+				t.Errorf("newRequestBody() query = %v, want %v", query, tt.wantQuery)
+			}
+			if mode := jsonData.Get(ResponseModePath.String()).String(); mode != "blocking" {
+				t.Errorf("newRequestBody() response_mode = %v, want blocking", mode)
+			}
+			if inputs := jsonData.Get(InputPath.String()).Raw; inputs != "{}" {
+				t.Errorf("newRequestBody() inputs = %v, want {}", inputs)
+			}
+		})
+	}
+}
+
+func TestXHSReviewChat_withdrawAnswer(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "answer",
+			response: `{"event":"message","message_id":"m","answer":"谢谢宝子~","metadata":{"usage":{"total_tokens":10}}}`,
+			want:     "谢谢宝子~",
+		},
+		{
+			name:     "empty answer",
+			response: `{"event":"message","answer":""}`,
+			want:     "",
+		},
+		{
+			name:     "answer missing",
+			response: `{"code":"invalid_param","message":"query is required","status":400}`,
+			wantErr:  true,
+		},
+		{
+			name:     "not json",
+			response: `<html>502 Bad Gateway</html>`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			this := &XHSReviewChat{}
+			got, err := this.withdrawAnswer(context.Background(), []byte(tt.response))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("withdrawAnswer() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("withdrawAnswer() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestXHSReviewChat_Interact_Fake(t *testing.T) {
+	productCatalog, err := catalog.NewCatalog("testdata/catalog_knowledge.yaml")
+	if err != nil {
+		t.Fatalf("NewCatalog() error = %v", err)
+	}
+	param := &XHSReviewChatParam{
+		ItemId:        "6564c049474aad0001c7641a",
+		ItemInfo:      "裤夹 10个装",
+		ReviewContent: "夹得很紧, 一次能挂好几条",
+	}
+	tests := []struct {
+		name    string
+		setup   func(fake *difyfake.Fake)
+		secrets secret.Provider
+		timeout time.Duration
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "scripted answer",
+			setup: func(fake *difyfake.Fake) {
+				fake.Script("谢谢宝子的认可~")
+			},
+			want: "谢谢宝子的认可~",
+		},
+		{
+			name: "default answer",
+			want: "感谢宝子对裤夹的评价「夹得很紧, 一次能挂」~",
+		},
+		{
+			name: "service unavailable",
+			setup: func(fake *difyfake.Fake) {
+				fake.Inject(difyfake.FaultUnavailable)
+			},
+			wantErr: true,
+		},
+		{
+			name: "timeout",
+			setup: func(fake *difyfake.Fake) {
+				fake.SetLatency(200 * time.Millisecond)
+			},
+			timeout: 50 * time.Millisecond,
+			wantErr: true,
+		},
+		{
+			name:    "wrong key",
+			secrets: secret.Static{secret.LLMKey: "app-wrong-key"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := difyfake.New()
+			fake.SetAPIKey("app-test-key")
+			if tt.setup != nil {
+				tt.setup(fake)
+			}
+			server := fake.Start()
+			defer server.Close()
+
+			timeout, secrets := tt.timeout, tt.secrets
+			if timeout == 0 {
+				timeout = time.Second
+			}
+			if secrets == nil {
+				secrets = testSecrets()
+			}
+			client := tools.NewHttpsClient("127.0.0.1", tools.WithTimeout(timeout))
+			this := NewXHSReviewChat(context.Background(), client, productCatalog, server.URL+DifyChatPath, secrets)
+			got, err := this.Interact(context.Background(), param)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Interact() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Interact() got = %v, want %v", got, tt.want)
+			}
+			requests := fake.Requests()
+			if len(requests) != 1 {
+				t.Fatalf("Interact() requests = %v, want 1", len(requests))
+			}
+			if review := gjson.Get(requests[0].Query, ReviewInfoPath.Join(TextPath).String()).String(); review != param.ReviewContent {
+				t.Errorf("Interact() review sent = %v, want %v", review, param.ReviewContent)
+			}
+		})
+	}
+}
+
+func TestXHSReviewChat_Interact_Streaming(t *testing.T) {
+	productCatalog, err := catalog.NewCatalog("testdata/catalog_knowledge.yaml")
+	if err != nil {
+		t.Fatalf("NewCatalog() error = %v", err)
+	}
+	param := &XHSReviewChatParam{
+		ItemId:        "6564c049474aad0001c7641a",
+		ItemInfo:      "裤夹 10个装",
+		ReviewContent: "夹得很紧, 一次能挂好几条",
+	}
+	tests := []struct {
+		name         string
+		setup        func(fake *difyfake.Fake)
+		idleTimeout  time.Duration
+		want         string
+		wantProgress string
+		wantErr      bool
+		wantErrIs    error
+	}{
+		{
+			name: "assembled",
+			setup: func(fake *difyfake.Fake) {
+				fake.Script("谢谢宝子的认可, 欢迎再来~")
+			},
+			want:         "谢谢宝子的认可, 欢迎再来~",
+			wantProgress: "已生成8字:的认可,",
+		},
+		{
+			name: "slow but not idle",
+			setup: func(fake *difyfake.Fake) {
+				fake.Script("谢谢宝子的认可, 欢迎再来~")
+				fake.SetLatency(50 * time.Millisecond)
+			},
+			// 4 chunks take longer than the idle timeout, every one of them comes within it
+			idleTimeout: 150 * time.Millisecond,
+			want:        "谢谢宝子的认可, 欢迎再来~",
+		},
+		{
+			name: "error event",
+			setup: func(fake *difyfake.Fake) {
+				fake.Inject(difyfake.FaultStreamError)
+			},
+			wantProgress: "已生成4字:感谢宝子",
+			wantErr:      true,
+		},
+		{
+			name: "idle",
+			setup: func(fake *difyfake.Fake) {
+				fake.SetLatency(300 * time.Millisecond)
+			},
+			idleTimeout: 50 * time.Millisecond,
+			wantErr:     true,
+			wantErrIs:   ErrStreamIdle,
+		},
+		{
+			name: "unauthorized",
+			setup: func(fake *difyfake.Fake) {
+				fake.Inject(difyfake.FaultUnauthorized)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := difyfake.New()
+			tt.setup(fake)
+			server := fake.Start()
+			defer server.Close()
+
+			idleTimeout := tt.idleTimeout
+			if idleTimeout == 0 {
+				idleTimeout = time.Second
+			}
+			var progress strings.Builder
+			ctx := tools.AppendWriter(context.Background(), &progress)
+			this := NewXHSReviewChat(ctx, tools.NewHttpsClient("127.0.0.1"), productCatalog, server.URL+DifyChatPath,
+				testSecrets(), WithStreaming(idleTimeout))
+			got, err := this.Interact(ctx, param)
+			if (err != nil) != tt.wantErr || (tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs)) {
+				t.Errorf("Interact() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Interact() got = %v, want %v", got, tt.want)
+			}
+			if !strings.Contains(progress.String(), tt.wantProgress) {
+				t.Errorf("Interact() progress = %v, want %v", progress.String(), tt.wantProgress)
+			}
+			if requests := fake.Requests(); len(requests) != 1 || requests[0].ResponseMode != string(StreamingMode) {
+				t.Errorf("Interact() requests = %#v, want 1 streaming", requests)
+			}
+		})
+	}
+}
+
+func TestXHSReviewChat_LongStream(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the stream takes longer than the default timeout of the http client")
+	}
+	productCatalog, err := catalog.NewCatalog("testdata/catalog.yaml")
+	if err != nil {
+		t.Fatalf("NewCatalog() error = %v", err)
+	}
+	param := &XHSReviewChatParam{
+		ItemId:        "6564c049474aad0001c7641a",
+		ItemInfo:      "裤夹 10个装",
+		ReviewContent: "夹得很紧, 一次能挂好几条",
+	}
+	// 62 chunks 1s apart, longer than the 60s of tools.NewHttpsClient, each within the idle timeout
+	answer := strings.Repeat("谢谢宝子", 62)
+	tests := []struct {
+		name string
+		new  func(baseURL string) (ReplyGenerator, error)
+	}{
+		{
+			name: "NewXHSReviewChatWithHTTP",
+			new: func(baseURL string) (ReplyGenerator, error) {
+				return NewXHSReviewChatWithHTTP(context.Background(), productCatalog, testSecrets(),
+					WithBaseURL(baseURL), WithStreaming(5*time.Second)), nil
+			},
+		},
+		{
+			name: "NewReplyGenerator",
+			new: func(baseURL string) (ReplyGenerator, error) {
+				return NewReplyGenerator(context.Background(), &ReplyGeneratorConfig{
+					Backend:      DifyChatBackend,
+					URL:          baseURL + DifyChatPath,
+					Secrets:      testSecrets(),
+					ResponseMode: StreamingMode,
+					Timeout:      5 * time.Second,
+				}, productCatalog)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fake := difyfake.New()
+			fake.Script(answer)
+			fake.SetLatency(time.Second)
+			server := fake.Start()
+			defer server.Close()
+
+			generator, err := tt.new(server.URL)
+			if err != nil {
+				t.Fatalf("new generator error = %v", err)
+			}
+			got, err := generator.Interact(context.Background(), param)
+			if err != nil {
+				t.Fatalf("Interact() error = %v", err)
+			}
+			if got != answer {
+				t.Errorf("Interact() got = %v, want %v", got, answer)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package xhsreq
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/catalog"
+	"PulseCheck/internal/tools"
+)
+
+type Sentiment string
+
+const (
+	SentimentPositive Sentiment = "positive"
+	SentimentNeutral  Sentiment = "neutral"
+	SentimentNegative Sentiment = "negative"
+)
+
+type Topic string
+
+const (
+	TopicQuality   Topic = "quality"
+	TopicPackaging Topic = "packaging"
+	TopicLogistics Topic = "logistics"
+	TopicSize      Topic = "size"
+	TopicService   Topic = "service"
+)
+
+type Urgency string
+
+const (
+	UrgencyLow    Urgency = "low"
+	UrgencyMedium Urgency = "medium"
+	// UrgencyHigh the buyer asks for a return or threatens a complaint, the shop should act now
+	UrgencyHigh Urgency = "high"
+)
+
+const (
+	ClassifiedByLLM     = "llm"
+	ClassifiedByKeyword = "keyword"
+
+	SentimentPath Path = "sentiment"
+	TopicsPath    Path = "topics"
+	UrgencyPath   Path = "urgency"
+
+	DefaultClassifierPrompt = "你是一名小红书店铺的评价分析员。用户会发送一段JSON, 其中sku_info是商品信息, review_info是买家的评价。" +
+		"请判断评价的情感(positive/neutral/negative)、涉及的话题(quality/packaging/logistics/size/service, 可多选)" +
+		"和紧急程度(low/medium/high, 买家要求退货退款或威胁投诉为high), " +
+		`只输出JSON, 例如{"sentiment":"negative","topics":["quality"],"urgency":"medium"}`
+)
+
+var (
+	Sentiments = []Sentiment{SentimentPositive, SentimentNeutral, SentimentNegative}
+	Topics     = []Topic{TopicQuality, TopicPackaging, TopicLogistics, TopicSize, TopicService}
+	Urgencies  = []Urgency{UrgencyLow, UrgencyMedium, UrgencyHigh}
+)
+
+// Classification tags a review, so that the reply, the approval and the reports can tell praise
+// from a complaint and a complaint about the logistics from one about the quality.
+type Classification struct {
+	Sentiment Sentiment `json:"sentiment"`
+	Topics    []Topic   `json:"topics,omitempty"`
+	Urgency   Urgency   `json:"urgency"`
+	// ClassifiedBy llm or keyword
+	ClassifiedBy string `json:"classified_by"`
+}
+
+func (this *Classification) validate() error {
+	if !slices.Contains(Sentiments, this.Sentiment) {
+		return errors.Errorf("unknown sentiment:%s", this.Sentiment)
+	}
+	if !slices.Contains(Urgencies, this.Urgency) {
+		return errors.Errorf("unknown urgency:%s", this.Urgency)
+	}
+	for _, topic := range this.Topics {
+		if !slices.Contains(Topics, topic) {
+			return errors.Errorf("unknown topic:%s", topic)
+		}
+	}
+	return nil
+}
+
+type Classifier interface {
+	Classify(ctx context.Context, review *Review) (*Classification, error)
+}
+
+// ----------------------------------
+var (
+	// the keywords are phrases rather than single characters, "坏" alone matches "还不坏" as well
+	positiveKeywords = []string{"好用", "喜欢", "满意", "不错", "推荐", "好评", "值得", "回购", "很棒", "超好", "挺好"}
+	negativeKeywords = []string{"很差", "太差", "质量差", "差评", "太烂", "很烂", "烂了", "坏了", "摔坏", "用坏", "不好用",
+		"质量不好", "失望", "垃圾", "后悔", "难用", "不值", "别买", "不要买", "对不上", "质量问题"}
+	// negatedKeywords are removed from the content before matching, so that "没坏" is not "坏了" and
+	// "不后悔" is not "后悔"
+	negatedKeywords = []string{"没有坏", "没坏", "不坏", "不差", "不烂", "不失望", "不后悔", "不难用"}
+	topicKeywords   = map[Topic][]string{
+		TopicQuality: {"质量", "做工", "材质", "坏了", "摔坏", "用坏", "断了", "开裂", "裂开", "裂了", "变形", "掉漆", "生锈",
+			"松动", "对不上", "异味"},
+		TopicPackaging: {"包装", "盒子", "纸箱", "破损", "压扁", "漏了", "漏液", "漏水"},
+		TopicLogistics: {"物流", "快递", "发货", "送货", "到货", "配送", "派送"},
+		TopicSize:      {"尺寸", "大小", "太大", "太小", "偏大", "偏小", "尺码", "长度", "宽度", "厘米"},
+		TopicService:   {"客服", "服务", "态度", "售后", "不回复", "没人理"},
+	}
+	urgentKeywords = []string{"退货", "退款", "投诉", "举报", "12315", "假货", "欺骗", "骗人", "受伤", "维权"}
+	negation       = newNegationReplacer()
+)
+
+func newNegationReplacer() *strings.Replacer {
+	oldnew := make([]string, 0, 2*len(negatedKeywords))
+	for _, keyword := range negatedKeywords {
+		oldnew = append(oldnew, keyword, "")
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// KeywordClassifier classifies by the sku score and the keywords of the content, it never fails
+// and is the fallback of the LLMClassifier.
+type KeywordClassifier struct{}
+
+func (this *KeywordClassifier) Classify(ctx context.Context, review *Review) (*Classification, error) {
+	content := strings.ToLower(review.Content)
+	for _, descendant := range review.Descendants {
+		content += "\n" + strings.ToLower(descendant.Content)
+	}
+	classification := &Classification{
+		Sentiment:    SentimentNeutral,
+		Urgency:      UrgencyLow,
+		ClassifiedBy: ClassifiedByKeyword,
+	}
+	content = negation.Replace(content)
+	var skuScore uint8
+	if review.Score != nil {
+		skuScore = review.Score.SkuScore
+	}
+	// the score given by the buyer outweighs the keywords, they only decide a 3 stars review or one
+	// without a score
+	switch {
+	case skuScore >= 4:
+		classification.Sentiment = SentimentPositive
+	case skuScore > 0 && skuScore <= 2:
+		classification.Sentiment = SentimentNegative
+	case containsAny(content, negativeKeywords):
+		classification.Sentiment = SentimentNegative
+	case skuScore == 0 && containsAny(content, positiveKeywords):
+		classification.Sentiment = SentimentPositive
+	}
+	for _, topic := range Topics {
+		if containsAny(content, topicKeywords[topic]) {
+			classification.Topics = append(classification.Topics, topic)
+		}
+	}
+	switch {
+	case containsAny(content, urgentKeywords):
+		classification.Urgency = UrgencyHigh
+	case classification.Sentiment == SentimentNegative:
+		classification.Urgency = UrgencyMedium
+	}
+	return classification, nil
+}
+
+func containsAny(content string, keywords []string) bool {
+	return slices.ContainsFunc(keywords, func(keyword string) bool {
+		return strings.Contains(content, keyword)
+	})
+}
+
+// ----------------------------------
+// LLMClassifier asks the LLM behind generator for the classification in json, the review is
+// classified by the fallback if the LLM fails or answers something else.
+type LLMClassifier struct {
+	generator ReplyGenerator
+	fallback  Classifier
+}
+
+func NewLLMClassifier(ctx context.Context, generator ReplyGenerator) *LLMClassifier {
+	return &LLMClassifier{generator: generator, fallback: &KeywordClassifier{}}
+}
+
+func (this *LLMClassifier) Classify(ctx context.Context, review *Review) (*Classification, error) {
+	classification, err := this.classify(ctx, review)
+	if err == nil {
+		return classification, nil
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	slog.Warn("classify review by llm error, keywords are used.", slog.String("reviewId", review.Id), tools.ErrAttr(err))
+	return this.fallback.Classify(ctx, review)
+}
+
+func (this *LLMClassifier) classify(ctx context.Context, review *Review) (*Classification, error) {
+	if review.SkuInfo == nil {
+		return nil, errors.Errorf("review:%s has no sku info", review.Id)
+	}
+	answer, err := this.generator.Interact(ctx, &XHSReviewChatParam{
+		ItemId:        review.SkuInfo.ItemID,
+		ItemInfo:      review.SkuInfo.SkuName,
+		ReviewContent: review.Content,
+	})
+	if err != nil {
+		return nil, errors.WithMessagef(err, "classify review:%s error.", review.Id)
+	}
+	return parseClassification(answer)
+}
+
+// parseClassification reads the json answered by the LLM, which may be wrapped in a markdown
+// code block or surrounded by words.
+func parseClassification(answer string) (*Classification, error) {
+	start, end := strings.Index(answer, "{"), strings.LastIndex(answer, "}")
+	if start < 0 || end < start {
+		return nil, errors.Errorf("no json in classification answer:%s", answer)
+	}
+	classification := &Classification{}
+	if err := json.Unmarshal([]byte(answer[start:end+1]), classification); err != nil {
+		return nil, errors.WithMessagef(err, "unmarshal classification answer:%s error.", answer)
+	}
+	classification.ClassifiedBy = ClassifiedByLLM
+	classification.Sentiment = Sentiment(strings.ToLower(string(classification.Sentiment)))
+	classification.Urgency = Urgency(strings.ToLower(string(classification.Urgency)))
+	for i, topic := range classification.Topics {
+		classification.Topics[i] = Topic(strings.ToLower(string(topic)))
+	}
+	if err := classification.validate(); err != nil {
+		return nil, errors.WithMessagef(err, "classification answer:%s", answer)
+	}
+	return classification, nil
+}
+
+// NewClassifier classifies by the LLM of conf, the system prompt defaults to
+// DefaultClassifierPrompt. Only the keywords are used if conf is nil. The dify backends are not
+// supported, the prompt of a dify app is set in dify and the system prompt would be ignored.
+func NewClassifier(ctx context.Context, conf *ReplyGeneratorConfig, productCatalog *catalog.Catalog) (Classifier, error) {
+	if conf == nil {
+		return &KeywordClassifier{}, nil
+	}
+	if conf.Backend != OpenAIBackend && conf.Backend != OllamaBackend {
+		return nil, errors.Errorf("classifier backend:%s not supported, openai or ollama only", conf.Backend)
+	}
+	llmConf := *conf
+	if len(llmConf.SystemPrompt) == 0 {
+		llmConf.SystemPrompt = DefaultClassifierPrompt
+	}
+	generator, err := NewReplyGenerator(ctx, &llmConf, productCatalog)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "create classifier error.")
+	}
+	return NewLLMClassifier(ctx, generator), nil
+}
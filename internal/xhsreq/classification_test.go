@@ -0,0 +1,210 @@
+package xhsreq
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/catalog"
+)
+
+func TestKeywordClassifier_Classify(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		skuScore uint8
+		want     *Classification
+	}{
+		{
+			name:     "praise",
+			content:  "很好用, 挂得很稳, 会回购",
+			skuScore: 5,
+			want:     &Classification{Sentiment: SentimentPositive, Urgency: UrgencyLow},
+		},
+		{
+			name:     "quality complaint",
+			content:  "不要买！ 质量很差 ！合住都对不上！",
+			skuScore: 3,
+			want:     &Classification{Sentiment: SentimentNegative, Topics: []Topic{TopicQuality}, Urgency: UrgencyMedium},
+		},
+		{
+			name:     "keywords do not outweigh a high score",
+			content:  "质量很差, 但是便宜",
+			skuScore: 4,
+			want:     &Classification{Sentiment: SentimentPositive, Topics: []Topic{TopicQuality}, Urgency: UrgencyLow},
+		},
+		{
+			name:     "negated negative word",
+			content:  "还不坏, 挺好",
+			skuScore: 5,
+			want:     &Classification{Sentiment: SentimentPositive, Urgency: UrgencyLow},
+		},
+		{
+			name:    "negated negative word without score",
+			content: "用了半年还没坏, 不后悔, 挺好",
+			want:    &Classification{Sentiment: SentimentPositive, Urgency: UrgencyLow},
+		},
+		{
+			name:     "broken",
+			content:  "用了一周就坏了",
+			skuScore: 3,
+			want:     &Classification{Sentiment: SentimentNegative, Topics: []Topic{TopicQuality}, Urgency: UrgencyMedium},
+		},
+		{
+			name:     "logistics and packaging",
+			content:  "快递太慢了, 包装也压扁了",
+			skuScore: 3,
+			want:     &Classification{Sentiment: SentimentNeutral, Topics: []Topic{TopicPackaging, TopicLogistics}, Urgency: UrgencyLow},
+		},
+		{
+			name:     "return request",
+			content:  "尺寸偏小根本用不了, 客服不回复, 我要退货",
+			skuScore: 1,
+			want: &Classification{Sentiment: SentimentNegative, Topics: []Topic{TopicSize, TopicService},
+				Urgency: UrgencyHigh},
+		},
+		{
+			name:    "no score",
+			content: "很满意",
+			want:    &Classification{Sentiment: SentimentPositive, Urgency: UrgencyLow},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review := &Review{Id: "review", Content: tt.content, Score: &Score{SkuScore: tt.skuScore}}
+			got, err := (&KeywordClassifier{}).Classify(context.Background(), review)
+			if err != nil {
+				t.Fatalf("Classify() error = %v", err)
+			}
+			tt.want.ClassifiedBy = ClassifiedByKeyword
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Classify() got = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseClassification(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  string
+		want    *Classification
+		wantErr bool
+	}{
+		{
+			name:   "json",
+			answer: `{"sentiment":"negative","topics":["quality"],"urgency":"high"}`,
+			want:   &Classification{Sentiment: SentimentNegative, Topics: []Topic{TopicQuality}, Urgency: UrgencyHigh, ClassifiedBy: ClassifiedByLLM},
+		},
+		{
+			name:   "code block",
+			answer: "```json\n{\"sentiment\":\"Positive\",\"urgency\":\"LOW\"}\n```",
+			want:   &Classification{Sentiment: SentimentPositive, Urgency: UrgencyLow, ClassifiedBy: ClassifiedByLLM},
+		},
+		{
+			name:    "unknown topic",
+			answer:  `{"sentiment":"negative","topics":["price"],"urgency":"low"}`,
+			wantErr: true,
+		},
+		{
+			name:    "not json",
+			answer:  "这是一条差评",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseClassification(tt.answer)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseClassification() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseClassification() got = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+type answerGenerator struct {
+	answer string
+	err    error
+}
+
+func (this *answerGenerator) Interact(ctx context.Context, param *XHSReviewChatParam) (string, error) {
+	return this.answer, this.err
+}
+
+func TestLLMClassifier_Classify(t *testing.T) {
+	tests := []struct {
+		name      string
+		generator *answerGenerator
+		want      string
+	}{
+		{name: "llm", generator: &answerGenerator{answer: `{"sentiment":"neutral","urgency":"low"}`}, want: ClassifiedByLLM},
+		{name: "bad answer", generator: &answerGenerator{answer: "neutral"}, want: ClassifiedByKeyword},
+		{name: "llm error", generator: &answerGenerator{err: errors.New("503")}, want: ClassifiedByKeyword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review := &Review{Id: "review", Content: "还行", SkuInfo: &SkuInfo{ItemID: "item", SkuName: "衣架"}}
+			got, err := NewLLMClassifier(context.Background(), tt.generator).Classify(context.Background(), review)
+			if err != nil {
+				t.Fatalf("Classify() error = %v", err)
+			}
+			if got.ClassifiedBy != tt.want {
+				t.Errorf("Classify() classified by = %v, want %v", got.ClassifiedBy, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClassifier(t *testing.T) {
+	productCatalog, err := catalog.NewCatalog("testdata/catalog.yaml")
+	if err != nil {
+		t.Fatalf("NewCatalog() error = %v", err)
+	}
+	server, captured := startLLM(t, http.StatusOK,
+		`{"choices":[{"index":0,"message":{"role":"assistant","content":"{\"sentiment\":\"negative\",\"topics\":[\"quality\"],\"urgency\":\"high\"}"}}]}`)
+	tests := []struct {
+		name    string
+		conf    *ReplyGeneratorConfig
+		want    string
+		wantErr bool
+	}{
+		{name: "keywords", want: ClassifiedByKeyword},
+		{
+			name: "llm",
+			conf: &ReplyGeneratorConfig{Backend: OpenAIBackend, URL: server.URL, APIKey: "sk-test", Model: "gpt-4o-mini"},
+			want: ClassifiedByLLM,
+		},
+		{name: "dify chat", conf: &ReplyGeneratorConfig{Backend: DifyChatBackend, APIKey: "app-test"}, wantErr: true},
+		{name: "dify workflow", conf: &ReplyGeneratorConfig{Backend: DifyWorkflowBackend, APIKey: "app-test"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classifier, err := NewClassifier(context.Background(), tt.conf, productCatalog)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewClassifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			review := &Review{Id: "review", Content: "质量太差了, 要退货",
+				SkuInfo: &SkuInfo{ItemID: "6564c049474aad0001c7641a", SkuName: "裤夹 10个装"}}
+			got, err := classifier.Classify(context.Background(), review)
+			if err != nil {
+				t.Fatalf("Classify() error = %v", err)
+			}
+			if got.ClassifiedBy != tt.want {
+				t.Errorf("Classify() classified by = %v, want %v", got.ClassifiedBy, tt.want)
+			}
+			if tt.conf != nil && captured.body.Get("messages.0.content").String() != DefaultClassifierPrompt {
+				t.Errorf("Classify() system prompt = %v, want DefaultClassifierPrompt", captured.body.Get("messages.0.content"))
+			}
+		})
+	}
+}
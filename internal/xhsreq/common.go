@@ -2,7 +2,6 @@ package xhsreq
 
 import (
 	"context"
-	"log"
 	"log/slog"
 	"net/http"
 	"strconv"
@@ -11,27 +10,66 @@ import (
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/pkg/errors"
 	"github.com/spf13/cast"
 
+	"PulseCheck/internal/secret"
+	"PulseCheck/internal/session"
 	"PulseCheck/internal/tools"
 )
 
 const (
-	cookieFormat = `a1=18f137ccfed9g2hoelwpjqyvnunsiagjjyjd5stox00000135039; webId=a23bf7a341ef68df96c1281831cbd021; gid=yYiyqWSffiVSyYiyqWSSivM9dfjkJxld1EUVVlCAvhI7If88M30kV2888yq28qj80JS4i8i4; customerClientId=688073957365739; x-user-id-zhaoshang.xiaohongshu.com=; ark_worker_plugin_uuid=886235df2bf9422ebe1ea9c73915763c; x-user-id-school.xiaohongshu.com=65d6ecd9e300000000000001; abRequestId=a23bf7a341ef68df96c1281831cbd021; access-token=; sso-type=customer; subsystem=ark; web_session=040069431fa14842cc90b0bc41344b8ee07f5d; webBuild=4.25.1; unread={%22ub%22:%22668bd8750000000025015bc8%22%2C%22ue%22:%22668f74db0000000025002eed%22%2C%22uc%22:33}; acw_tc=2521b57b58b2b5ba5149cbd95cbeb0ba54231d009c1bef6bb34afbd638e02b91; xsecappid=sellercustomer; websectiga=f3d8eaee8a8c63016320d94a1bd00562d516a5417bc43a032a80cbf70f07d5c0; sec_poison_id=ae4e27b9-601e-40f1-b112-4351b82c64f1; customer-sso-sid=68c5173991171136170488473a6fe5c96bf49c16; x-user-id-ark.xiaohongshu.com=5679401044760815fb659cc6; access-token-ark.xiaohongshu.com=customer.ark.{{ . }}; access-token-ark.beta.xiaohongshu.com=customer.ark.{{ . }}; beaker.session.id=1d657de3051687a200364d516edbdc967440edc8gAJ9cQAoWAsAAABhcmstbGlhcy1pZHEBWBgAAAA2NTVmMmY1YjNlYWQ0ZjAwMDE1YWU2YzFxAlgOAAAAcmEtdXNlci1pZC1hcmtxA1gYAAAANjVkNmVjZDllMzAwMDAwMDAwMDAwMDAxcQRYDgAAAF9jcmVhdGlvbl90aW1lcQVHQdmrvHS+JN1YEQAAAHJhLWF1dGgtdG9rZW4tYXJrcQZYQQAAADM2MTZjOWM1YzhlNDQyYjBhZjI1NWIzOGIyZjE4YWM5LTBjODNiYzEzNjg3YzQ4ZTM5OGFlYTkyYjY0ZjBhYzA4cQdYAwAAAF9pZHEIWCAAAAA4MzhiZWNjZjE4ZWY0YTQ5OTZjZTQ1MWUxZTJlZmQwN3EJWA4AAABfYWNjZXNzZWRfdGltZXEKR0HZq7x0viTddS4=`
+	// defaultCookieFormat carries nothing but the access token, the full cookie of a browser session
+	// can be provided by the xhs_cookie secret.
+	defaultCookieFormat = `sso-type=customer; subsystem=ark; xsecappid=sellercustomer; access-token-ark.xiaohongshu.com=customer.ark.{{ . }}; access-token-ark.beta.xiaohongshu.com=customer.ark.{{ . }}`
 )
 
-func generateCookie(token string) string {
+func generateCookie(cookieFormat string, token string) (string, error) {
 	t, b := template.New("cookieTemplate"), new(strings.Builder)
-	err := template.Must(t.Parse(cookieFormat)).Execute(b, token)
+	t, err := t.Parse(cookieFormat)
 	if err != nil {
-		log.Fatalf("could not parse cookie. %s. error:%+v", cookieFormat, err)
+		return "", errors.WithMessagef(err, "could not parse cookie template.")
 	}
-	return b.String()
+	if err = t.Execute(b, token); err != nil {
+		return "", errors.WithMessagef(err, "could not execute cookie template.")
+	}
+	return b.String(), nil
 }
 
+// ResetCommonHeaders sets the headers of the xiaohongshu api. The access token is taken from ctx,
+// or from the secret provider in ctx if there is none, and so is the cookie template.
 func ResetCommonHeaders(ctx context.Context, header http.Header) error {
-	token := tools.WithdrawXHSToken(ctx)
-	cookie := generateCookie(token)
+	// an expired session must not keep hitting the api
+	if err := session.Check(ctx); err != nil {
+		return err
+	}
+	secrets := secret.WithdrawProvider(ctx)
+	token, ok := tools.LookupXHSToken(ctx)
+	if !ok {
+		if secrets == nil {
+			return errors.New("can not get XHS token from context")
+		}
+		var err error
+		if token, err = secrets.Get(ctx, secret.XHSToken); err != nil {
+			return errors.WithMessagef(err, "get xiaohongshu token error.")
+		}
+	}
+	tools.RegisterSecret(token)
+	cookieFormat := defaultCookieFormat
+	if secrets != nil {
+		format, err := secrets.Get(ctx, secret.XHSCookie)
+		switch {
+		case err == nil:
+			cookieFormat = format
+		case !errors.Is(err, secret.ErrNotFound):
+			return errors.WithMessagef(err, "get xiaohongshu cookie error.")
+		}
+	}
+	cookie, err := generateCookie(cookieFormat, token)
+	if err != nil {
+		return err
+	}
+	tools.RegisterSecret(cookie)
 	header.Set("cookie", cookie)
 
 	header.Set("accept", "application/json, text/plain, */*")
@@ -95,6 +133,45 @@ func JsonDataPath(nodes ...Path) string {
 }
 
 const (
-	XiaohongshuDomain = "ark.xiaohongshu.com"
-	DifyDomain        = "api.dify.ai"
+	XiaohongshuDomain  = "ark.xiaohongshu.com"
+	XiaohongshuBaseURL = "https://" + XiaohongshuDomain
+	DifyDomain         = "api.dify.ai"
+	DifyBaseURL        = "https://" + DifyDomain
 )
+
+// ClientOption configures the clients of the xiaohongshu api and of dify.
+type ClientOption func(conf *clientConfig)
+
+type clientConfig struct {
+	baseURL string
+	// responseMode and idleTimeout are used by the dify chat only
+	responseMode ResponseMode
+	idleTimeout  time.Duration
+}
+
+// WithBaseURL sends the requests to baseURL instead of XiaohongshuBaseURL or DifyBaseURL, e.g. to a
+// xhsfake or difyfake server.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(conf *clientConfig) {
+		if len(baseURL) != 0 {
+			conf.baseURL = strings.TrimSuffix(baseURL, "/")
+		}
+	}
+}
+
+// WithStreaming makes the dify chat stream the answer, the request is given up if no event is
+// received within idleTimeout, however long the whole answer takes.
+func WithStreaming(idleTimeout time.Duration) ClientOption {
+	return func(conf *clientConfig) {
+		conf.responseMode = StreamingMode
+		conf.idleTimeout = idleTimeout
+	}
+}
+
+func newClientConfig(baseURL string, opts []ClientOption) *clientConfig {
+	conf := &clientConfig{baseURL: baseURL, responseMode: BlockingMode, idleTimeout: DefaultGeneratorTimeout}
+	for _, opt := range opts {
+		opt(conf)
+	}
+	return conf
+}
@@ -0,0 +1,76 @@
+package xhsreq
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"PulseCheck/internal/catalog"
+)
+
+// DifyWorkflow generates the reply by running a dify workflow app
+type DifyWorkflow struct {
+	httpClient *http.Client
+	catalog    *catalog.Catalog
+	url        string
+	apiKey     string
+	outputKey  string
+}
+
+const (
+	ItemTypeInput      Path = "item_type"
+	ItemIntroInput     Path = "item_introduction"
+	ReviewContentInput Path = "review_content"
+
+	WorkflowStatusPath  Path = "data.status"
+	WorkflowErrorPath   Path = "data.error"
+	WorkflowOutputsPath Path = "data.outputs"
+
+	WorkflowSucceeded = "succeeded"
+)
+
+func NewDifyWorkflow(ctx context.Context, httpClient *http.Client, productCatalog *catalog.Catalog, url string, apiKey string, outputKey string) *DifyWorkflow {
+	return &DifyWorkflow{httpClient: httpClient, catalog: productCatalog, url: url, apiKey: apiKey, outputKey: outputKey}
+}
+
+// newRequestBody passes the query both as a whole json and as separated variables,
+// the workflow picks whichever its start node declares.
+func (this *DifyWorkflow) newRequestBody(ctx context.Context, param *XHSReviewChatParam) ([]byte, error) {
+	query, err := newReviewQuery(ctx, this.catalog, param)
+	if err != nil {
+		return nil, err
+	}
+	difyData := []byte("{}")
+	difyData, _ = sjson.SetBytes(difyData, InputPath.Join(QueryPath).String(), query.JSON())
+	difyData, _ = sjson.SetBytes(difyData, InputPath.Join(ItemTypeInput).String(), query.Product.Type)
+	difyData, _ = sjson.SetBytes(difyData, InputPath.Join(ItemIntroInput).String(), query.Product.Introduction)
+	difyData, _ = sjson.SetBytes(difyData, InputPath.Join(ReviewContentInput).String(), query.ReviewContent)
+	difyData, _ = sjson.SetBytes(difyData, ResponseModePath.String(), "blocking")
+	difyData, _ = sjson.SetBytes(difyData, UserPath.String(), "abc-123")
+	return difyData, nil
+}
+
+func (this *DifyWorkflow) Interact(ctx context.Context, param *XHSReviewChatParam) (string, error) {
+	body, err := this.newRequestBody(ctx, param)
+	if err != nil {
+		return "", err
+	}
+	b, err := postJSON(ctx, this.httpClient, this.url, bearer(this.apiKey), body)
+	if err != nil {
+		return "", errors.WithMessagef(err, "run dify workflow error. param:%#v", param)
+	}
+	jsonData := gjson.ParseBytes(b)
+	status := jsonData.Get(WorkflowStatusPath.String()).String()
+	if status != WorkflowSucceeded {
+		return "", errors.Errorf("dify workflow not succeeded. status:%s error:%s", status,
+			jsonData.Get(WorkflowErrorPath.String()).String())
+	}
+	result := jsonData.Get(WorkflowOutputsPath.Join(FromString(this.outputKey)).String())
+	if !result.Exists() {
+		return "", errors.Errorf("workflow output:%s not exists. response:%s", this.outputKey, jsonData.String())
+	}
+	return result.String(), nil
+}
@@ -0,0 +1,45 @@
+package xhsreq
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"PulseCheck/internal/catalog"
+)
+
+// OllamaChat generates the reply by a self-hosted ollama style /api/chat endpoint
+type OllamaChat struct {
+	httpClient   *http.Client
+	catalog      *catalog.Catalog
+	url          string
+	model        string
+	systemPrompt string
+}
+
+const (
+	MessageContentPath Path = "message.content"
+)
+
+func NewOllamaChat(ctx context.Context, httpClient *http.Client, productCatalog *catalog.Catalog, url string, model string, systemPrompt string) *OllamaChat {
+	return &OllamaChat{httpClient: httpClient, catalog: productCatalog, url: url, model: model, systemPrompt: systemPrompt}
+}
+
+func (this *OllamaChat) Interact(ctx context.Context, param *XHSReviewChatParam) (string, error) {
+	body, err := newChatMessagesBody(ctx, this.catalog, this.model, this.systemPrompt, param)
+	if err != nil {
+		return "", err
+	}
+	b, err := postJSON(ctx, this.httpClient, this.url, nil, body)
+	if err != nil {
+		return "", errors.WithMessagef(err, "ollama chat error. param:%#v", param)
+	}
+	jsonData := gjson.ParseBytes(b)
+	result := jsonData.Get(MessageContentPath.String())
+	if !result.Exists() {
+		return "", errors.Errorf("answer not exists. response:%s", jsonData.String())
+	}
+	return result.String(), nil
+}
@@ -0,0 +1,72 @@
+package xhsreq
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"PulseCheck/internal/catalog"
+)
+
+// OpenAIChat generates the reply by an openai compatible /v1/chat/completions endpoint
+type OpenAIChat struct {
+	httpClient   *http.Client
+	catalog      *catalog.Catalog
+	url          string
+	apiKey       string
+	model        string
+	systemPrompt string
+}
+
+const (
+	ModelPath    Path = "model"
+	MessagesPath Path = "messages"
+	RolePath     Path = "role"
+	ContentPath  Path = "content"
+	StreamPath   Path = "stream"
+
+	ChoiceContentPath Path = "choices.0.message.content"
+
+	RoleSystem = "system"
+	RoleUser   = "user"
+)
+
+func NewOpenAIChat(ctx context.Context, httpClient *http.Client, productCatalog *catalog.Catalog, url string, apiKey string, model string, systemPrompt string) *OpenAIChat {
+	return &OpenAIChat{httpClient: httpClient, catalog: productCatalog, url: url, apiKey: apiKey, model: model, systemPrompt: systemPrompt}
+}
+
+func (this *OpenAIChat) Interact(ctx context.Context, param *XHSReviewChatParam) (string, error) {
+	body, err := newChatMessagesBody(ctx, this.catalog, this.model, this.systemPrompt, param)
+	if err != nil {
+		return "", err
+	}
+	b, err := postJSON(ctx, this.httpClient, this.url, bearer(this.apiKey), body)
+	if err != nil {
+		return "", errors.WithMessagef(err, "openai chat completion error. param:%#v", param)
+	}
+	jsonData := gjson.ParseBytes(b)
+	result := jsonData.Get(ChoiceContentPath.String())
+	if !result.Exists() {
+		return "", errors.Errorf("answer not exists. response:%s", jsonData.String())
+	}
+	return result.String(), nil
+}
+
+// newChatMessagesBody builds the system + user messages shared by openai and ollama.
+func newChatMessagesBody(ctx context.Context, productCatalog *catalog.Catalog, model string, systemPrompt string, param *XHSReviewChatParam) ([]byte, error) {
+	query, err := newReviewQuery(ctx, productCatalog, param)
+	if err != nil {
+		return nil, err
+	}
+	data := []byte("{}")
+	data, _ = sjson.SetBytes(data, ModelPath.String(), model)
+	data, _ = sjson.SetBytes(data, MessagesPath.Index(0).Join(RolePath).String(), RoleSystem)
+	data, _ = sjson.SetBytes(data, MessagesPath.Index(0).Join(ContentPath).String(), systemPrompt)
+	data, _ = sjson.SetBytes(data, MessagesPath.Index(1).Join(RolePath).String(), RoleUser)
+	data, _ = sjson.SetBytes(data, MessagesPath.Index(1).Join(ContentPath).String(), string(query.JSON()))
+	data, _ = sjson.SetBytes(data, StreamPath.String(), false)
+	return data, nil
+}
@@ -0,0 +1,238 @@
+package xhsreq
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"github.com/tidwall/sjson"
+
+	"PulseCheck/internal/catalog"
+	"PulseCheck/internal/secret"
+	"PulseCheck/internal/tools"
+)
+
+// ReplyGenerator generates the reply content of a review by the LLM backend behind it.
+type ReplyGenerator interface {
+	Interact(ctx context.Context, param *XHSReviewChatParam) (string, error)
+}
+
+type GeneratorBackend string
+
+const (
+	DifyChatBackend     GeneratorBackend = "dify_chat"
+	DifyWorkflowBackend GeneratorBackend = "dify_workflow"
+	OpenAIBackend       GeneratorBackend = "openai"
+	OllamaBackend       GeneratorBackend = "ollama"
+)
+
+const (
+	DifyChatPath            = "/v1/chat-messages"
+	DifyChatURL             = DifyBaseURL + DifyChatPath
+	DifyWorkflowURL         = "https://api.dify.ai/v1/workflows/run"
+	OpenAIChatURL           = "https://api.openai.com/v1/chat/completions"
+	OllamaChatURL           = "http://localhost:11434/api/chat"
+	DefaultGeneratorTimeout = 2 * time.Minute
+
+	DefaultSystemPrompt = "你是一名小红书店铺的客服。用户会发送一段JSON, 其中sku_info是商品信息, review_info是买家的评价。" +
+		"请用亲切自然的语气为这条评价写一段简短的回复, 只输出回复内容本身。"
+)
+
+type ReplyGeneratorConfig struct {
+	Backend GeneratorBackend `validate:"required,oneof=dify_chat dify_workflow openai ollama"`
+	// URL the full endpoint url, the default one of the backend is used if empty
+	URL string `validate:"omitempty,url"`
+	// APIKey takes precedence over the llm_key of Secrets
+	APIKey  string
+	Secrets secret.Provider `validate:"-"`
+	// Model is required by the openai and ollama backends
+	Model        string `validate:"required_if=Backend openai,required_if=Backend ollama"`
+	SystemPrompt string
+	// OutputKey the workflow output variable holding the reply, "answer" if empty
+	OutputKey string
+	// ResponseMode of the dify chat, blocking if empty. When streaming Timeout is how long the stream
+	// may stay idle rather than how long the whole answer may take
+	ResponseMode ResponseMode `validate:"omitempty,oneof=blocking streaming"`
+	Timeout      time.Duration
+	// HTTPOptions e.g. the retries of the requests to the llm
+	HTTPOptions []tools.Option `validate:"-"`
+}
+
+func NewReplyGenerator(ctx context.Context, conf *ReplyGeneratorConfig, productCatalog *catalog.Catalog) (ReplyGenerator, error) {
+	validate := validator.New()
+	if err := validate.Struct(conf); err != nil {
+		return nil, errors.WithMessagef(err, "validate reply generator config of backend:%s url:%s error.", conf.Backend, conf.URL)
+	}
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = DefaultGeneratorTimeout
+	}
+	endpoint := conf.URL
+	if len(endpoint) == 0 {
+		switch conf.Backend {
+		case DifyChatBackend:
+			endpoint = DifyChatURL
+		case DifyWorkflowBackend:
+			endpoint = DifyWorkflowURL
+		case OpenAIBackend:
+			endpoint = OpenAIChatURL
+		case OllamaBackend:
+			endpoint = OllamaChatURL
+		}
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "parse reply generator url:%s error.", endpoint)
+	}
+	streaming := conf.Backend == DifyChatBackend && conf.ResponseMode == StreamingMode
+	httpOptions := slices.Clone(conf.HTTPOptions)
+	if streaming {
+		// the stream is bounded by the idle timeout only, a long answer may take longer than any timeout
+		httpOptions = append(httpOptions, tools.WithTimeout(0))
+	} else {
+		httpOptions = append(httpOptions, tools.WithTimeout(timeout))
+	}
+	httpClient := tools.NewHttpsClient(u.Hostname(), httpOptions...)
+	systemPrompt := conf.SystemPrompt
+	if len(systemPrompt) == 0 {
+		systemPrompt = DefaultSystemPrompt
+	}
+
+	secrets := secret.NewChain(secret.Static{secret.LLMKey: conf.APIKey}, conf.Secrets)
+	apiKey, err := secrets.Get(ctx, secret.LLMKey)
+	if err != nil && !errors.Is(err, secret.ErrNotFound) {
+		return nil, errors.WithMessagef(err, "get llm api key error.")
+	}
+
+	switch conf.Backend {
+	case DifyChatBackend:
+		var opts []ClientOption
+		if streaming {
+			opts = append(opts, WithStreaming(timeout))
+		}
+		return NewXHSReviewChat(ctx, httpClient, productCatalog, endpoint, secrets, opts...), nil
+	case DifyWorkflowBackend:
+		outputKey := conf.OutputKey
+		if len(outputKey) == 0 {
+			outputKey = AnswerPath.String()
+		}
+		return NewDifyWorkflow(ctx, httpClient, productCatalog, endpoint, apiKey, outputKey), nil
+	case OpenAIBackend:
+		return NewOpenAIChat(ctx, httpClient, productCatalog, endpoint, apiKey, conf.Model, systemPrompt), nil
+	case OllamaBackend:
+		return NewOllamaChat(ctx, httpClient, productCatalog, endpoint, conf.Model, systemPrompt), nil
+	}
+	return nil, errors.Errorf("unsupported reply generator backend:%s", conf.Backend)
+}
+
+// reviewQuery is the product and review information every backend sends to the LLM.
+type reviewQuery struct {
+	Product        *catalog.Product
+	ReviewContent  string
+	Classification *Classification
+}
+
+func newReviewQuery(ctx context.Context, productCatalog *catalog.Catalog, param *XHSReviewChatParam) (*reviewQuery, error) {
+	validate := validator.New()
+	if err := validate.Struct(param); err != nil {
+		return nil, errors.WithMessagef(err, "param:%#v", param)
+	}
+	if productCatalog == nil {
+		return nil, errors.New("product catalog is not set")
+	}
+	tools.LogFromContext(ctx, "\n--正在转化商品信息--")
+	product, err := productCatalog.Lookup(param.ItemId, param.ItemInfo)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "could find itemtype by itemid. SearchParam:%#v", param)
+	}
+	tools.LogFromContext(ctx, "itemId:%s -> itemType:%s", param.ItemId, product.Type)
+	tools.LogFromContext(ctx, "text:%s", product.Introduction)
+	return &reviewQuery{
+		Product:        product,
+		ReviewContent:  param.ReviewContent,
+		Classification: param.Classification,
+	}, nil
+}
+
+// JSON renders the query as {"sku_info":{...},"review_info":{...}} which the prompts are written against.
+func (this *reviewQuery) JSON() []byte {
+	product := this.Product
+	queryJsonData := []byte("{}")
+	queryJsonData, _ = sjson.SetBytes(queryJsonData, SkuInfoPath.Join(ItemTypePath).String(), product.Type)
+	queryJsonData, _ = sjson.SetBytes(queryJsonData, SkuInfoPath.Join(ItemIntroPath).String(), product.Introduction)
+	if len(product.SellingPoints) != 0 {
+		queryJsonData, _ = sjson.SetBytes(queryJsonData, SkuInfoPath.Join(SellingPath).String(), product.SellingPoints)
+	}
+	if len(product.FAQ) != 0 {
+		queryJsonData, _ = sjson.SetBytes(queryJsonData, SkuInfoPath.Join(FAQPath).String(), product.FAQ)
+	}
+	if len(product.ForbiddenClaims) != 0 {
+		queryJsonData, _ = sjson.SetBytes(queryJsonData, SkuInfoPath.Join(ForbiddenPath).String(), product.ForbiddenClaims)
+	}
+	if len(product.Tone) != 0 {
+		queryJsonData, _ = sjson.SetBytes(queryJsonData, SkuInfoPath.Join(TonePath).String(), product.Tone)
+	}
+	queryJsonData, _ = sjson.SetBytes(queryJsonData, ReviewInfoPath.Join(TextPath).String(), this.ReviewContent)
+	if classification := this.Classification; classification != nil {
+		queryJsonData, _ = sjson.SetBytes(queryJsonData, ReviewInfoPath.Join(SentimentPath).String(), classification.Sentiment)
+		if len(classification.Topics) != 0 {
+			queryJsonData, _ = sjson.SetBytes(queryJsonData, ReviewInfoPath.Join(TopicsPath).String(), classification.Topics)
+		}
+		queryJsonData, _ = sjson.SetBytes(queryJsonData, ReviewInfoPath.Join(UrgencyPath).String(), classification.Urgency)
+	}
+	return queryJsonData
+}
+
+// postJSON posts body to the endpoint and returns the response body when the status code is 200.
+func postJSON(ctx context.Context, httpClient *http.Client, endpoint string, headers map[string]string, body []byte) ([]byte, error) {
+	bodyStr := string(body)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(body))
+	if nil != err {
+		return nil, errors.WithMessagef(err, "new request error. url:%s body:%s", endpoint, bodyStr)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	response, err := httpClient.Do(request)
+	if nil != err {
+		return nil, errors.WithMessagef(err, "request failed with url:%s requestBody:%s", endpoint, bodyStr)
+	}
+	respBody := response.Body
+	defer func() {
+		err := respBody.Close()
+		if err != nil {
+			slog.Error("close response body err.", tools.ErrAttr(err))
+		}
+	}()
+	b, err := io.ReadAll(respBody)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read response body fail with url:%s body:%s", endpoint, bodyStr)
+	}
+	statusCode := response.StatusCode
+	if statusCode != http.StatusOK {
+		slog.Error("get llm response error.",
+			slog.String("url", endpoint),
+			slog.Int("statusCode", statusCode),
+			slog.String("body", bodyStr),
+			slog.String("response", string(b)),
+		)
+		return nil, errors.Errorf("get llm response error. url:%s statusCode:%d requestBody:%s response:%s",
+			endpoint, statusCode, bodyStr, string(b))
+	}
+	return b, nil
+}
+
+func bearer(apiKey string) map[string]string {
+	if len(apiKey) == 0 {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + apiKey}
+}
@@ -0,0 +1,289 @@
+package xhsreq
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+
+	"PulseCheck/internal/catalog"
+	"PulseCheck/internal/secret"
+)
+
+type capturedRequest struct {
+	path          string
+	authorization string
+	body          gjson.Result
+}
+
+// startLLM answers every request by status and answer, and captures the last one.
+func startLLM(t *testing.T, status int, answer string) (*httptest.Server, *capturedRequest) {
+	t.Helper()
+	captured := &capturedRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		b, _ := io.ReadAll(request.Body)
+		captured.path = request.URL.Path
+		captured.authorization = request.Header.Get("Authorization")
+		captured.body = gjson.ParseBytes(b)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(status)
+		_, _ = writer.Write([]byte(answer))
+	}))
+	t.Cleanup(server.Close)
+	return server, captured
+}
+
+func TestReplyGenerator_Interact(t *testing.T) {
+	productCatalog, err := catalog.NewCatalog("testdata/catalog.yaml")
+	if err != nil {
+		t.Fatalf("NewCatalog() error = %v", err)
+	}
+	param := &XHSReviewChatParam{
+		ItemId:        "6564c049474aad0001c7641a",
+		ItemInfo:      "裤夹 10个装",
+		ReviewContent: "夹得很紧, 一次能挂好几条",
+	}
+	newGenerator := map[GeneratorBackend]func(url string) ReplyGenerator{
+		OpenAIBackend: func(url string) ReplyGenerator {
+			return NewOpenAIChat(context.Background(), http.DefaultClient, productCatalog, url, "sk-test", "gpt-4o-mini", "你是客服")
+		},
+		OllamaBackend: func(url string) ReplyGenerator {
+			return NewOllamaChat(context.Background(), http.DefaultClient, productCatalog, url, "qwen2.5", "你是客服")
+		},
+		DifyWorkflowBackend: func(url string) ReplyGenerator {
+			return NewDifyWorkflow(context.Background(), http.DefaultClient, productCatalog, url, "app-test", "reply")
+		},
+	}
+	tests := []struct {
+		name    string
+		backend GeneratorBackend
+		status  int
+		answer  string
+		want    string
+		wantErr bool
+		check   func(t *testing.T, request *capturedRequest)
+	}{
+		{
+			name:    "openai",
+			backend: OpenAIBackend,
+			status:  http.StatusOK,
+			answer:  `{"choices":[{"index":0,"message":{"role":"assistant","content":"谢谢宝子的认可"}}]}`,
+			want:    "谢谢宝子的认可",
+			check: func(t *testing.T, request *capturedRequest) {
+				if request.authorization != "Bearer sk-test" {
+					t.Errorf("authorization = %s", request.authorization)
+				}
+				checkChatMessages(t, request.body, "gpt-4o-mini")
+			},
+		},
+		{
+			name:    "openai no choice",
+			backend: OpenAIBackend,
+			status:  http.StatusOK,
+			answer:  `{"choices":[]}`,
+			wantErr: true,
+		},
+		{
+			name:    "openai rate limited",
+			backend: OpenAIBackend,
+			status:  http.StatusTooManyRequests,
+			answer:  `{"error":{"message":"Rate limit reached"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "ollama",
+			backend: OllamaBackend,
+			status:  http.StatusOK,
+			answer:  `{"model":"qwen2.5","message":{"role":"assistant","content":"谢谢宝子的认可"},"done":true}`,
+			want:    "谢谢宝子的认可",
+			check: func(t *testing.T, request *capturedRequest) {
+				if len(request.authorization) != 0 {
+					t.Errorf("authorization = %s, want none", request.authorization)
+				}
+				checkChatMessages(t, request.body, "qwen2.5")
+			},
+		},
+		{
+			name:    "ollama model missing",
+			backend: OllamaBackend,
+			status:  http.StatusNotFound,
+			answer:  `{"error":"model \"qwen2.5\" not found, try pulling it first"}`,
+			wantErr: true,
+		},
+		{
+			name:    "dify workflow",
+			backend: DifyWorkflowBackend,
+			status:  http.StatusOK,
+			answer:  `{"workflow_run_id":"run","data":{"status":"succeeded","outputs":{"reply":"谢谢宝子的认可"}}}`,
+			want:    "谢谢宝子的认可",
+			check: func(t *testing.T, request *capturedRequest) {
+				if request.authorization != "Bearer app-test" {
+					t.Errorf("authorization = %s", request.authorization)
+				}
+				inputs := request.body.Get(InputPath.String())
+				if inputs.Get(ItemTypeInput.String()).String() != "裤夹" ||
+					inputs.Get(ReviewContentInput.String()).String() != param.ReviewContent ||
+					gjson.Parse(inputs.Get(QueryPath.String()).String()).Get("review_info.text").String() != param.ReviewContent ||
+					request.body.Get(ResponseModePath.String()).String() != "blocking" {
+					t.Errorf("body = %s", request.body.Raw)
+				}
+			},
+		},
+		{
+			name:    "dify workflow failed",
+			backend: DifyWorkflowBackend,
+			status:  http.StatusOK,
+			answer:  `{"data":{"status":"failed","error":"LLM node timeout","outputs":null}}`,
+			wantErr: true,
+		},
+		{
+			name:    "dify workflow output missing",
+			backend: DifyWorkflowBackend,
+			status:  http.StatusOK,
+			answer:  `{"data":{"status":"succeeded","outputs":{"text":"谢谢宝子的认可"}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "dify workflow unauthorized",
+			backend: DifyWorkflowBackend,
+			status:  http.StatusUnauthorized,
+			answer:  `{"code":"unauthorized","message":"Access token is invalid","status":401}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, request := startLLM(t, tt.status, tt.answer)
+			got, err := newGenerator[tt.backend](server.URL+"/chat").Interact(context.Background(), param)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Interact() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Interact() got = %v, want %v", got, tt.want)
+			}
+			if request.path != "/chat" {
+				t.Errorf("path = %s, want /chat", request.path)
+			}
+			if tt.check != nil {
+				tt.check(t, request)
+			}
+		})
+	}
+}
+
+// checkChatMessages checks the system and user messages shared by openai and ollama.
+func checkChatMessages(t *testing.T, body gjson.Result, model string) {
+	t.Helper()
+	messages := body.Get(MessagesPath.String()).Array()
+	if body.Get(ModelPath.String()).String() != model || body.Get(StreamPath.String()).Bool() || len(messages) != 2 {
+		t.Fatalf("body = %s", body.Raw)
+	}
+	if messages[0].Get(RolePath.String()).String() != RoleSystem || messages[0].Get(ContentPath.String()).String() != "你是客服" {
+		t.Errorf("system message = %s", messages[0].Raw)
+	}
+	query := gjson.Parse(messages[1].Get(ContentPath.String()).String())
+	if messages[1].Get(RolePath.String()).String() != RoleUser || query.Get("sku_info.item_type").String() != "裤夹" ||
+		query.Get("review_info.text").String() != "夹得很紧, 一次能挂好几条" {
+		t.Errorf("user message = %s", messages[1].Raw)
+	}
+}
+
+func TestNewReplyGenerator(t *testing.T) {
+	productCatalog, err := catalog.NewCatalog("testdata/catalog.yaml")
+	if err != nil {
+		t.Fatalf("NewCatalog() error = %v", err)
+	}
+	secrets := secret.Static{secret.LLMKey: "key-from-secrets"}
+	tests := []struct {
+		name    string
+		conf    *ReplyGeneratorConfig
+		wantErr bool
+		check   func(t *testing.T, generator ReplyGenerator)
+	}{
+		{
+			name: "dify chat",
+			conf: &ReplyGeneratorConfig{Backend: DifyChatBackend, Secrets: secrets},
+			check: func(t *testing.T, generator ReplyGenerator) {
+				chat, ok := generator.(*XHSReviewChat)
+				if !ok || chat.url != DifyChatURL || chat.responseMode != BlockingMode {
+					t.Errorf("generator = %#v", generator)
+				}
+			},
+		},
+		{
+			name: "dify workflow defaults",
+			conf: &ReplyGeneratorConfig{Backend: DifyWorkflowBackend, Secrets: secrets},
+			check: func(t *testing.T, generator ReplyGenerator) {
+				workflow, ok := generator.(*DifyWorkflow)
+				if !ok || workflow.url != DifyWorkflowURL || workflow.outputKey != AnswerPath.String() ||
+					workflow.apiKey != "key-from-secrets" {
+					t.Errorf("generator = %#v", generator)
+				}
+			},
+		},
+		{
+			name: "dify workflow output key",
+			conf: &ReplyGeneratorConfig{Backend: DifyWorkflowBackend, OutputKey: "reply", APIKey: "app-conf"},
+			check: func(t *testing.T, generator ReplyGenerator) {
+				workflow, ok := generator.(*DifyWorkflow)
+				if !ok || workflow.outputKey != "reply" || workflow.apiKey != "app-conf" {
+					t.Errorf("generator = %#v", generator)
+				}
+			},
+		},
+		{
+			name: "openai defaults",
+			conf: &ReplyGeneratorConfig{Backend: OpenAIBackend, Model: "gpt-4o-mini", APIKey: "sk-conf", Secrets: secrets},
+			check: func(t *testing.T, generator ReplyGenerator) {
+				chat, ok := generator.(*OpenAIChat)
+				if !ok || chat.url != OpenAIChatURL || chat.model != "gpt-4o-mini" || chat.apiKey != "sk-conf" ||
+					chat.systemPrompt != DefaultSystemPrompt {
+					t.Errorf("generator = %#v", generator)
+				}
+			},
+		},
+		{
+			name: "ollama endpoint",
+			conf: &ReplyGeneratorConfig{Backend: OllamaBackend, Model: "qwen2.5", URL: "http://10.0.0.2:11434/api/chat",
+				SystemPrompt: "你是客服"},
+			check: func(t *testing.T, generator ReplyGenerator) {
+				chat, ok := generator.(*OllamaChat)
+				if !ok || chat.url != "http://10.0.0.2:11434/api/chat" || chat.systemPrompt != "你是客服" {
+					t.Errorf("generator = %#v", generator)
+				}
+			},
+		},
+		{
+			name: "ollama default endpoint",
+			conf: &ReplyGeneratorConfig{Backend: OllamaBackend, Model: "qwen2.5"},
+			check: func(t *testing.T, generator ReplyGenerator) {
+				if chat, ok := generator.(*OllamaChat); !ok || chat.url != OllamaChatURL {
+					t.Errorf("generator = %#v", generator)
+				}
+			},
+		},
+		{name: "openai model required", conf: &ReplyGeneratorConfig{Backend: OpenAIBackend}, wantErr: true},
+		{name: "ollama model required", conf: &ReplyGeneratorConfig{Backend: OllamaBackend}, wantErr: true},
+		{name: "unknown backend", conf: &ReplyGeneratorConfig{Backend: "claude"}, wantErr: true},
+		{name: "bad url", conf: &ReplyGeneratorConfig{Backend: DifyChatBackend, URL: "not a url"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewReplyGenerator(context.Background(), tt.conf, productCatalog)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewReplyGenerator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), string(tt.conf.Backend)) {
+					t.Errorf("NewReplyGenerator() error = %v, want the backend named", err)
+				}
+				return
+			}
+			tt.check(t, got)
+		})
+	}
+}
@@ -15,23 +15,87 @@ import (
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 
+	"PulseCheck/internal/session"
 	"PulseCheck/internal/tools"
 )
 
 type Review struct {
-	Id       string   `json:"id"`
-	Content  string   `json:"content"`
-	SkuInfo  *SkuInfo `json:"sku_info"`
-	Score    *Score   `json:"score"`
-	ReplyNum uint     `json:"reply_num"`
+	Id          string          `json:"id"`
+	Content     string          `json:"content"`
+	Images      []string        `json:"images"`
+	CreateTime  time.Time       `json:"create_time"`
+	Tags        []string        `json:"tags"`
+	Anonymous   bool            `json:"anonymous"`
+	ReviewType  int             `json:"review_type"`
+	SearchID    string          `json:"search_id"`
+	Descendants []*Descendant   `json:"descendants"`
+	SkuInfo     *SkuInfo        `json:"sku_info"`
+	Score       *Score          `json:"score"`
+	ReplyNum    uint            `json:"reply_num"`
+	LikeNum     uint            `json:"like_num"`
+	ButtonList  []*ReviewButton `json:"button_list"`
+	// Classification is tagged by a Classifier, it is not part of the xiaohongshu response
+	Classification *Classification `json:"classification,omitempty"`
+}
+
+// Descendant is the follow-up review appended by the buyer after the first one.
+type Descendant struct {
+	Id         string    `json:"id"`
+	Content    string    `json:"content"`
+	Images     []string  `json:"images"`
+	CreateTime time.Time `json:"create_time"`
 }
 
 type SkuInfo struct {
-	SkuID    string `json:"sku_id"`
-	SkuName  string `json:"sku_name"`
-	SkuPrice int    `json:"sku_price"`
-	ItemID   string `json:"item_id"`
-	OrderID  string `json:"order_id"`
+	SkuID     string        `json:"sku_id"`
+	SkuName   string        `json:"sku_name"`
+	SkuPrice  int           `json:"sku_price"`
+	ItemID    string        `json:"item_id"`
+	OrderID   string        `json:"order_id"`
+	Quantity  int           `json:"quantity"`
+	ImageLink string        `json:"image_link"`
+	Variants  []*SkuVariant `json:"variants"`
+}
+
+type SkuVariant struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+const (
+	ButtonTypeAppeal = 7
+	ButtonTypeReply  = 9
+)
+
+type ReviewButton struct {
+	Text       string `json:"text"`
+	Disabled   bool   `json:"disabled"`
+	ButtonType int    `json:"button_type"`
+	Status     int    `json:"status"`
+}
+
+// Button returns the button of the given type, nil if the review does not carry it.
+func (this *Review) Button(buttonType int) *ReviewButton {
+	for _, button := range this.ButtonList {
+		if button.ButtonType == buttonType {
+			return button
+		}
+	}
+	return nil
+}
+
+// Replyable tells whether the "回复评价" button is present and enabled.
+func (this *Review) Replyable() bool {
+	button := this.Button(ButtonTypeReply)
+	return button != nil && !button.Disabled
+}
+
+// Appealable tells whether the "申诉评价" button is present and enabled, it is disabled once the
+// review is appealed.
+func (this *Review) Appealable() bool {
+	button := this.Button(ButtonTypeAppeal)
+	return button != nil && !button.Disabled
 }
 
 type Score struct {
@@ -49,8 +113,24 @@ type ReviewSearchParam struct {
 	PageSize              int
 }
 
+// ReviewPage is one page of the review_manager result along with the total
+// number of reviews matching the search condition.
+type ReviewPage struct {
+	PageNum  int
+	PageSize int
+	Total    int
+	Reviews  []*Review
+}
+
+// HasMore tells whether there are more reviews after this page, given the number of reviews fetched
+// so far. The size of the page is not relied on, the server may cap it below the one requested.
+func (this *ReviewPage) HasMore(fetched int) bool {
+	return len(this.Reviews) != 0 && fetched < this.Total
+}
+
 type ReviewManager struct {
 	httpClient *http.Client
+	url        string
 }
 
 const (
@@ -65,18 +145,36 @@ const (
 	ReviewReplyStatusArrayPrefix = "review_reply_status_list."
 	ReviewStartTimeKey           = "review_start_time"
 	ReviewEndTimeKey             = "review_end_time"
+	// MaxPageNum guards against looping forever when the server keeps reporting a bigger total
+	MaxPageNum = 100
+)
+
+var (
+	// ErrReviewsTruncated the pages beyond MaxPageNum are not fetched, the reviews walked so far are
+	// returned along with it
+	ErrReviewsTruncated = errors.New("reviews truncated at max page number")
 )
 
-func (this *ReviewManager) newRequestBody(ctx context.Context, param *ReviewSearchParam) ([]byte, error) {
+func (this *ReviewSearchParam) pageSize() int {
+	if this.PageSize <= 0 {
+		return DefaultPageSizeValue
+	}
+	return this.PageSize
+}
+
+func (this *ReviewManager) newRequestBody(ctx context.Context, param *ReviewSearchParam, pageNum int) ([]byte, error) {
 	// YANGMU_TODO: 2024/10/26 -- need to verify param beforehand
 	json := []byte("{}")
 	if nil == param {
 		return nil, errors.New("param should not be nil")
 	}
+	if pageNum < DefaultPageNumValue {
+		pageNum = DefaultPageNumValue
+	}
 	// general configuration for request body
-	json, _ = sjson.SetBytes(json, PageSizeKey, DefaultPageSizeValue)
+	json, _ = sjson.SetBytes(json, PageSizeKey, param.pageSize())
 	json, _ = sjson.SetBytes(json, SourceKey, DefaultSourceKey)
-	json, _ = sjson.SetBytes(json, PageNumKey, DefaultPageNumValue)
+	json, _ = sjson.SetBytes(json, PageNumKey, pageNum)
 	// case1: retrieve the review record only by order id
 	if len(param.OrderID) != 0 {
 		json, _ = sjson.SetBytes(json, OrderIdKey, param.OrderID)
@@ -105,23 +203,69 @@ func (this *ReviewManager) newRequestBody(ctx context.Context, param *ReviewSear
 	return json, nil
 }
 
-func NewReviewManager(ctx context.Context, httpClient *http.Client) *ReviewManager {
-	return &ReviewManager{httpClient: httpClient}
+func NewReviewManager(ctx context.Context, httpClient *http.Client, opts ...ClientOption) *ReviewManager {
+	conf := newClientConfig(XiaohongshuBaseURL, opts)
+	return &ReviewManager{httpClient: httpClient, url: conf.baseURL + ReviewManagerPath}
 }
 
 const (
-	XHSReviewMangerURL = "https://ark.xiaohongshu.com/api/edith/review/v2/seller/review_manager"
+	ReviewManagerPath  = "/api/edith/review/v2/seller/review_manager"
+	XHSReviewMangerURL = XiaohongshuBaseURL + ReviewManagerPath
 )
 
-func (this *ReviewManager) GetReviews(ctx context.Context, param *ReviewSearchParam) (reviews []*Review, err error) {
-	requestBody, err := this.newRequestBody(ctx, param)
+// GetReviews walks through all pages matching the param and returns every review
+// along with the total count reported by xiaohongshu. If there are more than MaxPageNum pages the
+// reviews of the first ones are returned with ErrReviewsTruncated.
+func (this *ReviewManager) GetReviews(ctx context.Context, param *ReviewSearchParam) (reviews []*Review, total int, err error) {
+	reviews = make([]*Review, 0)
+	err = this.WalkReviews(ctx, param, func(page *ReviewPage) error {
+		reviews = append(reviews, page.Reviews...)
+		total = page.Total
+		return nil
+	})
+	if errors.Is(err, ErrReviewsTruncated) {
+		slog.Warn("reviews truncated.", slog.Int("total", total), slog.Int("fetched", len(reviews)))
+		return reviews, total, err
+	}
+	if nil != err {
+		return nil, 0, err
+	}
+	slog.Info("get reviews finished.", slog.Int("total", total), slog.Int("fetched", len(reviews)))
+	return reviews, total, nil
+}
+
+// WalkReviews requests the review pages one by one and hands each of them to fn,
+// until all pages indicated by total are consumed or fn returns an error. ErrReviewsTruncated is
+// returned if there are still more pages after MaxPageNum.
+func (this *ReviewManager) WalkReviews(ctx context.Context, param *ReviewSearchParam, fn func(page *ReviewPage) error) error {
+	fetched := 0
+	for pageNum := DefaultPageNumValue; pageNum <= MaxPageNum; pageNum++ {
+		page, err := this.GetReviewPage(ctx, param, pageNum)
+		if nil != err {
+			return errors.WithMessagef(err, "get review page:%d error.", pageNum)
+		}
+		if err = fn(page); nil != err {
+			return err
+		}
+		fetched += len(page.Reviews)
+		if !page.HasMore(fetched) {
+			return nil
+		}
+	}
+	return errors.WithMessagef(ErrReviewsTruncated, "maxPageNum:%d", MaxPageNum)
+}
+
+// GetReviewPage requests a single page of reviews.
+func (this *ReviewManager) GetReviewPage(ctx context.Context, param *ReviewSearchParam, pageNum int) (*ReviewPage, error) {
+	requestBody, err := this.newRequestBody(ctx, param, pageNum)
 	if nil != err {
 		return nil, errors.WithMessagef(err, "newRequestBody fail with param:%#v", param)
 	}
 	reqBodyStr := string(requestBody)
 	slog.Info(spew.Sprintf("request body:%#v generated by param:%#v", reqBodyStr, param))
 
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, XHSReviewMangerURL, bytes.NewReader(requestBody))
+	// searching is safe to retry, unlike replying
+	request, err := http.NewRequestWithContext(tools.AppendIdempotent(ctx), http.MethodPost, this.url, bytes.NewReader(requestBody))
 	if nil != err {
 		return nil, errors.WithMessagef(err, "construct xiaohongshu statistics request error. param:%#v, body:%#v", param, reqBodyStr)
 	}
@@ -134,33 +278,43 @@ func (this *ReviewManager) GetReviews(ctx context.Context, param *ReviewSearchPa
 	if nil != err {
 		return nil, errors.WithMessagef(err, "request failed with param:%#v requestBody:%#v", param, reqBodyStr)
 	}
+	respBody := response.Body
+	defer func() {
+		// drained so that the connection is reused after an early return
+		_, _ = io.Copy(io.Discard, respBody)
+		err := respBody.Close()
+		if err != nil {
+			slog.Error("close response body err.", tools.ErrAttr(err))
+		}
+	}()
 	statusCode := response.StatusCode
+	if err = checkAuthExpired(statusCode, gjson.Result{}); err != nil {
+		return nil, session.Expire(ctx, err)
+	}
 	if statusCode != http.StatusOK {
 		slog.Error("get xiaohongshu response error.",
-			slog.String("xiaohognshuURL", XHSReviewMangerURL),
+			slog.String("xiaohognshuURL", this.url),
 			slog.Int("statusCode", statusCode),
 			slog.String("body", string(requestBody)),
 		)
 		return nil, errors.Errorf("get xiaohongshu response error. xiaohongshuURL:%s statusCode:%d requestBody:%s",
-			XHSReviewMangerURL, statusCode, reqBodyStr)
+			this.url, statusCode, reqBodyStr)
 	}
-	respBody := response.Body
-	defer func() {
-		err := respBody.Close()
-		if err != nil {
-			slog.Error("close response body err.", tools.ErrAttr(err))
-		}
-	}()
 	b, err := io.ReadAll(respBody)
 	if err != nil {
 		return nil, errors.WithMessagef(err, "read response body fail with param:%#v body:%#v", param, reqBodyStr)
 	}
 
-	respData, err1 := this.unmarshal(b)
+	respData, total, err1 := this.unmarshal(b)
 	if nil != err1 {
-		return nil, errors.WithMessagef(err1, "unmarshal body data error. ")
+		return nil, session.Expire(ctx, errors.WithMessagef(err1, "unmarshal body data error. "))
 	}
-	return respData, nil
+	return &ReviewPage{
+		PageNum:  pageNum,
+		PageSize: param.pageSize(),
+		Total:    total,
+		Reviews:  respData,
+	}, nil
 }
 
 const (
@@ -177,17 +331,42 @@ const (
 	ItemID         Path = "item_id"
 	OrderID        Path = "order_id"
 
-	ReviewData Path = "review_data"
-	Content    Path = "content"
-	Text       Path = "text"
+	SkuQuantity  Path = "quantity"
+	SkuImageLink Path = "image_link"
+	Variants     Path = "variants"
+	VariantID    Path = "id"
+	VariantName  Path = "name"
+	VariantValue Path = "value"
+
+	ReviewData  Path = "review_data"
+	Content     Path = "content"
+	Text        Path = "text"
+	Images      Path = "images"
+	ImageLink   Path = "link"
+	CreateTime  Path = "create_time"
+	Tags        Path = "tags"
+	Anonymous   Path = "anonymous"
+	ReviewType  Path = "review_type"
+	SearchID    Path = "search_id"
+	Descendants Path = "descendants"
 
-	ReviewID        Path = "review_id"
-	InteractionInfo Path = "interaction_info"
+	ReviewID Path = "review_id"
+	// InteractionInfo is misspelled by the xiaohongshu api
+	InteractionInfo Path = "interation_info"
 	ReplyNum        Path = "reply_num"
+	LikeNum         Path = "like_num"
+
+	ButtonList Path = "button_list"
+	ButtonText Path = "text"
+	Disabled   Path = "disabled"
+	ButtonType Path = "button_type"
+	Status     Path = "status"
 
 	ServiceScore   Path = "service_score"
 	SkuScore       Path = "sku_score"
 	LogisticsScore Path = "logistics_score"
+
+	Total Path = "total"
 )
 
 /*
@@ -318,42 +497,98 @@ const (
   }
 }
 */
-func (this *ReviewManager) unmarshal(response []byte) ([]*Review, error) {
+func (this *ReviewManager) unmarshal(response []byte) ([]*Review, int, error) {
 	jsonData := gjson.ParseBytes(response)
 	codeResult := jsonData.Get("code")
 	if !codeResult.Exists() || codeResult.Int() != CODE_SUCCESS {
+		if err := checkAuthExpired(http.StatusOK, jsonData); err != nil {
+			return nil, 0, err
+		}
 		msg := jsonData.Get("msg").String()
-		return nil, errors.Errorf("response error:[%+v], jsondata:%+v", msg, jsonData.String())
+		return nil, 0, errors.Errorf("response error:[%+v], jsondata:%+v", msg, jsonData.String())
 	}
 
 	s := Data.Join(ReviewInfoList).String()
 	reviewInfoJson := jsonData.Get(s)
 	if !(reviewInfoJson.Exists() && reviewInfoJson.IsArray()) {
-		return nil, errors.Errorf("illegal json data. reviewInfoJson is not array. %#v", jsonData.String())
+		return nil, 0, errors.Errorf("illegal json data. reviewInfoJson is not array. %#v", jsonData.String())
 	}
+	total := int(jsonData.Get(Data.Join(Total).String()).Int())
 	arrays := reviewInfoJson.Array()
 	reviews := make([]*Review, 0, len(arrays))
 	for _, reviewInfo := range arrays {
-		review := &Review{}
-		review.Id = reviewInfo.Get(ReviewData.Join(ReviewID).String()).String()
-		review.Content = reviewInfo.Get(ReviewData.Join(Content).Join(Text).String()).String()
-		review.ReplyNum = uint(reviewInfo.Get(InteractionInfo.Join(ReplyNum).String()).Int())
-
-		sku := &SkuInfo{}
-		sku.SkuID = reviewInfo.Get(SkuInfo1.Join(SkuID).String()).String()
-		sku.ItemID = reviewInfo.Get(SkuInfo1.Join(ItemID).String()).String()
-		sku.OrderID = reviewInfo.Get(SkuInfo1.Join(OrderID).String()).String()
-		sku.SkuName = reviewInfo.Get(SkuInfo1.Join(SkuName).String()).String()
-		sku.SkuPrice = int(reviewInfo.Get(SkuInfo1.Join(SkuPrice).String()).Int())
-		review.SkuInfo = sku
-
-		score := &Score{}
-		score.LogisticsScore = uint8(reviewInfo.Get(ReviewData.Join(LogisticsScore).String()).Int())
-		score.SkuScore = uint8(reviewInfo.Get(ReviewData.Join(SkuScore).String()).Int())
-		score.ServiceScore = uint8(reviewInfo.Get(ReviewData.Join(ServiceScore).String()).Int())
-		review.Score = score
-
-		reviews = append(reviews, review)
+		reviews = append(reviews, this.unmarshalReview(reviewInfo))
+	}
+	return reviews, total, nil
+}
+
+func (this *ReviewManager) unmarshalReview(reviewInfo gjson.Result) *Review {
+	reviewData := reviewInfo.Get(ReviewData.String())
+	review := &Review{}
+	review.Id = reviewData.Get(ReviewID.String()).String()
+	review.Content = reviewData.Get(Content.Join(Text).String()).String()
+	review.Images = this.unmarshalImages(reviewData.Get(Content.Join(Images).String()))
+	review.CreateTime = time.Unix(reviewData.Get(CreateTime.String()).Int(), 0)
+	review.Anonymous = reviewData.Get(Anonymous.String()).Bool()
+	review.ReviewType = int(reviewData.Get(ReviewType.String()).Int())
+	review.SearchID = reviewData.Get(SearchID.String()).String()
+	review.Tags = make([]string, 0)
+	for _, tag := range reviewData.Get(Tags.String()).Array() {
+		review.Tags = append(review.Tags, tag.String())
+	}
+	review.Descendants = make([]*Descendant, 0)
+	for _, descendant := range reviewData.Get(Descendants.String()).Array() {
+		review.Descendants = append(review.Descendants, &Descendant{
+			Id:         descendant.Get(ReviewID.String()).String(),
+			Content:    descendant.Get(Content.Join(Text).String()).String(),
+			Images:     this.unmarshalImages(descendant.Get(Content.Join(Images).String())),
+			CreateTime: time.Unix(descendant.Get(CreateTime.String()).Int(), 0),
+		})
+	}
+	review.ReplyNum = uint(reviewInfo.Get(InteractionInfo.Join(ReplyNum).String()).Int())
+	review.LikeNum = uint(reviewInfo.Get(InteractionInfo.Join(LikeNum).String()).Int())
+
+	skuInfo := reviewInfo.Get(SkuInfo1.String())
+	sku := &SkuInfo{}
+	sku.SkuID = skuInfo.Get(SkuID.String()).String()
+	sku.ItemID = skuInfo.Get(ItemID.String()).String()
+	sku.OrderID = skuInfo.Get(OrderID.String()).String()
+	sku.SkuName = skuInfo.Get(SkuName.String()).String()
+	sku.SkuPrice = int(skuInfo.Get(SkuPrice.String()).Int())
+	sku.Quantity = int(skuInfo.Get(SkuQuantity.String()).Int())
+	sku.ImageLink = skuInfo.Get(SkuImageLink.String()).String()
+	sku.Variants = make([]*SkuVariant, 0)
+	for _, variant := range skuInfo.Get(Variants.String()).Array() {
+		sku.Variants = append(sku.Variants, &SkuVariant{
+			Id:    variant.Get(VariantID.String()).String(),
+			Name:  variant.Get(VariantName.String()).String(),
+			Value: variant.Get(VariantValue.String()).String(),
+		})
+	}
+	review.SkuInfo = sku
+
+	score := &Score{}
+	score.LogisticsScore = uint8(reviewData.Get(LogisticsScore.String()).Int())
+	score.SkuScore = uint8(reviewData.Get(SkuScore.String()).Int())
+	score.ServiceScore = uint8(reviewData.Get(ServiceScore.String()).Int())
+	review.Score = score
+
+	review.ButtonList = make([]*ReviewButton, 0)
+	for _, button := range reviewInfo.Get(ButtonList.String()).Array() {
+		review.ButtonList = append(review.ButtonList, &ReviewButton{
+			Text:       button.Get(ButtonText.String()).String(),
+			Disabled:   button.Get(Disabled.String()).Int() != 0,
+			ButtonType: int(button.Get(ButtonType.String()).Int()),
+			Status:     int(button.Get(Status.String()).Int()),
+		})
+	}
+	return review
+}
+
+func (this *ReviewManager) unmarshalImages(images gjson.Result) []string {
+	links := make([]string, 0)
+	for _, image := range images.Array() {
+		links = append(links, image.Get(ImageLink.String()).String())
 	}
-	return reviews, nil
+	return links
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 
+	"PulseCheck/internal/session"
 	"PulseCheck/internal/tools"
 )
 
@@ -23,6 +24,7 @@ type ReviewReplyParam struct {
 
 type ReviewReply struct {
 	httpClient *http.Client
+	url        string
 }
 
 const (
@@ -46,8 +48,9 @@ func (this *ReviewReply) newRequestBody(ctx context.Context, param *ReviewReplyP
 	return jsonData, nil
 }
 
-func NewReviewReply(ctx context.Context, httpClient *http.Client) *ReviewReply {
-	return &ReviewReply{httpClient: httpClient}
+func NewReviewReply(ctx context.Context, httpClient *http.Client, opts ...ClientOption) *ReviewReply {
+	conf := newClientConfig(XiaohongshuBaseURL, opts)
+	return &ReviewReply{httpClient: httpClient, url: conf.baseURL + ReviewReplyPath}
 }
 
 const (
@@ -59,6 +62,12 @@ const (
 )
 
 func (this *ReviewReply) verify(b []byte) error {
+	return verifySellerResult(b)
+}
+
+// verifySellerResult checks the code of a seller api response, an expired login is told apart by
+// session.ErrSessionExpired.
+func verifySellerResult(b []byte) error {
 	jsonData := gjson.ParseBytes(b)
 	jsonCode := jsonData.Get(Code.String())
 	if jsonCode.Exists() {
@@ -66,11 +75,15 @@ func (this *ReviewReply) verify(b []byte) error {
 			return nil
 		}
 	}
+	if err := checkAuthExpired(http.StatusOK, jsonData); err != nil {
+		return err
+	}
 	return errors.Errorf("msg:%s", jsonData.Get(Msg.String()))
 }
 
 const (
-	XHSReviewReplyURL = "https://ark.xiaohongshu.com/api/edith/review/seller_reply"
+	ReviewReplyPath   = "/api/edith/review/seller_reply"
+	XHSReviewReplyURL = XiaohongshuBaseURL + ReviewReplyPath
 )
 
 func (this *ReviewReply) Reply(ctx context.Context, param *ReviewReplyParam) error {
@@ -80,7 +93,7 @@ func (this *ReviewReply) Reply(ctx context.Context, param *ReviewReplyParam) err
 	}
 	reqBodyStr := string(requestBody)
 	slog.Info(spew.Sprintf("request body:%#v generated by param:%#v", reqBodyStr, param))
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, XHSReviewReplyURL, bytes.NewReader(requestBody))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, this.url, bytes.NewReader(requestBody))
 	if nil != err {
 		return errors.WithMessagef(err, "construct xiaohongshu statistics request error. param:%#v, body:%#v", param, reqBodyStr)
 	}
@@ -93,27 +106,31 @@ func (this *ReviewReply) Reply(ctx context.Context, param *ReviewReplyParam) err
 	if nil != err {
 		return errors.WithMessagef(err, "request failed with param:%#v requestBody:%#v", param, reqBodyStr)
 	}
-	statusCode := response.StatusCode
-	if statusCode != http.StatusOK {
-		slog.Error("get xiaohongshu response error.",
-			slog.String("xiaohognshuURL", XHSReviewReplyURL),
-			slog.Int("statusCode", statusCode),
-			slog.String("body", string(requestBody)),
-		)
-		return errors.Errorf("get xiaohongshu response error. xiaohongshuURL:%s statusCode:%d requestBody:%s",
-			XHSReviewMangerURL, statusCode, reqBodyStr)
-	}
 	respBody := response.Body
 	defer func() {
+		// drained so that the connection is reused after an early return
+		_, _ = io.Copy(io.Discard, respBody)
 		err := respBody.Close()
 		if err != nil {
 			slog.Error("close response body err.", tools.ErrAttr(err))
 		}
 	}()
+	statusCode := response.StatusCode
+	if err = checkAuthExpired(statusCode, gjson.Result{}); err != nil {
+		return session.Expire(ctx, err)
+	}
+	if statusCode != http.StatusOK {
+		// the body is left out, it carries the reply to the customer
+		slog.Error("get xiaohongshu response error.",
+			slog.String("xiaohognshuURL", this.url),
+			slog.Int("statusCode", statusCode),
+		)
+		return errors.Errorf("get xiaohongshu response error. xiaohongshuURL:%s statusCode:%d", this.url, statusCode)
+	}
 	b, err := io.ReadAll(respBody)
 	if err != nil {
 		return errors.WithMessagef(err, "read response body fail with param:%#v body:%#v", param, reqBodyStr)
 	}
 
-	return this.verify(b)
+	return session.Expire(ctx, this.verify(b))
 }
@@ -2,56 +2,201 @@ package xhsreq
 
 import (
 	"context"
-	"net/http"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
-	"PulseCheck/internal/tools"
+	"github.com/pkg/errors"
+
+	"PulseCheck/internal/secret"
+	"PulseCheck/internal/session"
 )
 
 func TestReviewManager_GetReviews(t *testing.T) {
-	type fields struct {
-		httpClient *http.Client
-	}
+	start, end := time.Unix(1729699200, 0), time.Unix(1729785600, 0)
 	type args struct {
 		ctx   context.Context
 		param *ReviewSearchParam
 	}
 	tests := []struct {
-		name        string
-		fields      fields
-		args        args
+		name     string
+		cassette string
+		args     args
+		// wantReviews is compared as a whole if set, otherwise the ids are
 		wantReviews []*Review
+		wantIds     []string
+		wantTotal   int
 		wantErr     bool
+		wantExpired bool
 	}{
 		{
-			name: "test",
-			fields: fields{
-				httpClient: tools.NewHttpsClient(nil, XiaohongshuDomain),
+			name:     "by order id",
+			cassette: "review_manager_order",
+			args: args{
+				ctx: testContext(),
+				param: &ReviewSearchParam{
+					OrderID: "P744461199153402613",
+				},
+			},
+			wantReviews: []*Review{
+				{
+					Id:          "414147469536208725",
+					Content:     "衣架很有质感也很实用 分别挂了吊带 长裙和健身的小背心",
+					Images:      []string{},
+					CreateTime:  time.Unix(1729770851, 0),
+					Tags:        []string{},
+					ReviewType:  4,
+					SearchID:    "92729778",
+					Descendants: []*Descendant{},
+					SkuInfo: &SkuInfo{
+						SkuID:     "669b9f0c0916240001ff6acb",
+						SkuName:   "实木波浪衣架内衣吊带衣架家用多功能挂钩背心女装收纳神器晾晒架 原木色20钩 3个装",
+						SkuPrice:  4502,
+						ItemID:    "669b9f0c0916240001ff6ac4",
+						OrderID:   "P744461199153402613",
+						Quantity:  1,
+						ImageLink: "//qimg.xiaohongshu.com/arkgoods/104100ao315fjtrsn1e066dc63ejjl00006d2b7jsqfbvm?itemId=669b9f0c0916240001ff6acb&imageView2/1/w/320/h/320/q/90.png",
+						Variants: []*SkuVariant{
+							{Id: "5a60c42f69bd891ed8939bc2", Name: "款式", Value: "原木色20钩"},
+							{Id: "5f71d3023faa42000156b10a", Name: "数量", Value: "3个装"},
+						},
+					},
+					Score: &Score{SkuScore: 5, ServiceScore: 5, LogisticsScore: 5},
+					ButtonList: []*ReviewButton{
+						{Text: "回复评价", ButtonType: ButtonTypeReply},
+						{Text: "申诉评价", ButtonType: ButtonTypeAppeal},
+					},
+				},
 			},
+			wantTotal: 1,
+		},
+		{
+			name:     "walk through pages",
+			cassette: "review_manager_pages",
 			args: args{
-				ctx: tools.AppendXHSToken(context.Background(), "AT-68c517428216101088487948dfhuvp629ni26cvc"),
+				ctx: testContext(),
+				param: &ReviewSearchParam{
+					ContentTypeList:       []int{2},
+					ReviewReplyStatusList: []int{2},
+					StartTime:             &start,
+					EndTime:               &end,
+					PageSize:              2,
+				},
+			},
+			wantIds:   []string{"414154303596118952", "414147469536208725", "414138512233489663"},
+			wantTotal: 3,
+		},
+		{
+			name:     "session expired",
+			cassette: "review_manager_expired",
+			args: args{
+				ctx: session.AppendSession(testContext(), session.New("test", testSecrets())),
 				param: &ReviewSearchParam{
 					OrderID: "P744461199153402613",
 				},
 			},
+			wantErr:     true,
+			wantExpired: true,
 		},
-
-		// TODO: Add test cases.
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			this := &ReviewManager{
-				httpClient: tt.fields.httpClient,
-			}
-			gotReviews, err := this.GetReviews(tt.args.ctx, tt.args.param)
+			this := NewReviewManager(tt.args.ctx, newCassetteClient(t, tt.cassette, XiaohongshuDomain))
+			gotReviews, gotTotal, err := this.GetReviews(tt.args.ctx, tt.args.param)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetReviews() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(gotReviews, tt.wantReviews) {
+			if tt.wantExpired {
+				if !errors.Is(err, session.ErrSessionExpired) {
+					t.Errorf("GetReviews() error = %v, want %v", err, session.ErrSessionExpired)
+				}
+				if err := session.Check(tt.args.ctx); err == nil {
+					t.Errorf("Check() error = nil, want the session invalidated")
+				}
+				return
+			}
+			if gotTotal != tt.wantTotal {
+				t.Errorf("GetReviews() gotTotal = %v, want %v", gotTotal, tt.wantTotal)
+			}
+			if tt.wantReviews != nil && !reflect.DeepEqual(gotReviews, tt.wantReviews) {
 				t.Errorf("GetReviews() gotReviews = %v, want %v", gotReviews, tt.wantReviews)
 			}
+			if tt.wantIds != nil {
+				gotIds := make([]string, 0, len(gotReviews))
+				for _, review := range gotReviews {
+					gotIds = append(gotIds, review.Id)
+				}
+				if !reflect.DeepEqual(gotIds, tt.wantIds) {
+					t.Errorf("GetReviews() gotIds = %v, want %v", gotIds, tt.wantIds)
+				}
+			}
 		})
 	}
 }
+
+func TestReviewManager_GetReviews_NoToken(t *testing.T) {
+	ctx := secret.AppendProvider(context.Background(), secret.Static{})
+	this := NewReviewManager(ctx, newCassetteClient(t, "review_manager_order", XiaohongshuDomain))
+	if _, _, err := this.GetReviews(ctx, &ReviewSearchParam{OrderID: "P744461199153402613"}); err == nil {
+		t.Errorf("GetReviews() error = nil, want the token missing")
+	}
+}
+
+func TestReviewManager_unmarshal(t *testing.T) {
+	// a page captured from the seller center
+	response, err := os.ReadFile("testdata/review_manager_page.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	this := &ReviewManager{}
+	reviews, total, err := this.unmarshal(response)
+	if err != nil {
+		t.Fatalf("unmarshal() error = %v", err)
+	}
+	if total != 2 || len(reviews) != 2 {
+		t.Fatalf("unmarshal() total = %d, reviews = %d, want 2", total, len(reviews))
+	}
+	want := &Review{
+		Id: "414154303596118952",
+		Content: "包装特别烂，薄薄的一层纸盒其它没了，好歹也拿个泡泡袋装起来，纸盒多处破损，还好里面架子没有明显瑕疵。" +
+			"架子就是直接裸着塞在里面的钩子和钩子打架整理了好久。",
+		Images:      []string{"https://qimg.xiaohongshu.com/comment/1040g2u0319ba13be6a005n5hug25ojk3267o7to"},
+		CreateTime:  time.Unix(1729772481, 0),
+		Anonymous:   true,
+		Tags:        []string{},
+		ReviewType:  4,
+		SearchID:    "92740503",
+		Descendants: []*Descendant{},
+		SkuInfo: &SkuInfo{
+			SkuID:    "662541bfe265da0001b257b3",
+			SkuName:  "【笔记同款】不锈钢带钩裤夹多功能夹子无痕帽子短裤 【🌟第二代-双头浸胶】米白 买15送15--共30个",
+			SkuPrice: 2700,
+			ItemID:   "6564c049474aad0001c7641a",
+			OrderID:  "P745021533103367131",
+			Quantity: 1,
+			ImageLink: "//qimg.xiaohongshu.com/arkgoods/104100ao311rhh21r10066dc63ejjl00006d2b7kf0mgsg" +
+				"?itemId=662541bfe265da0001b257b3&imageView2/1/w/320/h/320/q/90.jpeg",
+			Variants: []*SkuVariant{
+				{Id: "5a60c42f69bd891ed8939bc2", Name: "款式", Value: "【🌟第二代-双头浸胶】米白"},
+				{Id: "5a60c42f69bd891ed8939a42", Name: "包装数量", Value: "买15送15--共30个"},
+			},
+		},
+		Score: &Score{SkuScore: 5, ServiceScore: 5, LogisticsScore: 5},
+		ButtonList: []*ReviewButton{
+			{Text: "回复评价", ButtonType: 9},
+			{Text: "申诉评价", ButtonType: 7},
+		},
+	}
+	if !reflect.DeepEqual(reviews[0], want) {
+		t.Errorf("unmarshal() got = %#v, want %#v", reviews[0], want)
+	}
+	if !reviews[0].Replyable() || !reviews[0].Appealable() || reviews[1].Anonymous {
+		t.Errorf("unmarshal() buttons or anonymity of %#v wrong", reviews)
+	}
+
+	if _, _, err = this.unmarshal([]byte(`{"code":-1,"msg":"系统繁忙"}`)); err == nil {
+		t.Errorf("unmarshal() error = nil, want the failed code")
+	}
+}